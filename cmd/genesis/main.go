@@ -0,0 +1,609 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/providenetwork/baseledger/common"
+	"github.com/providenetwork/baseledger/consensus"
+	"github.com/providenetwork/baseledger/protocol"
+	"github.com/providenetwork/tendermint/crypto"
+	"github.com/providenetwork/tendermint/crypto/ed25519"
+	tmjson "github.com/providenetwork/tendermint/libs/json"
+	"github.com/providenetwork/tendermint/types"
+	"github.com/provideplatform/provide-go/api/nchain"
+)
+
+const defaultGenesisFile = "genesis.json"
+const defaultValidatorPower = int64(1)
+
+const usage = `usage: genesis <command> [flags]
+
+Builds the genesis document of a new baseledger network.
+
+commands:
+  init                create a new genesis document
+  add-validator       add a founding validator by public key or by the
+                      validator key of a node
+  set-staking         set the staking contract and network params
+  set-consensus       set consensus params
+  validate            validate the genesis document and its signatures
+  sign                sign the genesis document as a founding validator
+  collect-signatures  add founding validator signatures to the genesis document
+
+Run 'genesis <command> -h' for the flags of a command.
+`
+
+var commands = map[string]func(args []string) error{
+	"init":               initGenesis,
+	"add-validator":      addValidator,
+	"set-staking":        setStaking,
+	"set-consensus":      setConsensus,
+	"validate":           validateGenesis,
+	"sign":               signGenesis,
+	"collect-signatures": collectSignatures,
+}
+
+// genesis builds a ready genesis.json for a new network, one step at a time;
+// each command reads and rewrites the genesis file given by -file
+func main() {
+	if len(os.Args) > 1 && (os.Args[1] == "-h" || os.Args[1] == "--help" || os.Args[1] == "help") {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(0)
+	}
+
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	run, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command: %s\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+
+	err := run(os.Args[2:])
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		fmt.Fprintf(os.Stderr, "genesis %s: %s\n", os.Args[1], err.Error())
+		os.Exit(1)
+	}
+}
+
+func flagSet(name string) (*flag.FlagSet, *string) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	file := flags.String("file", defaultGenesisFile, "path to the genesis document")
+	return flags, file
+}
+
+// nodeFlags are the flags locating the node whose validator key is used
+type nodeFlags struct {
+	config *string
+	home   *string
+}
+
+func nodeFlagSet(flags *flag.FlagSet) *nodeFlags {
+	return &nodeFlags{
+		config: flags.String("config", "", "path to the JSON config file of the node; overrides BASELEDGER_CONFIG"),
+		home:   flags.String("home", "", "root directory of the node; overrides BASELEDGER_HOME"),
+	}
+}
+
+// nodeConfig loads the config of the node for the chain of the given genesis,
+// in the same way as the node does, so its validator key is resolved by the
+// configured signer (BASELEDGER_SIGNER)
+func (f *nodeFlags) nodeConfig(genesis *types.GenesisDoc) (*common.Config, error) {
+	overrides := map[string]string{
+		"chain_id": genesis.ChainID,
+	}
+
+	if *f.config != "" {
+		overrides[common.ConfigFileEnv] = *f.config
+	}
+
+	if *f.home != "" {
+		overrides["home"] = *f.home
+	}
+
+	cfg, err := common.ConfigFactory(overrides)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load node configuration; %s", err.Error())
+	}
+
+	return cfg, nil
+}
+
+func initGenesis(args []string) error {
+	flags, file := flagSet("init")
+	chainID := flags.String("chain-id", "", "chain id of the new network")
+	genesisTime := flags.String("genesis-time", "", "genesis time (RFC 3339); defaults to now")
+	force := flags.Bool("force", false, "overwrite an existing genesis document")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if *chainID == "" {
+		return errors.New("-chain-id is required")
+	}
+
+	if _, err := os.Stat(*file); err == nil && !*force {
+		return fmt.Errorf("%s already exists; use -force to overwrite it", *file)
+	}
+
+	timestamp := time.Now().UTC()
+	if *genesisTime != "" {
+		timestamp, err = time.Parse(time.RFC3339Nano, *genesisTime)
+		if err != nil {
+			return fmt.Errorf("invalid genesis time; %s", err.Error())
+		}
+	}
+
+	appState, err := json.Marshal(&protocol.StateParams{})
+	if err != nil {
+		return err
+	}
+
+	genesis := &types.GenesisDoc{
+		AppState:        appState,
+		ChainID:         *chainID,
+		ConsensusParams: consensus.DefaultConsensusParams(),
+		GenesisTime:     timestamp,
+		InitialHeight:   int64(1),
+		Validators:      make([]types.GenesisValidator, 0),
+	}
+
+	return writeGenesis(*file, genesis)
+}
+
+func addValidator(args []string) error {
+	flags, file := flagSet("add-validator")
+	pubkey := flags.String("pubkey", "", "base64-encoded ed25519 public key of the validator; defaults to the validator key of the node")
+	node := nodeFlagSet(flags)
+	power := flags.Int64("power", defaultValidatorPower, "voting power of the validator")
+	name := flags.String("name", "", "name of the validator")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if *power <= 0 {
+		return fmt.Errorf("invalid voting power: %d", *power)
+	}
+
+	genesis, err := readGenesis(*file)
+	if err != nil {
+		return err
+	}
+
+	var key crypto.PubKey
+	if *pubkey != "" {
+		raw, err := base64.StdEncoding.DecodeString(*pubkey)
+		if err != nil || len(raw) != ed25519.PubKeySize {
+			return errors.New("-pubkey must be a base64-encoded ed25519 public key")
+		}
+		key = ed25519.PubKey(raw)
+	} else {
+		cfg, err := node.nodeConfig(genesis)
+		if err != nil {
+			return err
+		}
+
+		key, err = consensus.ValidatorPubKey(cfg)
+		if err != nil {
+			return fmt.Errorf("failed to resolve the validator key of the node; %s; give the validator's -pubkey instead", err.Error())
+		}
+	}
+
+	for _, validator := range genesis.Validators {
+		if validator.PubKey.Equals(key) {
+			return fmt.Errorf("validator %s already in genesis", key.Address())
+		}
+	}
+
+	genesis.Validators = append(genesis.Validators, types.GenesisValidator{
+		Address: key.Address(),
+		PubKey:  key,
+		Power:   *power,
+		Name:    *name,
+	})
+
+	fmt.Fprintf(os.Stderr, "added validator %s with voting power %d\n", key.Address(), *power)
+	return writeUnsignedGenesis(*file, genesis)
+}
+
+func setStaking(args []string) error {
+	flags, file := flagSet("set-staking")
+	network := flags.String("network", "ropsten", "staking network")
+	address := flags.String("address", "", "staking contract address on the staking network")
+	contract := flags.String("contract", "", "path to the compiled staking contract artifact")
+	argv := flags.String("argv", "[]", "JSON array of staking contract constructor arguments")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if *address == "" || *contract == "" {
+		return errors.New("-address and -contract are required")
+	}
+
+	raw, err := os.ReadFile(*contract)
+	if err != nil {
+		return err
+	}
+
+	var artifact *nchain.CompiledArtifact
+	err = json.Unmarshal(raw, &artifact)
+	if err != nil {
+		return fmt.Errorf("malformed staking contract artifact; %s", err.Error())
+	}
+
+	var params []interface{}
+	err = json.Unmarshal([]byte(*argv), &params)
+	if err != nil {
+		return fmt.Errorf("-argv must be a JSON array; %s", err.Error())
+	}
+
+	networkParams := &protocol.NetworkParams{
+		Address: address,
+		Argv:    params,
+	}
+
+	staking := &protocol.StakingParams{
+		Contract: artifact,
+		Network:  &protocol.Network{},
+	}
+
+	switch *network {
+	case "ropsten":
+		staking.Network.Ropsten = networkParams
+	default:
+		return fmt.Errorf("unrecognized staking network: %s", *network)
+	}
+
+	genesis, err := readGenesis(*file)
+	if err != nil {
+		return err
+	}
+
+	stateParams, err := readStateParams(genesis)
+	if err != nil {
+		return err
+	}
+
+	stateParams.Staking = staking
+	genesis.AppState, err = json.Marshal(stateParams)
+	if err != nil {
+		return err
+	}
+
+	return writeUnsignedGenesis(*file, genesis)
+}
+
+func setConsensus(args []string) error {
+	flags, file := flagSet("set-consensus")
+	blockMaxBytes := flags.Int64("block-max-bytes", 0, "maximum block size in bytes")
+	blockMaxGas := flags.Int64("block-max-gas", 0, "maximum gas per block; -1 for unlimited")
+	blockTimeIota := flags.Int64("block-time-iota-ms", 0, "minimum time increment between blocks in milliseconds")
+	evidenceMaxAgeBlocks := flags.Int64("evidence-max-age-blocks", 0, "maximum age of evidence in blocks")
+	evidenceMaxAgeDuration := flags.Duration("evidence-max-age-duration", 0, "maximum age of evidence")
+	evidenceMaxBytes := flags.Int64("evidence-max-bytes", 0, "maximum total size of evidence per block in bytes")
+	appVersion := flags.Uint64("app-version", 0, "app version at genesis")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	genesis, err := readGenesis(*file)
+	if err != nil {
+		return err
+	}
+
+	params := genesis.ConsensusParams
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "block-max-bytes":
+			params.Block.MaxBytes = *blockMaxBytes
+		case "block-max-gas":
+			params.Block.MaxGas = *blockMaxGas
+		case "block-time-iota-ms":
+			params.Block.TimeIotaMs = *blockTimeIota
+		case "evidence-max-age-blocks":
+			params.Evidence.MaxAgeNumBlocks = *evidenceMaxAgeBlocks
+		case "evidence-max-age-duration":
+			params.Evidence.MaxAgeDuration = *evidenceMaxAgeDuration
+		case "evidence-max-bytes":
+			params.Evidence.MaxBytes = *evidenceMaxBytes
+		case "app-version":
+			params.Version.AppVersion = *appVersion
+		}
+	})
+
+	err = types.ValidateConsensusParams(*params)
+	if err != nil {
+		return fmt.Errorf("invalid consensus params; %s", err.Error())
+	}
+
+	return writeUnsignedGenesis(*file, genesis)
+}
+
+func validateGenesis(args []string) error {
+	flags, file := flagSet("validate")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	genesis, err := readGenesis(*file)
+	if err != nil {
+		return err
+	}
+
+	params, err := protocol.ValidateGenesis(genesis)
+	if err != nil {
+		return err
+	}
+
+	if len(genesis.Validators) == 0 {
+		return errors.New("genesis requires at least one validator")
+	}
+
+	hash, err := consensus.GenesisHash(genesis)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("chain id:   %s\n", genesis.ChainID)
+	fmt.Printf("hash:       %s\n", hash)
+	fmt.Printf("validators: %d\n", len(genesis.Validators))
+	fmt.Printf("signatures: %d\n", len(params.Signatures))
+
+	missing := unsignedValidators(genesis, params)
+	if len(missing) > 0 {
+		fmt.Printf("unsigned:   %s\n", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+func signGenesis(args []string) error {
+	flags, file := flagSet("sign")
+	node := nodeFlagSet(flags)
+	output := flags.String("output", "", "path to write the signature; defaults to stdout")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	genesis, err := readGenesis(*file)
+	if err != nil {
+		return err
+	}
+
+	_, err = protocol.ValidateGenesis(genesis)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := node.nodeConfig(genesis)
+	if err != nil {
+		return err
+	}
+
+	privkey, err := consensus.ValidatorSigningKey(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to resolve the validator key of the node; %s", err.Error())
+	}
+
+	pubkey := privkey.PubKey()
+	if pubkey == nil {
+		return errors.New("failed to resolve the validator public key of the node")
+	}
+
+	signBytes, err := protocol.GenesisSignBytes(genesis)
+	if err != nil {
+		return err
+	}
+
+	sig, err := privkey.Sign(signBytes)
+	if err != nil {
+		return fmt.Errorf("failed to sign genesis; %s", err.Error())
+	}
+
+	raw, err := json.MarshalIndent(&protocol.GenesisSignature{
+		Address:   pubkey.Address().String(),
+		Signature: sig,
+	}, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	if *output == "" {
+		fmt.Println(string(raw))
+		return nil
+	}
+
+	return os.WriteFile(*output, raw, 0644)
+}
+
+func collectSignatures(args []string) error {
+	flags, file := flagSet("collect-signatures")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: genesis collect-signatures [-file genesis.json] <signature file>...")
+		flags.PrintDefaults()
+	}
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if flags.NArg() == 0 {
+		return errors.New("at least one signature file is required")
+	}
+
+	genesis, err := readGenesis(*file)
+	if err != nil {
+		return err
+	}
+
+	stateParams, err := readStateParams(genesis)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range flags.Args() {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		var signature *protocol.GenesisSignature
+		err = json.Unmarshal(raw, &signature)
+		if err != nil {
+			return fmt.Errorf("malformed signature %s; %s", path, err.Error())
+		}
+
+		signatures := make([]*protocol.GenesisSignature, 0, len(stateParams.Signatures)+1)
+		for _, sig := range stateParams.Signatures {
+			if sig.Address != signature.Address {
+				signatures = append(signatures, sig)
+			}
+		}
+		stateParams.Signatures = append(signatures, signature)
+	}
+
+	sort.Slice(stateParams.Signatures, func(i, j int) bool {
+		return stateParams.Signatures[i].Address < stateParams.Signatures[j].Address
+	})
+
+	// replace only the signatures, so the signed app_state is kept as is
+	appState := map[string]json.RawMessage{}
+	if len(bytes.TrimSpace(genesis.AppState)) > 0 {
+		err = json.Unmarshal(genesis.AppState, &appState)
+		if err != nil {
+			return fmt.Errorf("malformed genesis app_state; %s", err.Error())
+		}
+	}
+
+	appState["signatures"], err = json.Marshal(stateParams.Signatures)
+	if err != nil {
+		return err
+	}
+
+	genesis.AppState, err = json.Marshal(appState)
+	if err != nil {
+		return err
+	}
+
+	params, err := protocol.ValidateGenesis(genesis)
+	if err != nil {
+		return err
+	}
+
+	missing := unsignedValidators(genesis, params)
+	if len(missing) > 0 {
+		fmt.Fprintf(os.Stderr, "genesis not yet signed by: %s\n", strings.Join(missing, ", "))
+	}
+
+	return writeGenesis(*file, genesis)
+}
+
+// unsignedValidators returns the addresses of the genesis validators which
+// have not signed the genesis
+func unsignedValidators(genesis *types.GenesisDoc, params *protocol.StateParams) []string {
+	signed := map[string]bool{}
+	for _, signature := range params.Signatures {
+		signed[signature.Address] = true
+	}
+
+	missing := make([]string, 0)
+	for _, validator := range genesis.Validators {
+		if !signed[validator.Address.String()] {
+			missing = append(missing, validator.Address.String())
+		}
+	}
+
+	return missing
+}
+
+func readGenesis(path string) (*types.GenesisDoc, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var genesis *types.GenesisDoc
+	err = tmjson.Unmarshal(raw, &genesis)
+	if err != nil {
+		return nil, fmt.Errorf("malformed genesis %s; %s", path, err.Error())
+	}
+
+	err = genesis.ValidateAndComplete()
+	if err != nil {
+		return nil, fmt.Errorf("invalid genesis %s; %s", path, err.Error())
+	}
+
+	return genesis, nil
+}
+
+func readStateParams(genesis *types.GenesisDoc) (*protocol.StateParams, error) {
+	var params *protocol.StateParams
+	if len(genesis.AppState) > 0 {
+		err := json.Unmarshal(genesis.AppState, &params)
+		if err != nil {
+			return nil, fmt.Errorf("malformed genesis app_state; %s", err.Error())
+		}
+	}
+
+	if params == nil {
+		params = &protocol.StateParams{}
+	}
+
+	return params, nil
+}
+
+// writeUnsignedGenesis writes the given genesis after dropping any signatures,
+// which no longer cover it
+func writeUnsignedGenesis(path string, genesis *types.GenesisDoc) error {
+	params, err := readStateParams(genesis)
+	if err != nil {
+		return err
+	}
+
+	if len(params.Signatures) > 0 {
+		fmt.Fprintf(os.Stderr, "dropped %d genesis signatures; founding validators must sign the genesis again\n", len(params.Signatures))
+		params.Signatures = nil
+
+		genesis.AppState, err = json.Marshal(params)
+		if err != nil {
+			return err
+		}
+	}
+
+	return writeGenesis(path, genesis)
+}
+
+func writeGenesis(path string, genesis *types.GenesisDoc) error {
+	_, err := protocol.ValidateGenesis(genesis)
+	if err != nil {
+		return err
+	}
+
+	raw, err := tmjson.MarshalIndent(genesis, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, raw, 0644)
+}
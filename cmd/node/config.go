@@ -0,0 +1,31 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// printConfig validates the configuration and prints the effective settings,
+// or writes them to the given output file, which may be used as a config file;
+// secrets are omitted
+func printConfig(args []string) error {
+	flags, config := flagSet("config")
+	output := flags.String("output", "", "path to write the effective config; defaults to stdout")
+	cfg, err := config.parse(flags, args)
+	if err != nil {
+		return err
+	}
+
+	raw, err := json.MarshalIndent(cfg.Settings(), "", "    ")
+	if err != nil {
+		return err
+	}
+
+	if *output == "" {
+		fmt.Println(string(raw))
+		return nil
+	}
+
+	return os.WriteFile(*output, raw, 0600)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/providenetwork/baseledger/common"
+	"github.com/providenetwork/baseledger/consensus"
+	"github.com/providenetwork/baseledger/protocol"
+	tmjson "github.com/providenetwork/tendermint/libs/json"
+)
+
+// export writes a genesis document for a new chain whose app_state is the last
+// committed state of the configured chain; the node must not be running
+func export(args []string) error {
+	flags, config := flagSet("export")
+	chainID := flags.String("export-chain-id", "", "chain id of the new chain")
+	output := flags.String("output", "", "path to write the exported genesis; defaults to stdout")
+	cfg, err := config.parse(flags, args)
+	if err != nil {
+		return err
+	}
+
+	if *chainID == "" {
+		return fmt.Errorf("%w; -export-chain-id is required", errUsage)
+	}
+
+	lock, err := lockRootDir(cfg)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	genesis, err := consensus.GenesisDocFactory(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to load genesis; %s", err.Error())
+	}
+
+	if *chainID == genesis.ChainID {
+		return fmt.Errorf("%w; the exported chain id must differ from the current chain id: %s", errUsage, genesis.ChainID)
+	}
+
+	exported, err := protocol.ExportGenesis(cfg, genesis, *chainID)
+	if err != nil {
+		return fmt.Errorf("failed to export genesis; %s", err.Error())
+	}
+
+	raw, err := tmjson.MarshalIndent(exported, "", "    ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal exported genesis; %s", err.Error())
+	}
+
+	if *output == "" {
+		fmt.Println(string(raw))
+		return nil
+	}
+
+	err = os.WriteFile(*output, raw, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write exported genesis; %s", err.Error())
+	}
+
+	common.Log.Debugf("exported genesis for chain %s at height %d to %s", exported.ChainID, exported.InitialHeight-1, *output)
+	return nil
+}
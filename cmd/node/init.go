@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/providenetwork/baseledger/consensus"
+)
+
+// initNode initializes the genesis and keys of the node without starting it;
+// seed nodes only have a node key
+func initNode(args []string) error {
+	flags, config := flagSet("init")
+	cfg, err := config.parse(flags, args)
+	if err != nil {
+		return err
+	}
+
+	lock, err := lockRootDir(cfg)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	if cfg.IsSeedNode() {
+		nodeKey, err := consensus.InitSeedNode(cfg)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("root:      %s\n", cfg.RootDir)
+		fmt.Printf("chain id:  %s\n", cfg.ChainID)
+		fmt.Printf("node id:   %s\n", nodeKey.ID())
+		return nil
+	}
+
+	genesis, nodeKey, pubkey, err := consensus.InitNode(cfg)
+	if err != nil {
+		return err
+	}
+
+	hash, err := consensus.GenesisHash(genesis)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("root:      %s\n", cfg.RootDir)
+	fmt.Printf("chain id:  %s\n", genesis.ChainID)
+	fmt.Printf("genesis:   %s\n", hash)
+	fmt.Printf("node id:   %s\n", nodeKey.ID())
+	if pubkey == nil {
+		fmt.Printf("validator: held by the remote signer\n")
+	} else {
+		fmt.Printf("validator: %s\n", pubkey.Address())
+	}
+	return nil
+}
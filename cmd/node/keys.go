@@ -0,0 +1,258 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/providenetwork/baseledger/common"
+	"github.com/providenetwork/baseledger/consensus"
+	"github.com/providenetwork/tendermint/crypto"
+	tmos "github.com/providenetwork/tendermint/libs/os"
+)
+
+const keysUsage = `usage: node keys <command> [flags]
+
+Manages the node and validator keys of the node using the configured signer
+(BASELEDGER_SIGNER).
+
+commands:
+  generate         generate the validator key, which must not exist
+  show             print the node id and the validator address and public key
+  export           export the validator key of the keystore, encrypted
+  import           import an exported validator key into the keystore
+  rotate-node-key  replace the p2p node key with a new key
+
+Run 'node keys <command> -h' for the flags of a command.
+`
+
+var keysCommands = map[string]func(args []string) error{
+	"generate":        generateKeys,
+	"show":            showKeys,
+	"export":          exportKeys,
+	"import":          importKeys,
+	"rotate-node-key": rotateNodeKey,
+}
+
+// keys dispatches the given args to a keys command
+func keys(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, keysUsage)
+		return fmt.Errorf("%w; no keys command given", errUsage)
+	}
+
+	if args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		fmt.Fprint(os.Stderr, keysUsage)
+		return nil
+	}
+
+	run, ok := keysCommands[args[0]]
+	if !ok {
+		names := make([]string, 0, len(keysCommands))
+		for name := range keysCommands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("%w; unknown keys command %s; expected one of %s", errUsage, args[0], strings.Join(names, ", "))
+	}
+
+	return run(args[1:])
+}
+
+// generateKeys generates the validator key using the configured signer
+func generateKeys(args []string) error {
+	flags, config := flagSet("keys generate")
+	cfg, err := config.parse(flags, args)
+	if err != nil {
+		return err
+	}
+
+	lock, err := lockRootDir(cfg)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	pubkey, err := consensus.GenerateValidatorKey(cfg)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("signer:    %s\n", cfg.Signer)
+	printPubKey(pubkey)
+	return nil
+}
+
+// showKeys prints the node id and the validator address and public key
+func showKeys(args []string) error {
+	flags, config := flagSet("keys show")
+	cfg, err := config.parse(flags, args)
+	if err != nil {
+		return err
+	}
+
+	nodeKey, err := consensus.NodeKey(cfg)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("node id:   %s\n", nodeKey.ID())
+	if cfg.IsSeedNode() {
+		return nil
+	}
+
+	fmt.Printf("signer:    %s\n", cfg.Signer)
+	if cfg.UsesRemoteSigner() {
+		fmt.Printf("validator: held by the remote signer\n")
+		return nil
+	}
+
+	pubkey, err := consensus.ValidatorPubKey(cfg)
+	if err != nil {
+		return err
+	}
+
+	printPubKey(pubkey)
+	return nil
+}
+
+// exportKeys writes the validator key of the keystore to a new file,
+// encrypted with the keystore passphrase or the given passphrase
+func exportKeys(args []string) error {
+	flags, config := flagSet("keys export")
+	output := flags.String("output", "", "path of the exported key, which must not exist")
+	passphraseFile := flags.String("passphrase-file", "", "file holding the passphrase to encrypt the exported key with; defaults to the keystore passphrase")
+	cfg, err := config.parse(flags, args)
+	if err != nil {
+		return err
+	}
+
+	if *output == "" {
+		return fmt.Errorf("%w; -output is required", errUsage)
+	}
+
+	passphrase, err := keysPassphrase(cfg, *passphraseFile)
+	if err != nil {
+		return err
+	}
+
+	keystore, err := consensus.ExportKeystore(cfg, passphrase)
+	if err != nil {
+		return err
+	}
+
+	err = consensus.WriteKeystore(*output, keystore)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("exported validator key %s to %s\n", keystore.Address, *output)
+	return nil
+}
+
+// importKeys imports an exported validator key into the keystore, which must
+// not exist
+func importKeys(args []string) error {
+	flags, config := flagSet("keys import")
+	input := flags.String("input", "", "path of the exported key")
+	passphraseFile := flags.String("passphrase-file", "", "file holding the passphrase of the exported key; defaults to the keystore passphrase")
+	cfg, err := config.parse(flags, args)
+	if err != nil {
+		return err
+	}
+
+	if *input == "" {
+		return fmt.Errorf("%w; -input is required", errUsage)
+	}
+
+	passphrase, err := keysPassphrase(cfg, *passphraseFile)
+	if err != nil {
+		return err
+	}
+
+	keystore, err := consensus.ReadKeystore(*input)
+	if err != nil {
+		return err
+	}
+
+	lock, err := lockRootDir(cfg)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	pubkey, err := consensus.ImportKeystore(cfg, keystore, passphrase)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("imported validator key into %s\n", cfg.KeystoreFile)
+	printPubKey(pubkey)
+
+	// the sign state of the key is not exported with it
+	if !tmos.FileExists(cfg.PrivValidatorStateFile()) {
+		fmt.Printf("\n%s not found; if this key has signed blocks elsewhere, set BASELEDGER_DOUBLE_SIGN_CHECK_HEIGHT for the first start\n", filepath.Base(cfg.PrivValidatorStateFile()))
+	}
+	return nil
+}
+
+// rotateNodeKey writes a new p2p node key to the local node key file; the
+// node must not be running
+func rotateNodeKey(args []string) error {
+	flags, config := flagSet("keys rotate-node-key")
+	cfg, err := config.parse(flags, args)
+	if err != nil {
+		return err
+	}
+
+	lock, err := lockRootDir(cfg)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	previous, rotated, err := consensus.RotateNodeKey(cfg)
+	if err != nil {
+		return err
+	}
+
+	if previous != "" {
+		fmt.Printf("previous node id: %s\n", previous)
+	}
+	fmt.Printf("node id:          %s\n", rotated)
+	fmt.Printf("\npeers which dial this node by id, e.g. as a persistent peer, must be given the new node id\n")
+	if cfg.UsesVaultSigner() {
+		fmt.Printf("the new key in %s takes precedence over the vault node key, which is left unchanged\n", cfg.NodeKeyFile())
+	}
+	if cfg.IsValidatorNode() {
+		fmt.Printf("the node id is not the validator address; the validator registers the new node id once the node runs again\n")
+	}
+	return nil
+}
+
+// keysPassphrase returns the passphrase in the given file, or the keystore
+// passphrase if no file is given
+func keysPassphrase(cfg *common.Config, path string) (string, error) {
+	if path != "" {
+		passphrase, err := common.ReadSecretFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read passphrase file; %s", err.Error())
+		}
+		return passphrase, nil
+	}
+
+	if cfg.KeystorePassphrase == nil {
+		return "", fmt.Errorf("%w; -passphrase-file, BASELEDGER_KEYSTORE_PASSPHRASE or BASELEDGER_KEYSTORE_PASSPHRASE_FILE is required", errUsage)
+	}
+
+	return *cfg.KeystorePassphrase, nil
+}
+
+func printPubKey(pubkey crypto.PubKey) {
+	fmt.Printf("validator: %s\n", pubkey.Address())
+	fmt.Printf("pub key:   %s\n", base64.StdEncoding.EncodeToString(pubkey.Bytes()))
+	fmt.Printf("pub hex:   %X\n", pubkey.Bytes())
+}
@@ -1,82 +1,190 @@
 package main
 
 import (
-	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"os"
-	"os/signal"
-	"sync/atomic"
-	"syscall"
-	"time"
+	"strings"
 
 	"github.com/providenetwork/baseledger/common"
-	"github.com/providenetwork/baseledger/consensus"
 )
 
-const runloopSleepInterval = 250 * time.Millisecond
-const runloopTickInterval = 5000 * time.Millisecond
+// exit codes
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
 
-var (
-	cancelF     context.CancelFunc
-	closing     uint32
-	shutdownCtx context.Context
-	sigs        chan os.Signal
+const usage = `usage: node <command> [flags]
 
-	baseledger *consensus.Tendermint
-)
+Runs and manages a baseledger node. Configuration is read from the config file
+given by -config or BASELEDGER_CONFIG, then the environment, then the flags of
+each command, with later sources taking precedence.
 
-func init() {
-	var err error
-	baseledger, err = consensus.TendermintFactory()
-	if err != nil {
-		panic(err)
-	}
+commands:
+  start           start the node (default)
+  init            initialize the genesis and keys of the node without starting it
+  version         print version information
+  show-node-id    print the p2p node id
+  show-validator  print the validator public key and address
+  keys            generate, show, import, export and rotate keys
+  reset           remove the blockchain data and application state (unsafe)
+  export          export the committed state as the genesis of a new chain
+  status          print the status of a running node
+  config          validate and print the effective configuration
+
+Run 'node <command> -h' for the flags of a command.
+`
+
+// version is the baseledger version, set at build time
+var version = "dev"
+
+var commands = map[string]func(args []string) error{
+	"start":          start,
+	"init":           initNode,
+	"version":        printVersion,
+	"show-node-id":   showNodeID,
+	"show-validator": showValidator,
+	"keys":           keys,
+	"reset":          reset,
+	"export":         export,
+	"status":         status,
+	"config":         printConfig,
 }
 
+// errUsage is returned by commands invoked with invalid arguments
+var errUsage = errors.New("invalid usage")
+
 func main() {
-	common.Log.Debugf("starting baseledger node")
-	installSignalHandlers()
+	args := os.Args[1:]
+	name := "start"
+	if len(args) > 0 && (args[0] == "-h" || args[0] == "--help" || args[0] == "help") {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(exitOK)
+	}
 
-	err := baseledger.Start()
-	if err != nil {
-		panic(err)
+	if len(args) > 0 && args[0][0] != '-' {
+		name = args[0]
+		args = args[1:]
+	}
+
+	run, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command: %s\n\n%s", name, usage)
+		os.Exit(exitUsage)
 	}
 
-	timer := time.NewTicker(runloopTickInterval)
-	defer timer.Stop()
-
-	for !shuttingDown() {
-		select {
-		case <-timer.C:
-			// no-op for now...
-		case sig := <-sigs:
-			common.Log.Debugf("received signal: %s", sig)
-			baseledger.Stop()
-			shutdown()
-		case <-shutdownCtx.Done():
-			close(sigs)
-		default:
-			time.Sleep(runloopSleepInterval)
+	err := run(args)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(exitOK)
+		}
+
+		fmt.Fprintf(os.Stderr, "node %s: %s\n", name, err.Error())
+		var cfgErr *common.ConfigError
+		if errors.Is(err, errUsage) || errors.As(err, &cfgErr) {
+			os.Exit(exitUsage)
 		}
+		os.Exit(exitError)
+	}
+}
+
+// configFlags are the flags shared by commands which load the node config
+type configFlags struct {
+	config   *string
+	home     *string
+	chainID  *string
+	mode     *string
+	settings settingFlags
+}
+
+// settingFlags collect repeated -set key=value flags
+type settingFlags map[string]string
+
+func (f settingFlags) String() string {
+	return ""
+}
+
+func (f settingFlags) Set(val string) error {
+	parts := strings.SplitN(val, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return fmt.Errorf("expected key=value; got %q", val)
 	}
 
-	common.Log.Debug("exiting baseledger node")
-	cancelF()
+	f[parts[0]] = parts[1]
+	return nil
 }
 
-func installSignalHandlers() {
-	common.Log.Debug("installing signal handlers for baseledger node")
-	sigs = make(chan os.Signal, 1)
-	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGKILL)
-	shutdownCtx, cancelF = context.WithCancel(context.Background())
+func flagSet(name string) (*flag.FlagSet, *configFlags) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	config := &configFlags{
+		config:   flags.String("config", "", "path to a JSON config file; overrides BASELEDGER_CONFIG"),
+		home:     flags.String("home", "", "root directory of the node; overrides BASELEDGER_HOME"),
+		chainID:  flags.String("chain-id", "", "chain id; overrides BASELEDGER_CHAIN_ID"),
+		mode:     flags.String("mode", "", "node mode (full, validator or seed); overrides BASELEDGER_MODE"),
+		settings: settingFlags{},
+	}
+	flags.Var(config.settings, "set", "override a setting by config file key, e.g. -set log_level=debug; may be repeated")
+	return flags, config
 }
 
-func shutdown() {
-	if atomic.AddUint32(&closing, 1) == 1 {
-		common.Log.Debug("shutting down baseledger node")
-		cancelF()
+// parse the given args and load the node config
+func (c *configFlags) parse(flags *flag.FlagSet, args []string) (*common.Config, error) {
+	err := flags.Parse(args)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w; %s", errUsage, err.Error())
+	}
+
+	if flags.NArg() > 0 {
+		return nil, fmt.Errorf("%w; unexpected arguments: %v", errUsage, flags.Args())
+	}
+
+	overrides := map[string]string{}
+	for key, val := range c.settings {
+		overrides[key] = val
+	}
+
+	if *c.config != "" {
+		overrides[common.ConfigFileEnv] = *c.config
 	}
+
+	if *c.home != "" {
+		overrides["home"] = *c.home
+	}
+
+	if *c.chainID != "" {
+		overrides["chain_id"] = *c.chainID
+	}
+
+	if *c.mode != "" {
+		overrides["mode"] = *c.mode
+	}
+
+	cfg, err := common.ConfigFactory(overrides)
+	if err != nil {
+		var cfgErr *common.ConfigError
+		if errors.As(err, &cfgErr) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to load configuration; %s", err.Error())
+	}
+
+	return cfg, nil
 }
 
-func shuttingDown() bool {
-	return (atomic.LoadUint32(&closing) > 0)
+// lockRootDir locks the root directory of the node for the remainder of the
+// command, so that no other process can use it concurrently
+func lockRootDir(cfg *common.Config) (*common.DirLock, error) {
+	lock, err := common.LockRootDir(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	common.Log.Debugf("locked root directory %s", cfg.RootDir)
+	return lock, nil
 }
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/providenetwork/baseledger/consensus"
+)
+
+// reset removes the blockchain data and application state of the node, which
+// must then sync the chain again; the node must not be running
+func reset(args []string) error {
+	flags, config := flagSet("reset")
+	confirm := flags.Bool("unsafe", false, "confirm removal of the blockchain data and application state")
+	cfg, err := config.parse(flags, args)
+	if err != nil {
+		return err
+	}
+
+	if !*confirm {
+		return fmt.Errorf("%w; reset removes all blockchain data and application state in %s; pass -unsafe to confirm", errUsage, cfg.RootDir)
+	}
+
+	lock, err := lockRootDir(cfg)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	err = consensus.ResetNode(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to reset node; %s", err.Error())
+	}
+
+	fmt.Printf("removed blockchain data and application state in %s\n", cfg.RootDir)
+	return nil
+}
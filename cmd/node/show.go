@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/providenetwork/baseledger/consensus"
+	"github.com/providenetwork/tendermint/crypto"
+	tmjson "github.com/providenetwork/tendermint/libs/json"
+)
+
+// showNodeID prints the p2p node id
+func showNodeID(args []string) error {
+	flags, config := flagSet("show-node-id")
+	cfg, err := config.parse(flags, args)
+	if err != nil {
+		return err
+	}
+
+	nodeKey, err := consensus.NodeKey(cfg)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(nodeKey.ID())
+	return nil
+}
+
+// showValidator prints the validator public key and address
+func showValidator(args []string) error {
+	flags, config := flagSet("show-validator")
+	cfg, err := config.parse(flags, args)
+	if err != nil {
+		return err
+	}
+
+	pubkey, err := consensus.ValidatorPubKey(cfg)
+	if err != nil {
+		return err
+	}
+
+	// tmjson cannot encode the unregistered address type in a map
+	raw, err := tmjson.MarshalIndent(struct {
+		Address crypto.Address `json:"address"`
+		PubKey  crypto.PubKey  `json:"pub_key"`
+	}{
+		Address: pubkey.Address(),
+		PubKey:  pubkey,
+	}, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(raw))
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/providenetwork/baseledger/common"
+	"github.com/providenetwork/baseledger/consensus"
+)
+
+const runloopSleepInterval = 250 * time.Millisecond
+const runloopTickInterval = 5000 * time.Millisecond
+
+var (
+	cancelF     context.CancelFunc
+	closing     uint32
+	shutdownCtx context.Context
+	sigs        chan os.Signal
+
+	baseledger *consensus.Tendermint
+)
+
+// start the node and run until it is signaled to stop or halts
+func start(args []string) error {
+	flags, config := flagSet("start")
+	cfg, err := config.parse(flags, args)
+	if err != nil {
+		return err
+	}
+
+	lock, err := lockRootDir(cfg)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	baseledger, err = consensus.TendermintFactory(cfg)
+	if err != nil {
+		return err
+	}
+
+	common.Log.Debugf("starting baseledger node")
+	installSignalHandlers()
+
+	err = baseledger.Start()
+	if err != nil {
+		return err
+	}
+
+	timer := time.NewTicker(runloopTickInterval)
+	defer timer.Stop()
+
+	for !shuttingDown() {
+		select {
+		case <-timer.C:
+			// no-op for now...
+		case sig := <-sigs:
+			common.Log.Debugf("received signal: %s", sig)
+			baseledger.Stop()
+			shutdown()
+		case reason := <-baseledger.Halted():
+			common.Log.Infof("halting baseledger node; %s", reason)
+			baseledger.Stop()
+			shutdown()
+		case <-shutdownCtx.Done():
+			close(sigs)
+		default:
+			time.Sleep(runloopSleepInterval)
+		}
+	}
+
+	common.Log.Debug("exiting baseledger node")
+	cancelF()
+	return nil
+}
+
+func installSignalHandlers() {
+	common.Log.Debug("installing signal handlers for baseledger node")
+	sigs = make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGKILL)
+	shutdownCtx, cancelF = context.WithCancel(context.Background())
+}
+
+func shutdown() {
+	if atomic.AddUint32(&closing, 1) == 1 {
+		common.Log.Debug("shutting down baseledger node")
+		cancelF()
+	}
+}
+
+func shuttingDown() bool {
+	return (atomic.LoadUint32(&closing) > 0)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	tmjson "github.com/providenetwork/tendermint/libs/json"
+	rpchttp "github.com/providenetwork/tendermint/rpc/client/http"
+)
+
+const statusTimeout = 10 * time.Second
+
+// status prints the status of a running node, as reported by its rpc server
+func status(args []string) error {
+	flags, config := flagSet("status")
+	remote := flags.String("node", "", "rpc address of the node; defaults to the configured rpc listen address")
+	cfg, err := config.parse(flags, args)
+	if err != nil {
+		return err
+	}
+
+	if *remote == "" {
+		*remote = strings.Replace(cfg.RPC.ListenAddress, "0.0.0.0", "127.0.0.1", 1)
+	}
+
+	client, err := rpchttp.New(*remote, "/websocket")
+	if err != nil {
+		return fmt.Errorf("failed to initialize rpc client for %s; %s", *remote, err.Error())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), statusTimeout)
+	defer cancel()
+
+	result, err := client.Status(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to fetch status from %s; %s", *remote, err.Error())
+	}
+
+	raw, err := tmjson.MarshalIndent(result, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(raw))
+	return nil
+}
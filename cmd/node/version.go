@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/providenetwork/baseledger/protocol"
+	tmversion "github.com/providenetwork/tendermint/version"
+)
+
+// printVersion prints the baseledger, app and tendermint versions
+func printVersion(args []string) error {
+	flags, _ := flagSet("version")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("baseledger: %s\n", version)
+	fmt.Printf("app:        %d\n", protocol.AppVersion)
+	fmt.Printf("tendermint: %s\n", tmversion.TMCoreSemVer)
+	fmt.Printf("abci:       %s\n", tmversion.ABCISemVer)
+	fmt.Printf("p2p:        %d\n", tmversion.P2PProtocol)
+	fmt.Printf("block:      %d\n", tmversion.BlockProtocol)
+	return nil
+}
@@ -0,0 +1,148 @@
+package common
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+
+	"github.com/providenetwork/tendermint/p2p/upnp"
+	prvdutil "github.com/provideplatform/provide-go/common"
+)
+
+// peer address discovery strategies, which determine the address advertised
+// to peers for them to dial
+const peerAddressDiscoveryExplicit = "explicit"
+const peerAddressDiscoveryInterface = "interface"
+const peerAddressDiscoveryNone = "none"
+const peerAddressDiscoveryPublic = "public"
+const peerAddressDiscoveryUPnP = "upnp"
+
+const upnpPortMappingDescription = "baseledger"
+
+// DiscoverPeerAddress resolves the address advertised to peers using the
+// configured discovery strategy; this may query the network, so it is only
+// done when the node starts rather than when the config is loaded. When the
+// public strategy is not configured explicitly and the public ip cannot be
+// resolved, e.g. on an air-gapped network, no address is advertised and
+// peers dial the address they observe instead
+func (c *Config) DiscoverPeerAddress() error {
+	if c.PeerAddressDiscovery == peerAddressDiscoveryExplicit {
+		Log.Debugf("advertising configured peer address %s", c.P2P.ExternalAddress)
+		return nil
+	}
+
+	port, err := listenPort(c.P2P.ListenAddress)
+	if err != nil {
+		return err
+	}
+
+	var ip string
+
+	switch c.PeerAddressDiscovery {
+	case peerAddressDiscoveryInterface:
+		ip, err = interfaceIP(*c.PeerBroadcastInterface)
+	case peerAddressDiscoveryPublic:
+		ip, err = publicIP()
+		if err != nil && !c.peerAddressDiscoveryConfigured {
+			Log.Warningf("not advertising a peer address; %s; set BASELEDGER_PEER_ADDRESS_DISCOVERY to silence this warning", err.Error())
+			return nil
+		}
+	case peerAddressDiscoveryUPnP:
+		ip, err = upnpIP(port)
+	case peerAddressDiscoveryNone:
+		Log.Debugf("not advertising a peer address")
+		return nil
+	default:
+		err = fmt.Errorf("unsupported peer address discovery strategy: %s", c.PeerAddressDiscovery)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to discover peer address using %s discovery; %s", c.PeerAddressDiscovery, err.Error())
+	}
+
+	c.P2P.ExternalAddress = net.JoinHostPort(ip, strconv.Itoa(port))
+	Log.Debugf("advertising peer address %s discovered using %s discovery", c.P2P.ExternalAddress, c.PeerAddressDiscovery)
+	return nil
+}
+
+// listenPort returns the port of the given tcp://host:port listen address
+func listenPort(listenAddress string) (int, error) {
+	u, err := url.Parse(listenAddress)
+	if err != nil {
+		return 0, fmt.Errorf("invalid listen address %s; %s", listenAddress, err.Error())
+	}
+
+	_, port, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		return 0, fmt.Errorf("invalid listen address %s; %s", listenAddress, err.Error())
+	}
+
+	return strconv.Atoi(port)
+}
+
+// interfaceIP returns the first global unicast address of the named network
+// interface, preferring IPv4
+func interfaceIP(name string) (string, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return "", fmt.Errorf("failed to find network interface %s; %s", name, err.Error())
+	}
+
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return "", fmt.Errorf("failed to list addresses of network interface %s; %s", name, err.Error())
+	}
+
+	var ipv6 net.IP
+	for _, addr := range addrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok || !ipnet.IP.IsGlobalUnicast() {
+			continue
+		}
+
+		if ipnet.IP.To4() != nil {
+			return ipnet.IP.String(), nil
+		}
+
+		if ipv6 == nil {
+			ipv6 = ipnet.IP
+		}
+	}
+
+	if ipv6 != nil {
+		return ipv6.String(), nil
+	}
+
+	return "", fmt.Errorf("network interface %s has no global unicast address", name)
+}
+
+func publicIP() (string, error) {
+	addr, err := prvdutil.ResolvePublicIP()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve public ip; %s", err.Error())
+	}
+
+	return *addr, nil
+}
+
+// upnpIP forwards the given port on the gateway to this host and returns the
+// external ip of the gateway; the mapping does not expire
+func upnpIP(port int) (string, error) {
+	nat, err := upnp.Discover()
+	if err != nil {
+		return "", fmt.Errorf("failed to discover upnp gateway; %s", err.Error())
+	}
+
+	ip, err := nat.GetExternalAddress()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve external ip of upnp gateway; %s", err.Error())
+	}
+
+	_, err = nat.AddPortMapping("tcp", port, port, upnpPortMappingDescription, 0)
+	if err != nil {
+		return "", fmt.Errorf("failed to forward port %d on upnp gateway; %s", port, err.Error())
+	}
+
+	return ip.String(), nil
+}
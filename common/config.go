@@ -1,27 +1,31 @@
 package common
 
 import (
-	"encoding/json"
 	"fmt"
+	"math"
+	"net"
 	"net/url"
 	"os"
-	"strconv"
+	"path/filepath"
 	"strings"
 	"time"
 
 	uuid "github.com/kthomas/go.uuid"
 	"github.com/providenetwork/tendermint/config"
 	"github.com/provideplatform/provide-go/common"
-	prvdutil "github.com/provideplatform/provide-go/common"
 )
 
 const baseledgerModeFull = "full"
 const baseledgerModeSeed = "seed"
 const baseledgerModeValidator = "validator"
 
+const signerKeystore = "keystore"
+const signerRemote = "remote"
+const signerVault = "vault"
+
 const defaultABCIConnectionType = "embedded"
 const defaultBlockTime = time.Second * 5
-const defaultConfigFilePath = "config.json"
+const defaultConsensusSkipTimeoutCommit = true
 const defaultChainID = "peachtree"
 const defaultFastSync = true
 const defaultFastSyncVersion = "v2"
@@ -30,10 +34,14 @@ const defaultLogFormat = "plain"
 const defaultMode = "full"
 const defaultDBBackend = "goleveldb"
 const defaultGenesisFilePath = "genesis.json"
+const defaultKeystoreFilePath = "validator-keystore.json"
 const defaultGenesisStateURL = "https://s3.amazonaws.com/static.provide.services/capabilities/baseledger-genesis-state.json"
 const defaultMempoolCacheSize = 256
+const defaultMempoolMaxTxBytes = 1048576     // 1 MiB
+const defaultMempoolMaxTxsBytes = 1073741824 // 1 GiB
 const defaultMempoolSize = 1024
 const defaultNetworkName = "Baseledger"
+const defaultP2PAddrBookStrict = false
 const defaultP2PListenAddress = "tcp://0.0.0.0:33333"
 const defaultP2PMaxConnections = uint16(32)
 const defaultP2PMaxPacketMessagePayloadSize = 22020096
@@ -41,10 +49,17 @@ const defaultP2PPersistentPeerMaxDialPeriod = time.Second * 10
 const defaultRPCMaxSubscriptionsPerClient = 32
 const defaultRPCMaxSubscriptionClients = 1024
 const defaultPeerAlias = "prvd"
+const defaultPeerBanDialFailures = 5
+const defaultPeerBanDuration = time.Hour
+const defaultPeerBanMisbehavior = 1
+const defaultPeerBanRejections = 10
+const defaultPeerMisbehaviorBanDuration = time.Hour * 24
 const defaultRPCCORSOrigins = "*"
 const defaultRPCListenAddress = "tcp://0.0.0.0:1337"
 const defaultRPCMaxOpenConnections = 1024
+const defaultSigner = signerVault
 const defaultStakingNetwork = "ropsten"
+const defaultStateRetainHeights = int64(100)
 const defaultTxIndexer = "kv"
 
 // Config is the baseledger configuration
@@ -55,13 +70,55 @@ type Config struct {
 	GenesisURL      *url.URL `json:"genesis_url"`
 	GenesisStateURL *url.URL `json:"genesis_state_url"`
 
+	// GenesisHash pins the expected SHA-256 hash of the genesis document
+	GenesisHash *string `json:"genesis_hash,omitempty"`
+
 	VaultID           *uuid.UUID `json:"vault_id"`
 	VaultKeyID        *uuid.UUID `json:"vault_key_id"`
 	VaultRefreshToken *string    `json:"-"`
 
+	// Signer is the backend holding the validator key: vault, an encrypted
+	// local keystore or a remote signer
+	Signer             string  `json:"signer"`
+	KeystoreFile       string  `json:"keystore_file,omitempty"`
+	KeystorePassphrase *string `json:"-"`
+
 	ProvideRefreshToken    *string `json:"-"`
 	StakingContractAddress *string `json:"staking_contract_address"`
 	StakingNetwork         *string `json:"staking_network"`
+
+	PeerPolicyPath     *string `json:"peer_policy_path"`
+	StateRetainHeights int64   `json:"state_retain_heights"`
+
+	// HaltHeight and HaltTime stop the node once a block at or beyond the
+	// given height or time has been committed
+	HaltHeight int64      `json:"halt_height,omitempty"`
+	HaltTime   *time.Time `json:"halt_time,omitempty"`
+
+	// peer reputation; a zero threshold disables banning for the event type
+	PeerBanDialFailures        int           `json:"peer_ban_dial_failures"`
+	PeerBanRejections          int           `json:"peer_ban_rejections"`
+	PeerBanMisbehavior         int           `json:"peer_ban_misbehavior"`
+	PeerBanDuration            time.Duration `json:"peer_ban_duration"`
+	PeerMisbehaviorBanDuration time.Duration `json:"peer_misbehavior_ban_duration"`
+
+	// PeerAddressDiscovery is the strategy used to discover the address
+	// advertised to peers; see DiscoverPeerAddress
+	PeerAddressDiscovery   string  `json:"peer_address_discovery"`
+	PeerBroadcastInterface *string `json:"peer_broadcast_interface,omitempty"`
+
+	// peerAddressDiscoveryConfigured is true unless the discovery strategy
+	// is the default
+	peerAddressDiscoveryConfigured bool
+
+	// settings are the effective settings, keyed by config file key
+	settings map[string]string
+}
+
+// Settings returns the effective settings, keyed by config file key and with
+// secrets omitted; these may be written out and loaded as a config file
+func (c *Config) Settings() map[string]string {
+	return c.settings
 }
 
 func (c *Config) IsFullNode() bool {
@@ -76,251 +133,348 @@ func (c *Config) IsSeedNode() bool {
 	return strings.ToLower(c.Mode) == baseledgerModeSeed
 }
 
-func ConfigFactory() (*Config, error) {
-	chainID := defaultChainID
-	if os.Getenv("BASELEDGER_CHAIN_ID") != "" {
-		chainID = os.Getenv("BASELEDGER_CHAIN_ID")
-	}
+func (c *Config) UsesKeystoreSigner() bool {
+	return c.Signer == signerKeystore
+}
 
-	var genesisURL *url.URL
-	if os.Getenv("BASELEDGER_GENESIS_URL") != "" {
-		_url, err := url.Parse(os.Getenv("BASELEDGER_GENESIS_URL"))
-		if err != nil {
-			panic(err)
-		}
-		genesisURL = _url
-	}
+func (c *Config) UsesRemoteSigner() bool {
+	return c.Signer == signerRemote
+}
+
+func (c *Config) UsesVaultSigner() bool {
+	return c.Signer == signerVault
+}
+
+// ConfigFactory loads the configuration from the config file named by
+// BASELEDGER_CONFIG, if any, then applies the environment and finally the
+// given overrides, which are keyed by config file key or environment
+// variable; the whole configuration is validated and every problem found is
+// reported in a single ConfigError
+func ConfigFactory(overrides map[string]string) (*Config, error) {
+	src := configSourceFactory(overrides)
+
+	chainID := src.string("BASELEDGER_CHAIN_ID", defaultChainID)
 
-	genesisStateURL, _ := url.Parse(defaultGenesisStateURL)
-	if os.Getenv("BASELEDGER_GENESIS_STATE_URL") != "" {
-		stateURL, err := url.Parse(os.Getenv("BASELEDGER_GENESIS_STATE_URL"))
+	// the root directory defaults to $HOME/.baseledger/<chain id>
+	home := src.string("BASELEDGER_HOME", "")
+	if home != "" {
+		absHome, err := filepath.Abs(home)
 		if err != nil {
-			panic(err)
+			src.errorf("BASELEDGER_HOME must be a valid path; got %q", home)
 		}
-		genesisStateURL = stateURL
+		home = absHome
 	}
+	genesisURL := src.url("BASELEDGER_GENESIS_URL", "")
+	genesisStateURL := src.url("BASELEDGER_GENESIS_STATE_URL", defaultGenesisStateURL)
 
-	mode := defaultMode
-	if os.Getenv("BASELEDGER_MODE") != "" {
-		mode = os.Getenv("BASELEDGER_MODE")
+	genesisHash := src.stringOrNil("BASELEDGER_GENESIS_HASH")
+	if genesisHash != nil && !genesisHashPattern.MatchString(*genesisHash) {
+		src.errorf("BASELEDGER_GENESIS_HASH must be a hex-encoded SHA-256 hash; got %q", *genesisHash)
 	}
 
-	networkName := defaultNetworkName
-	if os.Getenv("BASELEDGER_NETWORK_NAME") != "" {
-		networkName = os.Getenv("BASELEDGER_NETWORK_NAME")
-	}
+	mode := src.string("BASELEDGER_MODE", defaultMode)
+	src.oneOf("BASELEDGER_MODE", mode, baseledgerModeFull, baseledgerModeValidator, baseledgerModeSeed)
+
+	networkName := src.string("BASELEDGER_NETWORK_NAME", defaultNetworkName)
+	stakingContractAddress := src.stringOrNil("BASELEDGER_STAKING_CONTRACT_ADDRESS")
+	stakingNetwork := src.string("BASELEDGER_STAKING_NETWORK", defaultStakingNetwork)
 
-	var stakingContractAddress *string
-	if os.Getenv("BASELEDGER_STAKING_CONTRACT_ADDRESS") != "" {
-		stakingContractAddress = common.StringOrNil(os.Getenv("BASELEDGER_STAKING_CONTRACT_ADDRESS"))
+	stateRetainHeights := src.int64("BASELEDGER_STATE_RETAIN_HEIGHTS", defaultStateRetainHeights)
+	if stateRetainHeights < 0 {
+		src.errorf("BASELEDGER_STATE_RETAIN_HEIGHTS must not be negative; got %d", stateRetainHeights)
 	}
 
-	stakingNetwork := defaultStakingNetwork
-	if os.Getenv("BASELEDGER_STAKING_NETWORK") != "" {
-		stakingNetwork = os.Getenv("BASELEDGER_STAKING_NETWORK")
+	haltHeight := src.int64("BASELEDGER_HALT_HEIGHT", 0)
+	if haltHeight < 0 {
+		src.errorf("BASELEDGER_HALT_HEIGHT must not be negative; got %d", haltHeight)
 	}
+	haltTime := src.time("BASELEDGER_HALT_TIME")
+
+	logLevel := src.string("BASELEDGER_LOG_LEVEL", defaultLogLevel)
 
-	logLevel := defaultLogLevel
-	if os.Getenv("BASELEDGER_LOG_LEVEL") != "" {
-		logLevel = os.Getenv("BASELEDGER_LOG_LEVEL")
+	logFormat := src.string("BASELEDGER_LOG_FORMAT", defaultLogFormat)
+	src.oneOf("BASELEDGER_LOG_FORMAT", logFormat, "plain", "json")
+
+	dbBackend := src.string("BASELEDGER_DB_BACKEND", defaultDBBackend)
+	src.oneOf("BASELEDGER_DB_BACKEND", dbBackend, "goleveldb", "cleveldb", "boltdb", "rocksdb", "badgerdb")
+
+	fastSync := src.bool("BASELEDGER_FAST_SYNC", defaultFastSync)
+
+	fastSyncVersion := src.string("BASELEDGER_FAST_SYNC_VERSION", defaultFastSyncVersion)
+	src.oneOf("BASELEDGER_FAST_SYNC_VERSION", fastSyncVersion, "v0", "v1", "v2")
+
+	txIndexer := src.string("BASELEDGER_TX_INDEXER", defaultTxIndexer)
+	src.oneOf("BASELEDGER_TX_INDEXER", txIndexer, "kv", "null")
+
+	abciConnectionType := src.string("BASELEDGER_ABCI_CONNECTION_TYPE", defaultABCIConnectionType)
+	src.oneOf("BASELEDGER_ABCI_CONNECTION_TYPE", abciConnectionType, defaultABCIConnectionType, "socket", "grpc")
+
+	filterPeers := src.bool("BASELEDGER_FILTER_PEERS", defaultFilterPeers)
+
+	blockTime := src.duration("BASELEDGER_BLOCK_TIME", defaultBlockTime)
+	if blockTime <= 0 {
+		src.errorf("BASELEDGER_BLOCK_TIME must be positive; got %s", blockTime)
 	}
 
-	logFormat := defaultLogFormat
-	if os.Getenv("BASELEDGER_LOG_FORMAT") != "" {
-		logFormat = os.Getenv("BASELEDGER_LOG_FORMAT")
+	// the propose, prevote and precommit timeouts default to the block time
+	consensusTimeoutPropose := src.duration("BASELEDGER_CONSENSUS_TIMEOUT_PROPOSE", blockTime)
+	consensusTimeoutPrevote := src.duration("BASELEDGER_CONSENSUS_TIMEOUT_PREVOTE", blockTime)
+	consensusTimeoutPrecommit := src.duration("BASELEDGER_CONSENSUS_TIMEOUT_PRECOMMIT", blockTime)
+	for name, val := range map[string]time.Duration{
+		"BASELEDGER_CONSENSUS_TIMEOUT_PROPOSE":   consensusTimeoutPropose,
+		"BASELEDGER_CONSENSUS_TIMEOUT_PREVOTE":   consensusTimeoutPrevote,
+		"BASELEDGER_CONSENSUS_TIMEOUT_PRECOMMIT": consensusTimeoutPrecommit,
+	} {
+		if val <= 0 {
+			src.errorf("%s must be positive; got %s", name, val)
+		}
 	}
 
-	dbBackend := defaultDBBackend
-	if os.Getenv("BASELEDGER_DB_BACKEND") != "" {
-		dbBackend = os.Getenv("BASELEDGER_DB_BACKEND")
+	consensusTimeoutProposeDelta := src.duration("BASELEDGER_CONSENSUS_TIMEOUT_PROPOSE_DELTA", 0)
+	consensusTimeoutPrevoteDelta := src.duration("BASELEDGER_CONSENSUS_TIMEOUT_PREVOTE_DELTA", 0)
+	consensusTimeoutPrecommitDelta := src.duration("BASELEDGER_CONSENSUS_TIMEOUT_PRECOMMIT_DELTA", 0)
+	consensusTimeoutCommit := src.duration("BASELEDGER_CONSENSUS_TIMEOUT_COMMIT", 0)
+	for name, val := range map[string]time.Duration{
+		"BASELEDGER_CONSENSUS_TIMEOUT_PROPOSE_DELTA":   consensusTimeoutProposeDelta,
+		"BASELEDGER_CONSENSUS_TIMEOUT_PREVOTE_DELTA":   consensusTimeoutPrevoteDelta,
+		"BASELEDGER_CONSENSUS_TIMEOUT_PRECOMMIT_DELTA": consensusTimeoutPrecommitDelta,
+		"BASELEDGER_CONSENSUS_TIMEOUT_COMMIT":          consensusTimeoutCommit,
+	} {
+		if val < 0 {
+			src.errorf("%s must not be negative; got %s", name, val)
+		}
 	}
 
-	fastSync := defaultFastSync
-	if os.Getenv("BASELEDGER_FAST_SYNC") != "" {
-		fastSync = os.Getenv("BASELEDGER_FAST_SYNC") == "true"
+	consensusSkipTimeoutCommit := src.bool("BASELEDGER_CONSENSUS_SKIP_TIMEOUT_COMMIT", defaultConsensusSkipTimeoutCommit)
+
+	// a validator refuses to start if it signed any of this many latest
+	// blocks; zero disables the check, which must be the case for a
+	// validator which is simply restarted
+	doubleSignCheckHeight := src.int64("BASELEDGER_DOUBLE_SIGN_CHECK_HEIGHT", 0)
+	if doubleSignCheckHeight < 0 {
+		src.errorf("BASELEDGER_DOUBLE_SIGN_CHECK_HEIGHT must not be negative; got %d", doubleSignCheckHeight)
 	}
 
-	fastSyncVersion := defaultFastSyncVersion
-	if os.Getenv("BASELEDGER_FAST_SYNC_VERSION") != "" {
-		fastSyncVersion = os.Getenv("BASELEDGER_FAST_SYNC_VERSION")
+	mempoolSize := src.int("BASELEDGER_MEMPOOL_SIZE", defaultMempoolSize)
+	if mempoolSize <= 0 {
+		src.errorf("BASELEDGER_MEMPOOL_SIZE must be positive; got %d", mempoolSize)
 	}
 
-	txIndexer := defaultTxIndexer
-	if os.Getenv("BASELEDGER_TX_INDEXER") != "" {
-		txIndexer = os.Getenv("BASELEDGER_TX_INDEXER")
+	mempoolCacheSize := src.int("BASELEDGER_MEMPOOL_CACHE_SIZE", defaultMempoolCacheSize)
+	if mempoolCacheSize < 0 {
+		src.errorf("BASELEDGER_MEMPOOL_CACHE_SIZE must not be negative; got %d", mempoolCacheSize)
 	}
 
-	abciConnectionType := defaultABCIConnectionType
-	if os.Getenv("BASELEDGER_ABCI_CONNECTION_TYPE") != "" {
-		abciConnectionType = os.Getenv("BASELEDGER_ABCI_CONNECTION_TYPE")
+	mempoolMaxTxBytes := src.int("BASELEDGER_MEMPOOL_MAX_TX_BYTES", defaultMempoolMaxTxBytes)
+	if mempoolMaxTxBytes <= 0 {
+		src.errorf("BASELEDGER_MEMPOOL_MAX_TX_BYTES must be positive; got %d", mempoolMaxTxBytes)
 	}
 
-	filterPeers := defaultFilterPeers
-	if os.Getenv("BASELEDGER_FILTER_PEERS") != "" {
-		filterPeers = os.Getenv("BASELEDGER_FILTER_PEERS") == "true"
+	mempoolMaxTxsBytes := src.int64("BASELEDGER_MEMPOOL_MAX_TXS_BYTES", defaultMempoolMaxTxsBytes)
+	if mempoolMaxTxsBytes < int64(mempoolMaxTxBytes) {
+		src.errorf("BASELEDGER_MEMPOOL_MAX_TXS_BYTES must be at least BASELEDGER_MEMPOOL_MAX_TX_BYTES (%d); got %d", mempoolMaxTxBytes, mempoolMaxTxsBytes)
 	}
 
-	blockTime := defaultBlockTime
-	if os.Getenv("BASELEDGER_BLOCK_TIME") != "" {
-		time, err := time.ParseDuration(os.Getenv("BASELEDGER_BLOCK_TIME"))
-		if err != nil {
-			panic(err)
-		}
-		blockTime = time
+	rpcListenAddress := src.string("BASELEDGER_RPC_LISTEN_ADDRESS", defaultRPCListenAddress)
+	src.listenAddress("BASELEDGER_RPC_LISTEN_ADDRESS", rpcListenAddress)
+
+	// relative tls paths are relative to the root directory
+	rpcTLSCertFile := src.string("BASELEDGER_RPC_TLS_CERT_FILE", "")
+	rpcTLSKeyFile := src.string("BASELEDGER_RPC_TLS_KEY_FILE", "")
+	if (rpcTLSCertFile == "") != (rpcTLSKeyFile == "") {
+		src.errorf("BASELEDGER_RPC_TLS_CERT_FILE and BASELEDGER_RPC_TLS_KEY_FILE must be set together")
 	}
 
-	mempoolSize := defaultMempoolSize
-	if os.Getenv("BASELEDGER_MEMPOOL_SIZE") != "" {
-		size, err := strconv.ParseInt(os.Getenv("BASELEDGER_MEMPOOL_SIZE"), 10, 64)
+	rpcPprofListenAddress := src.string("BASELEDGER_RPC_PPROF_LISTEN_ADDRESS", "")
+	if rpcPprofListenAddress != "" {
+		_, _, err := net.SplitHostPort(rpcPprofListenAddress)
 		if err != nil {
-			panic(err)
+			src.errorf("BASELEDGER_RPC_PPROF_LISTEN_ADDRESS must be a host:port address, e.g. localhost:6060; got %q", rpcPprofListenAddress)
 		}
-		mempoolSize = int(size)
 	}
 
-	mempoolCacheSize := defaultMempoolCacheSize
-	if os.Getenv("BASELEDGER_MEMPOOL_CACHE_SIZE") != "" {
-		size, err := strconv.ParseInt(os.Getenv("BASELEDGER_MEMPOOL_CACHE_SIZE"), 10, 64)
-		if err != nil {
-			panic(err)
+	rpcCORSOrigins := strings.Split(src.string("BASELEDGER_RPC_CORS_ORIGINS", defaultRPCCORSOrigins), ",")
+
+	rpcMaxOpenConnections := src.int("BASELEDGER_RPC_MAX_OPEN_CONNECTIONS", defaultRPCMaxOpenConnections)
+	rpcMaxSubscriptionClients := src.int("BASELEDGER_RPC_MAX_SUBSCRIPTION_CLIENTS", defaultRPCMaxSubscriptionClients)
+	rpcMaxSubscriptionsPerClient := src.int("BASELEDGER_RPC_MAX_CLIENT_SUBSCRIPTIONS", defaultRPCMaxSubscriptionsPerClient)
+	for name, val := range map[string]int{
+		"BASELEDGER_RPC_MAX_OPEN_CONNECTIONS":     rpcMaxOpenConnections,
+		"BASELEDGER_RPC_MAX_SUBSCRIPTION_CLIENTS": rpcMaxSubscriptionClients,
+		"BASELEDGER_RPC_MAX_CLIENT_SUBSCRIPTIONS": rpcMaxSubscriptionsPerClient,
+	} {
+		if val < 0 {
+			src.errorf("%s must not be negative; got %d", name, val)
 		}
-		mempoolCacheSize = int(size)
 	}
 
-	rpcListenAddress := defaultRPCListenAddress
-	if os.Getenv("BASELEDGER_RPC_LISTEN_ADDRESS") != "" {
-		rpcListenAddress = os.Getenv("BASELEDGER_RPC_LISTEN_ADDRESS")
-	}
+	peerAlias := src.string("BASELEDGER_PEER_ALIAS", defaultPeerAlias)
+
+	p2pListenAddress := src.string("BASELEDGER_P2P_LISTEN_ADDRESS", defaultP2PListenAddress)
+	src.listenAddress("BASELEDGER_P2P_LISTEN_ADDRESS", p2pListenAddress)
 
-	rpcCORSOrigins := strings.Split(defaultRPCCORSOrigins, ",")
-	if os.Getenv("BASELEDGER_RPC_CORS_ORIGINS") != "" {
-		rpcCORSOrigins = strings.Split(os.Getenv("BASELEDGER_RPC_CORS_ORIGINS"), ",")
+	p2pMaxConnections := src.int64("BASELEDGER_P2P_MAX_CONNECTIONS", int64(defaultP2PMaxConnections))
+	if p2pMaxConnections <= 0 || p2pMaxConnections > math.MaxUint16 {
+		src.errorf("BASELEDGER_P2P_MAX_CONNECTIONS must be between 1 and %d; got %d", math.MaxUint16, p2pMaxConnections)
 	}
 
-	rpcMaxOpenConnections := defaultRPCMaxOpenConnections
-	if os.Getenv("BASELEDGER_RPC_MAX_OPEN_CONNECTIONS") != "" {
-		maxConnections, err := strconv.ParseInt(os.Getenv("BASELEDGER_RPC_MAX_OPEN_CONNECTIONS"), 10, 64)
-		if err != nil {
-			panic(err)
-		}
-		rpcMaxOpenConnections = int(maxConnections)
+	p2pPersistentPeerMaxDialPeriod := src.duration("BASELEDGER_P2P_PERSISTENT_PEER_MAX_DIAL_PERIOD", defaultP2PPersistentPeerMaxDialPeriod)
+
+	p2pMaxPacketMessagePayloadSize := src.int("BASELEDGER_P2P_MAX_PACKET_MESSAGE_PAYLOAD_SIZE", defaultP2PMaxPacketMessagePayloadSize)
+	if p2pMaxPacketMessagePayloadSize <= 0 {
+		src.errorf("BASELEDGER_P2P_MAX_PACKET_MESSAGE_PAYLOAD_SIZE must be positive; got %d", p2pMaxPacketMessagePayloadSize)
 	}
 
-	rpcMaxSubscriptionClients := defaultRPCMaxSubscriptionClients
-	if os.Getenv("BASELEDGER_RPC_MAX_SUBSCRIPTION_CLIENTS") != "" {
-		maxClients, err := strconv.ParseInt(os.Getenv("BASELEDGER_RPC_MAX_SUBSCRIPTION_CLIENTS"), 10, 64)
-		if err != nil {
-			panic(err)
+	// zero send and receive rates are unlimited
+	p2pSendRate := src.int64("BASELEDGER_P2P_SEND_RATE", 0)
+	p2pRecvRate := src.int64("BASELEDGER_P2P_RECV_RATE", 0)
+	for name, val := range map[string]int64{
+		"BASELEDGER_P2P_SEND_RATE": p2pSendRate,
+		"BASELEDGER_P2P_RECV_RATE": p2pRecvRate,
+	} {
+		if val < 0 {
+			src.errorf("%s must not be negative; got %d", name, val)
 		}
-		rpcMaxSubscriptionClients = int(maxClients)
 	}
 
-	rpcMaxSubscriptionsPerClient := defaultRPCMaxSubscriptionsPerClient
-	if os.Getenv("BASELEDGER_RPC_MAX_CLIENT_SUBSCRIPTIONS") != "" {
-		maxSubscriptions, err := strconv.ParseInt(os.Getenv("BASELEDGER_RPC_MAX_CLIENT_SUBSCRIPTIONS"), 10, 64)
-		if err != nil {
-			panic(err)
+	p2pAddrBookStrict := src.bool("BASELEDGER_P2P_ADDR_BOOK_STRICT", defaultP2PAddrBookStrict)
+
+	peerPolicyPath := src.stringOrNil("BASELEDGER_PEER_POLICY")
+
+	peerBanDialFailures := src.int("BASELEDGER_PEER_BAN_DIAL_FAILURES", defaultPeerBanDialFailures)
+	peerBanRejections := src.int("BASELEDGER_PEER_BAN_REJECTIONS", defaultPeerBanRejections)
+	peerBanMisbehavior := src.int("BASELEDGER_PEER_BAN_MISBEHAVIOR", defaultPeerBanMisbehavior)
+	for name, val := range map[string]int{
+		"BASELEDGER_PEER_BAN_DIAL_FAILURES": peerBanDialFailures,
+		"BASELEDGER_PEER_BAN_REJECTIONS":    peerBanRejections,
+		"BASELEDGER_PEER_BAN_MISBEHAVIOR":   peerBanMisbehavior,
+	} {
+		if val < 0 {
+			src.errorf("%s must not be negative; got %d", name, val)
 		}
-		rpcMaxSubscriptionsPerClient = int(maxSubscriptions)
 	}
 
-	peerAlias := defaultPeerAlias
-	if os.Getenv("BASELEDGER_PEER_ALIAS") != "" {
-		peerAlias = os.Getenv("BASELEDGER_PEER_ALIAS")
+	peerBanDuration := src.duration("BASELEDGER_PEER_BAN_DURATION", defaultPeerBanDuration)
+	peerMisbehaviorBanDuration := src.duration("BASELEDGER_PEER_MISBEHAVIOR_BAN_DURATION", defaultPeerMisbehaviorBanDuration)
+
+	// p2pBootstrapPeers := src.string("BASELEDGER_BOOTSTRAP_PEERS", "")
+	p2pPersistentPeers := src.string("BASELEDGER_PERSISTENT_PEERS", "")
+	src.peers("BASELEDGER_PERSISTENT_PEERS", p2pPersistentPeers)
+
+	p2pPrivatePeerIDs := src.string("BASELEDGER_PRIVATE_PEER_IDS", "")
+	src.peerIDs("BASELEDGER_PRIVATE_PEER_IDS", p2pPrivatePeerIDs)
+
+	p2pSeedPeers := src.string("BASELEDGER_SEEDS", "")
+	src.peers("BASELEDGER_SEEDS", p2pSeedPeers)
+
+	provideRefreshToken := src.stringOrNil("PROVIDE_REFRESH_TOKEN")
+
+	vaultRefreshToken := src.string("VAULT_REFRESH_TOKEN", "")
+
+	var vaultIDStr string
+	vaultID := src.uuid("VAULT_ID")
+	if vaultID != nil {
+		vaultIDStr = vaultID.String()
 	}
 
-	p2pListenAddress := defaultP2PListenAddress
-	if os.Getenv("BASELEDGER_P2P_LISTEN_ADDRESS") != "" {
-		p2pListenAddress = os.Getenv("BASELEDGER_P2P_LISTEN_ADDRESS")
+	var vaultKeyIDStr string
+	vaultKeyID := src.uuid("VAULT_KEY_ID")
+	if vaultKeyID != nil {
+		vaultKeyIDStr = vaultKeyID.String()
 	}
 
-	p2pMaxConnections := defaultP2PMaxConnections
-	if os.Getenv("BASELEDGER_P2P_MAX_CONNECTIONS") != "" {
-		maxConnections, err := strconv.ParseInt(os.Getenv("BASELEDGER_P2P_MAX_CONNECTIONS"), 10, 16)
-		if err != nil {
-			panic(err)
-		}
-		p2pMaxConnections = uint16(maxConnections)
+	signer := strings.ToLower(src.string("BASELEDGER_SIGNER", defaultSigner))
+	src.oneOf("BASELEDGER_SIGNER", signer, signerVault, signerKeystore, signerRemote)
+
+	requiresSigner := strings.EqualFold(mode, baseledgerModeFull) || strings.EqualFold(mode, baseledgerModeValidator)
+	if requiresSigner && signer == signerVault && (vaultID == nil || vaultRefreshToken == "") {
+		src.errorf("VAULT_ID and VAULT_REFRESH_TOKEN are required in %s mode with the vault signer", mode)
 	}
 
-	p2pPersistentPeerMaxDialPeriod := defaultP2PPersistentPeerMaxDialPeriod
-	if os.Getenv("BASELEDGER_P2P_PERSISTENT_PEER_MAX_DIAL_PERIOD") != "" {
-		duration, err := time.ParseDuration(os.Getenv("BASELEDGER_P2P_PERSISTENT_PEER_MAX_DIAL_PERIOD"))
+	keystoreFile := src.string("BASELEDGER_KEYSTORE_FILE", defaultKeystoreFilePath)
+
+	// the passphrase may be read from a file, e.g. a mounted secret
+	keystorePassphrase := src.stringOrNil("BASELEDGER_KEYSTORE_PASSPHRASE")
+	keystorePassphraseFile := src.string("BASELEDGER_KEYSTORE_PASSPHRASE_FILE", "")
+	if keystorePassphrase != nil && keystorePassphraseFile != "" {
+		src.errorf("BASELEDGER_KEYSTORE_PASSPHRASE and BASELEDGER_KEYSTORE_PASSPHRASE_FILE must not be set together")
+	} else if keystorePassphraseFile != "" {
+		passphrase, err := ReadSecretFile(keystorePassphraseFile)
 		if err != nil {
-			panic(err)
+			src.errorf("failed to read BASELEDGER_KEYSTORE_PASSPHRASE_FILE; %s", err.Error())
+		} else {
+			keystorePassphrase = StringOrNil(passphrase)
 		}
-		p2pPersistentPeerMaxDialPeriod = duration
-	}
-
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		panic(err)
 	}
 
-	rootPath := fmt.Sprintf("%s%s.baseledger%s%s", homeDir, string(os.PathSeparator), string(os.PathSeparator), chainID)
-	err = os.MkdirAll(rootPath, 0700)
-	if err != nil {
-		panic(err)
+	if requiresSigner && signer == signerKeystore && keystorePassphrase == nil {
+		src.errorf("BASELEDGER_KEYSTORE_PASSPHRASE or BASELEDGER_KEYSTORE_PASSPHRASE_FILE is required in %s mode with the keystore signer", mode)
 	}
 
-	p2pBroadcastAddress := os.Getenv("BASELEDGER_PEER_BROADCAST_ADDRESS")
-	if p2pBroadcastAddress == "" {
-		addr, err := prvdutil.ResolvePublicIP()
-		if err != nil {
-			panic(err)
+	// tendermint listens on this address for the remote signer to connect
+	signerListenAddress := src.string("BASELEDGER_SIGNER_LISTEN_ADDRESS", "")
+	if signer == signerRemote {
+		if signerListenAddress == "" {
+			src.errorf("BASELEDGER_SIGNER_LISTEN_ADDRESS is required with the remote signer")
+		} else {
+			src.listenAddress("BASELEDGER_SIGNER_LISTEN_ADDRESS", signerListenAddress)
 		}
-
-		p2pListenAddrParts := strings.Split(p2pListenAddress, ":")
-		p2pListenPort := p2pListenAddrParts[len(p2pListenAddrParts)-1]
-		p2pBroadcastAddress = fmt.Sprintf("%s:%s", *addr, p2pListenPort)
+	} else if signerListenAddress != "" {
+		src.errorf("BASELEDGER_SIGNER_LISTEN_ADDRESS is only used with the remote signer; got the %s signer", signer)
 	}
 
-	p2pMaxPacketMessagePayloadSize := defaultP2PMaxPacketMessagePayloadSize
-	if os.Getenv("BASELEDGER_P2P_MAX_PACKET_MESSAGE_PAYLOAD_SIZE") != "" {
-		size, err := strconv.ParseInt(os.Getenv("BASELEDGER_P2P_MAX_PACKET_MESSAGE_PAYLOAD_SIZE"), 10, 64)
+	p2pBroadcastAddress := src.string("BASELEDGER_PEER_BROADCAST_ADDRESS", "")
+	if p2pBroadcastAddress != "" {
+		_, _, err := net.SplitHostPort(p2pBroadcastAddress)
 		if err != nil {
-			panic(err)
+			src.errorf("BASELEDGER_PEER_BROADCAST_ADDRESS must be a host:port address; got %q", p2pBroadcastAddress)
 		}
-		p2pMaxPacketMessagePayloadSize = int(size)
 	}
 
-	// p2pBootstrapPeers := os.Getenv("BASELEDGER_BOOTSTRAP_PEERS")
-	p2pPersistentPeers := os.Getenv("BASELEDGER_PERSISTENT_PEERS")
-	p2pPrivatePeerIDs := os.Getenv("BASELEDGER_PRIVATE_PEER_IDS")
-	p2pSeedPeers := os.Getenv("BASELEDGER_SEEDS")
+	p2pBroadcastInterface := src.stringOrNil("BASELEDGER_PEER_BROADCAST_INTERFACE")
 
-	var provideRefreshToken *string
-	if os.Getenv("PROVIDE_REFRESH_TOKEN") != "" {
-		provideRefreshToken = common.StringOrNil(os.Getenv("PROVIDE_REFRESH_TOKEN"))
+	// the broadcast address is advertised as configured; otherwise the
+	// public ip is resolved when the node starts
+	defaultPeerAddressDiscovery := peerAddressDiscoveryPublic
+	if p2pBroadcastAddress != "" {
+		defaultPeerAddressDiscovery = peerAddressDiscoveryExplicit
 	}
 
-	var vaultRefreshToken string
-	if os.Getenv("VAULT_REFRESH_TOKEN") != "" {
-		vaultRefreshToken = os.Getenv("VAULT_REFRESH_TOKEN")
+	_, peerAddressDiscoveryConfigured := src.lookup("BASELEDGER_PEER_ADDRESS_DISCOVERY")
+	peerAddressDiscovery := strings.ToLower(src.string("BASELEDGER_PEER_ADDRESS_DISCOVERY", defaultPeerAddressDiscovery))
+	src.oneOf("BASELEDGER_PEER_ADDRESS_DISCOVERY", peerAddressDiscovery,
+		peerAddressDiscoveryExplicit,
+		peerAddressDiscoveryInterface,
+		peerAddressDiscoveryUPnP,
+		peerAddressDiscoveryPublic,
+		peerAddressDiscoveryNone,
+	)
+
+	if peerAddressDiscovery == peerAddressDiscoveryExplicit && p2pBroadcastAddress == "" {
+		src.errorf("BASELEDGER_PEER_BROADCAST_ADDRESS is required with explicit peer address discovery")
+	} else if peerAddressDiscovery != peerAddressDiscoveryExplicit && p2pBroadcastAddress != "" {
+		src.errorf("BASELEDGER_PEER_BROADCAST_ADDRESS is only used with explicit peer address discovery; got %s discovery", peerAddressDiscovery)
 	}
 
-	var vaultID *uuid.UUID
-	var vaultIDStr string
-	if os.Getenv("VAULT_ID") != "" {
-		vaultUUID, err := uuid.FromString(os.Getenv("VAULT_ID"))
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse VAULT_ID as valid uuid; %s", err.Error())
-		}
+	if peerAddressDiscovery == peerAddressDiscoveryInterface && p2pBroadcastInterface == nil {
+		src.errorf("BASELEDGER_PEER_BROADCAST_INTERFACE is required with interface peer address discovery")
+	} else if peerAddressDiscovery != peerAddressDiscoveryInterface && p2pBroadcastInterface != nil {
+		src.errorf("BASELEDGER_PEER_BROADCAST_INTERFACE is only used with interface peer address discovery; got %s discovery", peerAddressDiscovery)
+	}
 
-		vaultID = &vaultUUID
-		vaultIDStr = vaultID.String()
+	err := src.err()
+	if err != nil {
+		return nil, err
 	}
 
-	var vaultKeyID *uuid.UUID
-	var vaultKeyIDStr string
-	if os.Getenv("VAULT_KEY_ID") != "" {
-		keyUUID, err := uuid.FromString(os.Getenv("VAULT_KEY_ID"))
+	rootPath := home
+	if rootPath == "" {
+		homeDir, err := os.UserHomeDir()
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse VAULT_KEY_ID as valid uuid; %s", err.Error())
+			return nil, fmt.Errorf("failed to resolve home directory; set BASELEDGER_HOME; %s", err.Error())
 		}
 
-		vaultKeyID = &keyUUID
-		vaultKeyIDStr = vaultKeyID.String()
+		rootPath = fmt.Sprintf("%s%s.baseledger%s%s", homeDir, string(os.PathSeparator), string(os.PathSeparator), chainID)
 	}
 
 	cfg := &Config{
@@ -352,6 +506,10 @@ func ConfigFactory() (*Config, error) {
 				// Path to the JSON file containing the last sign state of a validator
 				PrivValidatorState: fmt.Sprintf("%s%svalidator-state.json", rootPath, string(os.PathSeparator)),
 
+				// TCP or UNIX socket address for Tendermint to listen on for
+				// connections from an external PrivValidator process
+				PrivValidatorListenAddr: signerListenAddress,
+
 				// A custom human readable name for this node
 				Moniker: peerAlias,
 
@@ -417,30 +575,30 @@ func ConfigFactory() (*Config, error) {
 				WalPath: fmt.Sprintf("%s%swrite-ahead.log", rootPath, string(os.PathSeparator)),
 
 				// How long we wait for a proposal block before prevoting nil
-				TimeoutPropose: blockTime,
+				TimeoutPropose: consensusTimeoutPropose,
 
 				// How much timeout_propose increases with each round
-				// TimeoutProposeDelta time.Duration `mapstructure:"timeout_propose_delta"`
+				TimeoutProposeDelta: consensusTimeoutProposeDelta,
 
 				// How long we wait after receiving +2/3 prevotes for “anything” (ie. not a single block or nil)
-				TimeoutPrevote: blockTime,
+				TimeoutPrevote: consensusTimeoutPrevote,
 
 				// How much the timeout_prevote increases with each round
-				// TimeoutPrevoteDelta time.Duration `mapstructure:"timeout_prevote_delta"`
+				TimeoutPrevoteDelta: consensusTimeoutPrevoteDelta,
 
 				// How long we wait after receiving +2/3 precommits for “anything” (ie. not a single block or nil)
-				TimeoutPrecommit: blockTime,
+				TimeoutPrecommit: consensusTimeoutPrecommit,
 
 				// How much the timeout_precommit increases with each round
-				// TimeoutPrecommitDelta time.Duration `mapstructure:"timeout_precommit_delta"`
+				TimeoutPrecommitDelta: consensusTimeoutPrecommitDelta,
 
 				// How long we wait after committing a block, before starting on the new
 				// height (this gives us a chance to receive some more precommits, even
 				// though we already have +2/3).
-				// TimeoutCommit: time.Millisecond * 25,
+				TimeoutCommit: consensusTimeoutCommit,
 
 				// Make progress as soon as we have all the precommits (as if TimeoutCommit = 0)
-				SkipTimeoutCommit: true,
+				SkipTimeoutCommit: consensusSkipTimeoutCommit,
 
 				// EmptyBlocks mode and possible interval between empty blocks
 				CreateEmptyBlocks:         true,
@@ -450,7 +608,9 @@ func ConfigFactory() (*Config, error) {
 				// PeerGossipSleepDuration     time.Duration `mapstructure:"peer_gossip_sleep_duration"`
 				// PeerQueryMaj23SleepDuration time.Duration `mapstructure:"peer_query_maj23_sleep_duration"`
 
-				// DoubleSignCheckHeight int64 `mapstructure:"double_sign_check_height"`
+				// How many blocks to look back to check the existence of the node's
+				// signature in the last blocks before signing
+				DoubleSignCheckHeight: doubleSignCheckHeight,
 			},
 
 			Instrumentation: &config.InstrumentationConfig{},
@@ -466,7 +626,7 @@ func ConfigFactory() (*Config, error) {
 				// Limit the total size of all txs in the mempool.
 				// This only accounts for raw transactions (e.g. given 1MB transactions and
 				// max-txs-bytes=5MB, mempool will only accept 5 transactions).
-				// MaxTxsBytes int64 `mapstructure:"max-txs-bytes"`
+				MaxTxsBytes: mempoolMaxTxsBytes,
 
 				// Size of the cache (used to filter transactions we saw earlier) in transactions
 				CacheSize: mempoolCacheSize,
@@ -478,13 +638,15 @@ func ConfigFactory() (*Config, error) {
 
 				// Maximum size of a single transaction
 				// NOTE: the max size of a tx transmitted over the network is {max-tx-bytes}.
-				// MaxTxBytes int `mapstructure:"max-tx-bytes"`
+				MaxTxBytes: mempoolMaxTxBytes,
 
 				// Maximum size of a batch of transactions to send to a peer
 				// Including space needed by encoding (one varint per transaction).
 				// XXX: Unused due to https://github.com/providenetwork/tendermint/issues/5796
 				// MaxBatchBytes int `mapstructure:"max-batch-bytes"`
 
+				// NOTE: the mempool ttl is not supported by tendermint v0.34
+				//
 				// TTLDuration, if non-zero, defines the maximum amount of time a transaction
 				// can exist for in the mempool.
 				//
@@ -563,17 +725,17 @@ func ConfigFactory() (*Config, error) {
 				//
 				// NOTE: both tls-cert-file and tls-key-file must be present for Tendermint to create HTTPS server.
 				// Otherwise, HTTP server is run.
-				// TLSCertFile string `mapstructure:"tls-cert-file"`
+				TLSCertFile: rootedPath(rootPath, rpcTLSCertFile),
 
 				// The path to a file containing matching private key that is used to create the HTTPS server.
 				// Might be either absolute path or path related to tendermint's config directory.
 				//
 				// NOTE: both tls-cert-file and tls-key-file must be present for Tendermint to create HTTPS server.
 				// Otherwise, HTTP server is run.
-				// TLSKeyFile string `mapstructure:"tls-key-file"`
+				TLSKeyFile: rootedPath(rootPath, rpcTLSKeyFile),
 
 				// pprof listen address (https://golang.org/pkg/net/http/pprof)
-				// PprofListenAddress string `mapstructure:"pprof-laddr"`
+				PprofListenAddress: rpcPprofListenAddress,
 			},
 
 			P2P: &config.P2PConfig{
@@ -601,14 +763,14 @@ func ConfigFactory() (*Config, error) {
 				PersistentPeers: p2pPersistentPeers,
 
 				// UPNP port forwarding
-				UPNP: true,
+				UPNP: peerAddressDiscovery == peerAddressDiscoveryUPnP,
 
 				// Path to address book
 				AddrBook: fmt.Sprintf("%s%saddress-book.json", rootPath, string(os.PathSeparator)),
 
 				// Set true for strict address routability rules
 				// Set false for private or local networks
-				// AddrBookStrict bool `mapstructure:"addr-book-strict"`
+				AddrBookStrict: p2pAddrBookStrict,
 
 				// Maximum number of inbound peers
 				//
@@ -643,14 +805,18 @@ func ConfigFactory() (*Config, error) {
 				MaxPacketMsgPayloadSize: p2pMaxPacketMessagePayloadSize,
 
 				// Rate at which packets can be sent, in bytes/second
-				// SendRate int64 `mapstructure:"send-rate"`
+				SendRate: p2pSendRate,
 
 				// Rate at which packets can be received, in bytes/second
-				// RecvRate int64 `mapstructure:"recv-rate"`
+				RecvRate: p2pRecvRate,
 
 				// Set true to enable the peer-exchange reactor
 				PexReactor: !strings.EqualFold(mode, baseledgerModeValidator),
 
+				// Set true to crawl the network and hand out peer addresses
+				// instead of connecting to peers for consensus
+				SeedMode: strings.EqualFold(mode, baseledgerModeSeed),
+
 				// Comma separated list of peer IDs to keep private (will not be gossiped to
 				// other peers)
 				PrivatePeerIDs: p2pPrivatePeerIDs,
@@ -666,6 +832,8 @@ func ConfigFactory() (*Config, error) {
 				// P2P stack.
 				// DisableLegacy bool `mapstructure:"disable-legacy"`
 
+				// NOTE: the queue type is not supported by tendermint v0.34
+				//
 				// Makes it possible to configure which queue backend the p2p
 				// layer uses. Options are: "fifo", "priority" and "wdrr",
 				// with the default being "fifo".
@@ -691,26 +859,48 @@ func ConfigFactory() (*Config, error) {
 		ChainID:         chainID,
 		GenesisURL:      genesisURL,
 		GenesisStateURL: genesisStateURL,
+		GenesisHash:     genesisHash,
 
 		ProvideRefreshToken:    provideRefreshToken,
 		StakingContractAddress: stakingContractAddress,
 		StakingNetwork:         common.StringOrNil(stakingNetwork),
 
+		PeerPolicyPath:     peerPolicyPath,
+		StateRetainHeights: stateRetainHeights,
+
+		HaltHeight: haltHeight,
+		HaltTime:   haltTime,
+
+		PeerBanDialFailures:        peerBanDialFailures,
+		PeerBanRejections:          peerBanRejections,
+		PeerBanMisbehavior:         peerBanMisbehavior,
+		PeerBanDuration:            peerBanDuration,
+		PeerMisbehaviorBanDuration: peerMisbehaviorBanDuration,
+
+		PeerAddressDiscovery:           peerAddressDiscovery,
+		PeerBroadcastInterface:         p2pBroadcastInterface,
+		peerAddressDiscoveryConfigured: peerAddressDiscoveryConfigured,
+
 		VaultID:           vaultID,
 		VaultKeyID:        vaultKeyID,
 		VaultRefreshToken: &vaultRefreshToken,
-	}
 
-	cfgJSON, err := json.MarshalIndent(cfg, "", "    ")
-	if err != nil {
-		return nil, err
-	}
+		Signer:             signer,
+		KeystoreFile:       rootedPath(rootPath, keystoreFile),
+		KeystorePassphrase: keystorePassphrase,
 
-	cfgFilePath := fmt.Sprintf("%s%s%s", rootPath, string(os.PathSeparator), defaultConfigFilePath)
-	err = os.WriteFile(cfgFilePath, cfgJSON, 0644)
-	if err != nil {
-		return nil, err
+		settings: src.settings(),
 	}
 
 	return cfg, nil
 }
+
+// rootedPath returns the given path, relative to the given root directory
+// unless it is absolute
+func rootedPath(root, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+
+	return filepath.Join(root, path)
+}
@@ -0,0 +1,360 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	uuid "github.com/kthomas/go.uuid"
+)
+
+const configEnvPrefix = "BASELEDGER_"
+
+// ConfigFileEnv is the environment variable naming the config file
+const ConfigFileEnv = "BASELEDGER_CONFIG"
+
+var genesisHashPattern = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+var peerIDPattern = regexp.MustCompile(`^[0-9a-fA-F]{40}$`)
+
+// secret settings are never written out with the effective config
+var secretSettings = map[string]bool{
+	"BASELEDGER_KEYSTORE_PASSPHRASE": true,
+	"PROVIDE_REFRESH_TOKEN":          true,
+	"VAULT_REFRESH_TOKEN":            true,
+}
+
+// ConfigError aggregates every problem found while loading the configuration
+type ConfigError struct {
+	Errors []string
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("invalid configuration:\n  - %s", strings.Join(e.Errors, "\n  - "))
+}
+
+// configSource resolves each setting from, in increasing order of precedence,
+// the config file, the environment and the given overrides; settings are
+// named by their environment variable
+type configSource struct {
+	file      map[string]string
+	overrides map[string]string
+
+	effective map[string]string
+	errors    []string
+}
+
+// ConfigFileKey returns the config file key of the named setting; this is the
+// environment variable in lower case, without the BASELEDGER_ prefix
+func ConfigFileKey(name string) string {
+	return strings.ToLower(strings.TrimPrefix(name, configEnvPrefix))
+}
+
+// ConfigSettingName returns the setting named by the given config file key
+// or environment variable
+func ConfigSettingName(key string) string {
+	name := strings.ToUpper(key)
+	if strings.HasPrefix(name, configEnvPrefix) || strings.HasPrefix(name, "VAULT_") || strings.HasPrefix(name, "PROVIDE_") {
+		return name
+	}
+	return configEnvPrefix + name
+}
+
+func configSourceFactory(overrides map[string]string) *configSource {
+	src := &configSource{
+		file:      map[string]string{},
+		overrides: map[string]string{},
+		effective: map[string]string{},
+		errors:    make([]string, 0),
+	}
+
+	for key, val := range overrides {
+		src.overrides[ConfigSettingName(key)] = val
+	}
+
+	path := src.overrides[ConfigFileEnv]
+	if path == "" {
+		path = os.Getenv(ConfigFileEnv)
+	}
+
+	if path != "" {
+		src.load(path)
+	}
+
+	return src
+}
+
+// load the config file at the given path; the file is a JSON object of
+// settings keyed by ConfigFileKey
+func (s *configSource) load(path string) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		s.errorf("failed to read config file %s; %s", path, err.Error())
+		return
+	}
+
+	var settings map[string]interface{}
+	err = json.Unmarshal(raw, &settings)
+	if err != nil {
+		s.errorf("failed to parse config file %s; %s", path, err.Error())
+		return
+	}
+
+	for key, val := range settings {
+		switch v := val.(type) {
+		case string:
+			s.file[key] = v
+		case bool:
+			s.file[key] = strconv.FormatBool(v)
+		case float64:
+			s.file[key] = strconv.FormatFloat(v, 'f', -1, 64)
+		case []interface{}:
+			items := make([]string, 0, len(v))
+			for _, item := range v {
+				items = append(items, fmt.Sprintf("%v", item))
+			}
+			s.file[key] = strings.Join(items, ",")
+		default:
+			s.errorf("config file %s: unsupported value for %s", path, key)
+		}
+	}
+}
+
+func (s *configSource) errorf(format string, args ...interface{}) {
+	s.errors = append(s.errors, fmt.Sprintf(format, args...))
+}
+
+// err returns the aggregated errors, if any; config file keys which name no
+// setting are reported, so they must be checked after every setting is read
+func (s *configSource) err() error {
+	for key := range s.file {
+		if _, ok := s.effective[ConfigSettingName(key)]; !ok {
+			s.errorf("unknown config file setting: %s", key)
+		}
+	}
+
+	if len(s.errors) == 0 {
+		return nil
+	}
+
+	sort.Strings(s.errors)
+	return &ConfigError{Errors: s.errors}
+}
+
+// lookup the raw value of the named setting
+func (s *configSource) lookup(name string) (string, bool) {
+	if val, ok := s.overrides[name]; ok {
+		return val, true
+	}
+
+	if val := os.Getenv(name); val != "" {
+		return val, true
+	}
+
+	val, ok := s.file[ConfigFileKey(name)]
+	return val, ok && val != ""
+}
+
+// string returns the named setting or the given default
+func (s *configSource) string(name, dflt string) string {
+	val, ok := s.lookup(name)
+	if !ok {
+		val = dflt
+	}
+
+	s.effective[name] = val
+	return val
+}
+
+// stringOrNil returns the named setting or nil
+func (s *configSource) stringOrNil(name string) *string {
+	return StringOrNil(s.string(name, ""))
+}
+
+func (s *configSource) bool(name string, dflt bool) bool {
+	val, ok := s.lookup(name)
+	if !ok {
+		s.effective[name] = strconv.FormatBool(dflt)
+		return dflt
+	}
+
+	s.effective[name] = val
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		s.errorf("%s must be true or false; got %q", name, val)
+		return dflt
+	}
+
+	return b
+}
+
+func (s *configSource) int64(name string, dflt int64) int64 {
+	val, ok := s.lookup(name)
+	if !ok {
+		s.effective[name] = strconv.FormatInt(dflt, 10)
+		return dflt
+	}
+
+	s.effective[name] = val
+	i, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		s.errorf("%s must be an integer; got %q", name, val)
+		return dflt
+	}
+
+	return i
+}
+
+func (s *configSource) int(name string, dflt int) int {
+	return int(s.int64(name, int64(dflt)))
+}
+
+func (s *configSource) duration(name string, dflt time.Duration) time.Duration {
+	val, ok := s.lookup(name)
+	if !ok {
+		s.effective[name] = dflt.String()
+		return dflt
+	}
+
+	s.effective[name] = val
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		s.errorf("%s must be a duration, e.g. 5s; got %q", name, val)
+		return dflt
+	}
+
+	return d
+}
+
+func (s *configSource) time(name string) *time.Time {
+	val, ok := s.lookup(name)
+	s.effective[name] = val
+	if !ok {
+		return nil
+	}
+
+	t, err := time.Parse(time.RFC3339, val)
+	if err != nil {
+		s.errorf("%s must be an RFC 3339 time, e.g. 2021-09-01T00:00:00Z; got %q", name, val)
+		return nil
+	}
+
+	return &t
+}
+
+func (s *configSource) url(name, dflt string) *url.URL {
+	val := s.string(name, dflt)
+	if val == "" {
+		return nil
+	}
+
+	u, err := url.Parse(val)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		s.errorf("%s must be an absolute url; got %q", name, val)
+		return nil
+	}
+
+	return u
+}
+
+func (s *configSource) uuid(name string) *uuid.UUID {
+	val := s.string(name, "")
+	if val == "" {
+		return nil
+	}
+
+	id, err := uuid.FromString(val)
+	if err != nil {
+		s.errorf("%s must be a uuid; got %q", name, val)
+		return nil
+	}
+
+	return &id
+}
+
+// oneOf reports an error unless the named setting has one of the given values
+func (s *configSource) oneOf(name, val string, allowed ...string) {
+	for _, a := range allowed {
+		if strings.EqualFold(val, a) {
+			return
+		}
+	}
+
+	s.errorf("%s must be one of %s; got %q", name, strings.Join(allowed, ", "), val)
+}
+
+// listenAddress reports an error unless the given value is a tcp://host:port
+// or unix:// listen address
+func (s *configSource) listenAddress(name, val string) {
+	u, err := url.Parse(val)
+	if err == nil {
+		switch u.Scheme {
+		case "tcp":
+			_, port, err := net.SplitHostPort(u.Host)
+			if err == nil {
+				if _, err := strconv.ParseUint(port, 10, 16); err == nil {
+					return
+				}
+			}
+		case "unix":
+			if u.Path != "" {
+				return
+			}
+		}
+	}
+
+	s.errorf("%s must be a listen address, e.g. tcp://0.0.0.0:33333; got %q", name, val)
+}
+
+// peers reports an error unless the given value is a comma-separated list of
+// id@host:port peer addresses
+func (s *configSource) peers(name, val string) {
+	if val == "" {
+		return
+	}
+
+	for _, peer := range strings.Split(val, ",") {
+		parts := strings.SplitN(strings.TrimSpace(peer), "@", 2)
+		if len(parts) == 2 && peerIDPattern.MatchString(parts[0]) {
+			if _, _, err := net.SplitHostPort(parts[1]); err == nil {
+				continue
+			}
+		}
+
+		s.errorf("%s must be a comma-separated list of id@host:port peers; got %q", name, peer)
+	}
+}
+
+// peerIDs reports an error unless the given value is a comma-separated list of
+// peer ids
+func (s *configSource) peerIDs(name, val string) {
+	if val == "" {
+		return
+	}
+
+	for _, id := range strings.Split(val, ",") {
+		if !peerIDPattern.MatchString(strings.TrimSpace(id)) {
+			s.errorf("%s must be a comma-separated list of hex-encoded peer ids; got %q", name, id)
+		}
+	}
+}
+
+// settings returns the effective value of each setting, keyed by config file
+// key, with secrets omitted
+func (s *configSource) settings() map[string]string {
+	settings := map[string]string{}
+	for name, val := range s.effective {
+		if secretSettings[name] || val == "" {
+			continue
+		}
+		settings[ConfigFileKey(name)] = val
+	}
+
+	return settings
+}
@@ -0,0 +1,53 @@
+package common
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const rootDirLockFile = "LOCK"
+
+// DirLock is an exclusive lock held on a directory by this process
+type DirLock struct {
+	file *os.File
+	path string
+}
+
+// LockRootDir creates the root directory of the given config, if necessary,
+// and locks it against use by any other process; the lock is held until
+// released or the process exits
+func LockRootDir(cfg *Config) (*DirLock, error) {
+	err := os.MkdirAll(cfg.RootDir, 0700)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create root directory %s; %s", cfg.RootDir, err.Error())
+	}
+
+	path := filepath.Join(cfg.RootDir, rootDirLockFile)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file %s; %s", path, err.Error())
+	}
+
+	err = lockFile(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("root directory %s is in use by another process; %s", cfg.RootDir, err.Error())
+	}
+
+	return &DirLock{
+		file: file,
+		path: path,
+	}, nil
+}
+
+// Release the lock
+func (l *DirLock) Release() error {
+	err := unlockFile(l.file)
+	if err != nil {
+		l.file.Close()
+		return fmt.Errorf("failed to release lock %s; %s", l.path, err.Error())
+	}
+
+	return l.file.Close()
+}
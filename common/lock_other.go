@@ -0,0 +1,19 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package common
+
+import (
+	"os"
+)
+
+// the root directory is not locked on platforms without flock, such as
+// windows; operators must ensure only one process uses a root directory
+func lockFile(file *os.File) error {
+	Log.Warningf("root directory lock %s is not enforced on this platform", file.Name())
+	return nil
+}
+
+func unlockFile(file *os.File) error {
+	return nil
+}
@@ -2,6 +2,7 @@ package common
 
 import (
 	"os"
+	"strings"
 
 	logger "github.com/kthomas/go-logger"
 )
@@ -34,6 +35,17 @@ func StringOrNil(str string) *string {
 	return &str
 }
 
+// ReadSecretFile reads a secret, e.g. a passphrase, from the given file,
+// ignoring trailing newlines
+func ReadSecretFile(path string) (string, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(raw), "\r\n"), nil
+}
+
 func requireLogger() {
 	LogLevel = os.Getenv("LOG_LEVEL")
 	if LogLevel == "" {
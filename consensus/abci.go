@@ -0,0 +1,61 @@
+package consensus
+
+import (
+	"fmt"
+
+	"github.com/providenetwork/baseledger/protocol"
+	abcicli "github.com/providenetwork/tendermint/abci/client"
+	abcitypes "github.com/providenetwork/tendermint/abci/types"
+	"github.com/providenetwork/tendermint/proxy"
+)
+
+// haltingClientCreator creates local ABCI clients which refuse to start a
+// block once the baseline protocol halts, so the block is never committed
+type haltingClientCreator struct {
+	proxy.ClientCreator
+	baseline *protocol.Baseline
+
+	// fastSyncing returns true while blocks are executed by the blockchain
+	// reactor; it is set once the node is initialized
+	fastSyncing func() bool
+}
+
+func haltingClientCreatorFactory(baseline *protocol.Baseline) *haltingClientCreator {
+	return &haltingClientCreator{
+		ClientCreator: proxy.NewLocalClientCreator(baseline),
+		baseline:      baseline,
+	}
+}
+
+func (c *haltingClientCreator) NewABCIClient() (abcicli.Client, error) {
+	client, err := c.ClientCreator.NewABCIClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return &haltingClient{
+		Client:  client,
+		creator: c,
+	}, nil
+}
+
+type haltingClient struct {
+	abcicli.Client
+	creator *haltingClientCreator
+}
+
+// BeginBlockSync refuses to start a block once the baseline protocol halts;
+// consensus logs the error and leaves the block uncommitted, to be executed
+// when the node is started again. The blockchain reactor cannot recover from
+// the error, so its routine is parked instead until the node exits
+func (c *haltingClient) BeginBlockSync(req abcitypes.RequestBeginBlock) (*abcitypes.ResponseBeginBlock, error) {
+	if !c.creator.baseline.Halting() {
+		return c.Client.BeginBlockSync(req)
+	}
+
+	if c.creator.fastSyncing != nil && c.creator.fastSyncing() {
+		select {}
+	}
+
+	return nil, fmt.Errorf("refusing to start block %d; the node is halting", req.Header.Height)
+}
@@ -1,31 +1,89 @@
 package consensus
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"net/url"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/providenetwork/baseledger/common"
+	"github.com/providenetwork/baseledger/protocol"
 	tmjson "github.com/providenetwork/tendermint/libs/json"
 	tmproto "github.com/providenetwork/tendermint/proto/tendermint/types"
 	"github.com/providenetwork/tendermint/types"
-	"github.com/provideplatform/provide-go/api"
 )
 
 const defaultGenesisAppVersion = 0x1
 const defaultGenesisValidatorVotingPower = 1
+const genesisFetchTimeout = 30 * time.Second
 
 // GenesisFactory initializes and returns the genesis state, which
 // defines the initial conditions for a tendermint blockchain, including
-// its validator set and application state
+// its validator set and application state; the genesis must match the
+// configured chain id, the pinned genesis hash if one is configured, and
+// the local genesis file if one exists
 func GenesisFactory(cfg *common.Config) (*types.GenesisDoc, error) {
 	genesis, err := GenesisDocFactory(cfg)
 	if err != nil {
 		return nil, err
 	}
 
-	// write the latest config to disk
+	err = genesis.ValidateAndComplete()
+	if err != nil {
+		return nil, fmt.Errorf("invalid genesis; %s", err.Error())
+	}
+
+	if genesis.ChainID != cfg.ChainID {
+		return nil, fmt.Errorf("genesis chain id %s does not match the configured chain id %s", genesis.ChainID, cfg.ChainID)
+	}
+
+	hash, err := GenesisHash(genesis)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.GenesisHash != nil && !strings.EqualFold(*cfg.GenesisHash, hash) {
+		return nil, fmt.Errorf("genesis hash %s does not match the pinned genesis hash %s", hash, *cfg.GenesisHash)
+	}
+
+	if _, err := os.Stat(cfg.Genesis); err == nil {
+		localJSON, err := os.ReadFile(cfg.Genesis)
+		if err != nil {
+			return nil, err
+		}
+
+		var local *types.GenesisDoc
+		err = tmjson.Unmarshal(localJSON, &local)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse local genesis %s; %s", cfg.Genesis, err.Error())
+		}
+
+		err = local.ValidateAndComplete()
+		if err != nil {
+			return nil, fmt.Errorf("invalid local genesis %s; %s", cfg.Genesis, err.Error())
+		}
+
+		localHash, err := GenesisHash(local)
+		if err != nil {
+			return nil, err
+		}
+
+		if localHash != hash {
+			return nil, fmt.Errorf("genesis hash %s does not match the hash %s of the local genesis %s; refusing to overwrite it", hash, localHash, cfg.Genesis)
+		}
+
+		common.Log.Infof("verified genesis %s for chain %s", hash, genesis.ChainID)
+		return genesis, nil
+	}
+
+	// write the genesis to disk
 	genesisJSON, err := tmjson.MarshalIndent(genesis, "", "    ")
 	if err != nil {
 		return nil, err
@@ -35,9 +93,29 @@ func GenesisFactory(cfg *common.Config) (*types.GenesisDoc, error) {
 		return nil, err
 	}
 
+	common.Log.Infof("initialized genesis %s for chain %s", hash, genesis.ChainID)
 	return genesis, nil
 }
 
+// GenesisHash returns the hex-encoded SHA-256 hash of the canonical JSON
+// encoding of the given genesis document, as returned by
+// protocol.CanonicalJSON; the hash does not depend on the formatting of the
+// genesis file or on how it was served
+func GenesisHash(genesis *types.GenesisDoc) (string, error) {
+	genesisJSON, err := tmjson.Marshal(genesis)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal genesis; %s", err.Error())
+	}
+
+	canonical, err := protocol.CanonicalJSON(genesisJSON)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode genesis; %s", err.Error())
+	}
+
+	hash := sha256.Sum256(canonical)
+	return strings.ToUpper(hex.EncodeToString(hash[:])), nil
+}
+
 // GenesisDocFactory returns a GenesisDoc defining the initial parameters for a
 // tendermint blockchain, in particular its validator set; if a genesis URL is
 // provided by the given config, that resource is unmarshaled and returned.
@@ -58,7 +136,6 @@ func GenesisDocFactory(cfg *common.Config) (*types.GenesisDoc, error) {
 	}
 
 	if _, err := os.Stat(cfg.Genesis); err == nil {
-		// TODO-- match this against contents of genesis url if one is provided...?
 		genesisJSON, err := os.ReadFile(cfg.Genesis)
 		if err != nil {
 			return nil, err
@@ -88,81 +165,96 @@ func GenesisDocFactory(cfg *common.Config) (*types.GenesisDoc, error) {
 
 	return &types.GenesisDoc{
 		// AppHash         tmbytes.HexBytes         `json:"app_hash"`
-		AppState: genesisStateJSON,
-		ChainID:  cfg.ChainID,
-		ConsensusParams: &tmproto.ConsensusParams{
-			Block: tmproto.BlockParams{
-				MaxBytes:   22020096, // 21 MiB
-				MaxGas:     -1,
-				TimeIotaMs: 25,
-			},
-			Evidence: tmproto.EvidenceParams{
-				MaxAgeNumBlocks: 100000,
-				MaxAgeDuration:  time.Hour * 24 * 30, // 30 days
-				MaxBytes:        1048576,             // 1 MiB
-			},
-			Validator: tmproto.ValidatorParams{
-				PubKeyTypes: []string{
-					types.ABCIPubKeyTypeEd25519,
-				},
-			},
-			Version: tmproto.VersionParams{
-				AppVersion: defaultGenesisAppVersion,
-			},
-		},
-		GenesisTime:   genesisTime,
-		InitialHeight: int64(1),
+		AppState:        genesisStateJSON,
+		ChainID:         cfg.ChainID,
+		ConsensusParams: DefaultConsensusParams(),
+		GenesisTime:     genesisTime,
+		InitialHeight:   int64(1),
 	}, nil
 }
 
-func fetchGenesis(cfg *common.Config) (json.RawMessage, error) {
-	client := &api.Client{
-		Host:   cfg.GenesisURL.Host,
-		Scheme: cfg.GenesisURL.Scheme,
-		Path:   "/",
+// DefaultConsensusParams returns the consensus params of a new baseledger
+// network
+func DefaultConsensusParams() *tmproto.ConsensusParams {
+	return &tmproto.ConsensusParams{
+		Block: tmproto.BlockParams{
+			MaxBytes:   22020096, // 21 MiB
+			MaxGas:     -1,
+			TimeIotaMs: 25,
+		},
+		Evidence: tmproto.EvidenceParams{
+			MaxAgeNumBlocks: 100000,
+			MaxAgeDuration:  time.Hour * 24 * 30, // 30 days
+			MaxBytes:        1048576,             // 1 MiB
+		},
+		Validator: tmproto.ValidatorParams{
+			PubKeyTypes: []string{
+				types.ABCIPubKeyTypeEd25519,
+			},
+		},
+		Version: tmproto.VersionParams{
+			AppVersion: defaultGenesisAppVersion,
+		},
 	}
+}
 
-	_, resp, err := client.Get(cfg.GenesisURL.Path, map[string]interface{}{})
+// fetchGenesis returns the genesis document served at the genesis url; a
+// genesis wrapped in an rpc response is unwrapped. The document is returned as
+// served, as re-encoding it would alter its app_state
+func fetchGenesis(cfg *common.Config) (json.RawMessage, error) {
+	raw, err := fetchJSON(cfg.GenesisURL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch genesis JSON at url: %s; %s", cfg.GenesisURL.String(), err.Error())
 	}
 
-	var genesis map[string]interface{}
-	if response, ok := resp.(map[string]interface{}); ok {
-		genesis = response
-
-		// handle genesis by way of rpc	response
-		if result, resultOk := genesis["result"].(map[string]interface{}); resultOk {
-			if resultGenesis, resultGenesisOk := result["genesis"].(map[string]interface{}); resultGenesisOk {
-				genesis = resultGenesis
-			}
-		}
+	// handle genesis by way of rpc response
+	var response struct {
+		Result *struct {
+			Genesis json.RawMessage `json:"genesis"`
+		} `json:"result"`
 	}
-
-	raw, err := json.Marshal(genesis)
+	err = json.Unmarshal(raw, &response)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse genesis JSON; %s", err.Error())
 	}
 
+	if response.Result != nil && len(response.Result.Genesis) > 0 {
+		return response.Result.Genesis, nil
+	}
+
 	return json.RawMessage(raw), nil
 }
 
 func fetchGenesisState(cfg *common.Config) (json.RawMessage, error) {
-	client := &api.Client{
-		Host:   cfg.GenesisStateURL.Host,
-		Scheme: cfg.GenesisStateURL.Scheme,
-		Path:   "/",
+	raw, err := fetchJSON(cfg.GenesisStateURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch genesis state at url: %s; %s", cfg.GenesisStateURL.String(), err.Error())
 	}
 
-	_, resp, err := client.Get(cfg.GenesisStateURL.Path, map[string]interface{}{})
+	return json.RawMessage(raw), nil
+}
+
+// fetchJSON returns the JSON document served at the given url
+func fetchJSON(u *url.URL) ([]byte, error) {
+	client := &http.Client{Timeout: genesisFetchTimeout}
+	resp, err := client.Get(u.String())
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch genesis state at url: %s; %s", cfg.GenesisStateURL.String(), err.Error())
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response status %d", resp.StatusCode)
 	}
 
-	raw, err := json.Marshal(resp)
+	raw, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse genesis state as JSON; %s", err.Error())
+		return nil, err
 	}
 
-	return json.RawMessage(raw), nil
+	if !json.Valid(raw) {
+		return nil, errors.New("response is not a JSON document")
+	}
+
+	return raw, nil
 }
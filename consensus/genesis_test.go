@@ -0,0 +1,164 @@
+package consensus
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/providenetwork/baseledger/common"
+	"github.com/providenetwork/baseledger/protocol"
+	"github.com/providenetwork/tendermint/crypto"
+	"github.com/providenetwork/tendermint/crypto/ed25519"
+	tmjson "github.com/providenetwork/tendermint/libs/json"
+	"github.com/providenetwork/tendermint/types"
+)
+
+// the app_state is indented, its keys are unsorted at every level and it
+// carries a number which does not fit a float64
+const testGenesisAppState = `{
+    "entropy": {"interval": 10},
+    "metadata": {
+        "z": 100000000000000000001,
+        "a": {"y": 1.50, "b": [3, 2, 1]}
+    }
+}`
+
+// signedTestGenesis returns the JSON of a genesis signed by both of its
+// validators, with the signatures added to the app_state as written
+func signedTestGenesis(t *testing.T) []byte {
+	keys := []crypto.PrivKey{ed25519.GenPrivKey(), ed25519.GenPrivKey()}
+
+	genesis := &types.GenesisDoc{
+		AppState:        json.RawMessage(testGenesisAppState),
+		ChainID:         "genesis-test",
+		ConsensusParams: DefaultConsensusParams(),
+		GenesisTime:     time.Date(2021, 9, 1, 0, 0, 0, 0, time.UTC),
+		InitialHeight:   1,
+	}
+
+	for i, key := range keys {
+		genesis.Validators = append(genesis.Validators, types.GenesisValidator{
+			Address: key.PubKey().Address(),
+			PubKey:  key.PubKey(),
+			Power:   10,
+			Name:    fmt.Sprintf("validator-%d", i),
+		})
+	}
+
+	signBytes, err := protocol.GenesisSignBytes(genesis)
+	if err != nil {
+		t.Fatalf("failed to build genesis sign bytes; %s", err.Error())
+	}
+
+	signatures := make([]*protocol.GenesisSignature, 0, len(keys))
+	for _, key := range keys {
+		sig, err := key.Sign(signBytes)
+		if err != nil {
+			t.Fatalf("failed to sign genesis; %s", err.Error())
+		}
+
+		signatures = append(signatures, &protocol.GenesisSignature{
+			Address:   key.PubKey().Address().String(),
+			Signature: sig,
+		})
+	}
+
+	rawSignatures, err := json.Marshal(signatures)
+	if err != nil {
+		t.Fatalf("failed to marshal genesis signatures; %s", err.Error())
+	}
+
+	genesis.AppState = json.RawMessage(fmt.Sprintf("{\n    \"signatures\": %s,%s", rawSignatures, strings.TrimPrefix(testGenesisAppState, "{")))
+
+	raw, err := tmjson.MarshalIndent(genesis, "", "    ")
+	if err != nil {
+		t.Fatalf("failed to marshal genesis; %s", err.Error())
+	}
+
+	return raw
+}
+
+// reencode returns the given JSON with its keys sorted and its whitespace
+// removed, as a node serving the genesis may encode it
+func reencode(t *testing.T, raw []byte) []byte {
+	canonical, err := protocol.CanonicalJSON(raw)
+	if err != nil {
+		t.Fatalf("failed to re-encode genesis; %s", err.Error())
+	}
+
+	return canonical
+}
+
+func TestFetchedGenesisVerifies(t *testing.T) {
+	genesisJSON := signedTestGenesis(t)
+
+	var local *types.GenesisDoc
+	err := tmjson.Unmarshal(genesisJSON, &local)
+	if err != nil {
+		t.Fatalf("failed to parse genesis; %s", err.Error())
+	}
+
+	localHash, err := GenesisHash(local)
+	if err != nil {
+		t.Fatalf("failed to hash genesis; %s", err.Error())
+	}
+
+	tests := []struct {
+		name string
+		body []byte
+	}{
+		{
+			name: "as written",
+			body: genesisJSON,
+		},
+		{
+			name: "re-encoded rpc response",
+			body: []byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":-1,"result":{"genesis":%s}}`, reencode(t, genesisJSON))),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write(test.body)
+			}))
+			defer server.Close()
+
+			genesisURL, _ := url.Parse(server.URL + "/genesis.json")
+			fetchedJSON, err := fetchGenesis(&common.Config{GenesisURL: genesisURL})
+			if err != nil {
+				t.Fatalf("failed to fetch genesis; %s", err.Error())
+			}
+
+			var fetched *types.GenesisDoc
+			err = tmjson.Unmarshal(fetchedJSON, &fetched)
+			if err != nil {
+				t.Fatalf("failed to parse fetched genesis; %s", err.Error())
+			}
+
+			params, err := protocol.ValidateGenesis(fetched)
+			if err != nil {
+				t.Fatalf("fetched genesis does not verify; %s", err.Error())
+			}
+
+			if len(params.Signatures) != 2 {
+				t.Fatalf("expected 2 genesis signatures; got %d", len(params.Signatures))
+			}
+
+			hash, err := GenesisHash(fetched)
+			if err != nil {
+				t.Fatalf("failed to hash fetched genesis; %s", err.Error())
+			}
+
+			if hash != localHash {
+				t.Fatalf("fetched genesis hash %s does not match the local genesis hash %s", hash, localHash)
+			}
+		})
+	}
+}
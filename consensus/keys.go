@@ -0,0 +1,133 @@
+package consensus
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/providenetwork/baseledger/common"
+	"github.com/providenetwork/tendermint/crypto"
+	"github.com/providenetwork/tendermint/crypto/ed25519"
+	tmos "github.com/providenetwork/tendermint/libs/os"
+	"github.com/providenetwork/tendermint/p2p"
+)
+
+// GenerateValidatorKey generates the validator key of a node using the
+// configured signer, returning its public key; an existing validator key is
+// never replaced
+func GenerateValidatorKey(cfg *common.Config) (crypto.PubKey, error) {
+	switch {
+	case cfg.UsesRemoteSigner():
+		return nil, errors.New("the validator key is held by the remote signer; generate it there")
+	case cfg.UsesKeystoreSigner():
+		if tmos.FileExists(cfg.KeystoreFile) {
+			return nil, fmt.Errorf("keystore %s already exists; refusing to replace the validator key", cfg.KeystoreFile)
+		}
+	default:
+		path := filepath.Join(cfg.RootDir, validatorKeyFilePath)
+		if tmos.FileExists(path) {
+			return nil, fmt.Errorf("validator key %s already exists; refusing to replace the validator key", path)
+		}
+	}
+
+	validator, err := privValidatorFactory(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate validator key; %s", err.Error())
+	}
+
+	pubkey, err := validator.GetPubKey()
+	if err != nil || pubkey == nil || len(pubkey.Bytes()) != ed25519.PubKeySize {
+		return nil, errors.New("failed to resolve validator public key")
+	}
+
+	return ed25519.PubKey(pubkey.Bytes()), nil
+}
+
+// ExportKeystore returns the validator key of the local keystore encrypted
+// with the given passphrase; vault and remote signer keys never leave the
+// signer, so they cannot be exported
+func ExportKeystore(cfg *common.Config, passphrase string) (*Keystore, error) {
+	if !cfg.UsesKeystoreSigner() {
+		return nil, fmt.Errorf("only keystore keys can be exported; the %s signer does not release its key", cfg.Signer)
+	}
+
+	if !tmos.FileExists(cfg.KeystoreFile) {
+		return nil, fmt.Errorf("keystore not found at %s; initialize the node or import a key", cfg.KeystoreFile)
+	}
+
+	privKey, err := loadOrGenKeystoreKey(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return EncryptKeystore(privKey, passphrase)
+}
+
+// ImportKeystore decrypts the given keystore with the given passphrase and
+// writes its key to the local keystore, encrypted with the configured
+// passphrase, returning its public key; an existing keystore is never
+// replaced
+func ImportKeystore(cfg *common.Config, keystore *Keystore, passphrase string) (crypto.PubKey, error) {
+	if !cfg.UsesKeystoreSigner() {
+		return nil, fmt.Errorf("keys can only be imported into a keystore; the %s signer holds its own key", cfg.Signer)
+	}
+
+	if cfg.KeystorePassphrase == nil {
+		return nil, errors.New("BASELEDGER_KEYSTORE_PASSPHRASE or BASELEDGER_KEYSTORE_PASSPHRASE_FILE is required by the keystore signer")
+	}
+
+	if tmos.FileExists(cfg.KeystoreFile) {
+		return nil, fmt.Errorf("keystore %s already exists; refusing to replace the validator key", cfg.KeystoreFile)
+	}
+
+	privKey, err := keystore.Decrypt(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	imported, err := EncryptKeystore(privKey, *cfg.KeystorePassphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	err = WriteKeystore(cfg.KeystoreFile, imported)
+	if err != nil {
+		return nil, err
+	}
+
+	return imported.PubKey, nil
+}
+
+// RotateNodeKey writes a new p2p key for a node to its local node key file,
+// returning the previous and the new node id. A local node key file takes
+// precedence over the node key held by vault, so with the vault signer the
+// new key shadows the vault node key, which is left untouched. The node id is
+// not the validator address, and the validator key is left unchanged; a
+// validator node registers its new node id once it runs again. The node
+// must not be running, and its peers must be given its new node id
+func RotateNodeKey(cfg *common.Config) (p2p.ID, p2p.ID, error) {
+	var previous p2p.ID
+	nodeKey, err := NodeKey(cfg)
+	if err == nil {
+		previous = nodeKey.ID()
+	}
+
+	rotated := p2p.GenNodeKey()
+
+	// replace the node key atomically, so it is never lost halfway
+	path := cfg.NodeKeyFile()
+	err = rotated.SaveAs(path + ".tmp")
+	if err != nil {
+		os.Remove(path + ".tmp")
+		return "", "", fmt.Errorf("failed to write node key; %s", err.Error())
+	}
+
+	err = os.Rename(path+".tmp", path)
+	if err != nil {
+		os.Remove(path + ".tmp")
+		return "", "", fmt.Errorf("failed to replace node key %s; %s", path, err.Error())
+	}
+
+	return previous, rotated.ID(), nil
+}
@@ -0,0 +1,186 @@
+package consensus
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/providenetwork/tendermint/crypto"
+	"github.com/providenetwork/tendermint/crypto/ed25519"
+	tmjson "github.com/providenetwork/tendermint/libs/json"
+	tmos "github.com/providenetwork/tendermint/libs/os"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+const keystoreKDFScrypt = "scrypt"
+const keystoreCipherSecretbox = "xsalsa20-poly1305"
+
+// scrypt parameters; these cost 32 MiB of memory to derive a key
+const keystoreScryptN = 1 << 15
+const keystoreScryptR = 8
+const keystoreScryptP = 1
+
+const keystoreKeySize = 32
+const keystoreNonceSize = 24
+const keystoreSaltSize = 32
+
+// Keystore is an Ed25519 private key encrypted with a passphrase; the key is
+// derived from the passphrase with scrypt and the private key is sealed with
+// nacl secretbox. The public key and address are kept in the clear, so they
+// can be read without the passphrase
+type Keystore struct {
+	Address crypto.Address `json:"address"`
+	PubKey  crypto.PubKey  `json:"pub_key"`
+	Crypto  KeystoreCrypto `json:"crypto"`
+}
+
+// KeystoreCrypto holds the parameters and ciphertext of an encrypted key
+type KeystoreCrypto struct {
+	KDF        string `json:"kdf"`
+	N          int    `json:"n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+	Salt       []byte `json:"salt"`
+	Cipher     string `json:"cipher"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// EncryptKeystore encrypts the given private key with the given passphrase
+func EncryptKeystore(privKey ed25519.PrivKey, passphrase string) (*Keystore, error) {
+	if passphrase == "" {
+		return nil, errors.New("keystore passphrase must not be empty")
+	}
+
+	salt := make([]byte, keystoreSaltSize)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return nil, err
+	}
+
+	var nonce [keystoreNonceSize]byte
+	_, err = rand.Read(nonce[:])
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := keystoreKey(passphrase, salt, keystoreScryptN, keystoreScryptR, keystoreScryptP)
+	if err != nil {
+		return nil, err
+	}
+
+	pubkey := privKey.PubKey()
+	return &Keystore{
+		Address: pubkey.Address(),
+		PubKey:  pubkey,
+		Crypto: KeystoreCrypto{
+			KDF:        keystoreKDFScrypt,
+			N:          keystoreScryptN,
+			R:          keystoreScryptR,
+			P:          keystoreScryptP,
+			Salt:       salt,
+			Cipher:     keystoreCipherSecretbox,
+			Nonce:      nonce[:],
+			Ciphertext: secretbox.Seal(nil, privKey, &nonce, key),
+		},
+	}, nil
+}
+
+// Decrypt the private key of the keystore with the given passphrase
+func (k *Keystore) Decrypt(passphrase string) (ed25519.PrivKey, error) {
+	if k.Crypto.KDF != keystoreKDFScrypt {
+		return nil, fmt.Errorf("unsupported keystore kdf: %s", k.Crypto.KDF)
+	}
+
+	if k.Crypto.Cipher != keystoreCipherSecretbox {
+		return nil, fmt.Errorf("unsupported keystore cipher: %s", k.Crypto.Cipher)
+	}
+
+	if len(k.Crypto.Nonce) != keystoreNonceSize {
+		return nil, errors.New("invalid keystore nonce")
+	}
+
+	key, err := keystoreKey(passphrase, k.Crypto.Salt, k.Crypto.N, k.Crypto.R, k.Crypto.P)
+	if err != nil {
+		return nil, err
+	}
+
+	var nonce [keystoreNonceSize]byte
+	copy(nonce[:], k.Crypto.Nonce)
+
+	plaintext, ok := secretbox.Open(nil, k.Crypto.Ciphertext, &nonce, key)
+	if !ok {
+		return nil, errors.New("failed to decrypt keystore; wrong passphrase or corrupt keystore")
+	}
+
+	if len(plaintext) != ed25519.PrivateKeySize {
+		return nil, errors.New("keystore does not contain an Ed25519 private key")
+	}
+
+	privKey := ed25519.PrivKey(plaintext)
+	if k.PubKey == nil || !privKey.PubKey().Equals(k.PubKey) {
+		return nil, errors.New("keystore private key does not match its public key")
+	}
+
+	return privKey, nil
+}
+
+func keystoreKey(passphrase string, salt []byte, n, r, p int) (*[keystoreKeySize]byte, error) {
+	derived, err := scrypt.Key([]byte(passphrase), salt, n, r, p, keystoreKeySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive keystore key; %s", err.Error())
+	}
+
+	var key [keystoreKeySize]byte
+	copy(key[:], derived)
+	return &key, nil
+}
+
+// ReadKeystore reads the keystore at the given path
+func ReadKeystore(path string) (*Keystore, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var keystore *Keystore
+	err = tmjson.Unmarshal(raw, &keystore)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse keystore %s; %s", path, err.Error())
+	}
+
+	return keystore, nil
+}
+
+// WriteKeystore writes the given keystore to the given path, which must not
+// exist, so that no key is ever overwritten
+func WriteKeystore(path string, keystore *Keystore) error {
+	if tmos.FileExists(path) {
+		return fmt.Errorf("keystore %s already exists; refusing to overwrite it", path)
+	}
+
+	raw, err := tmjson.MarshalIndent(keystore, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(raw)
+	if err == nil {
+		err = file.Sync()
+	}
+	file.Close()
+
+	if err != nil {
+		os.Remove(path)
+		return fmt.Errorf("failed to write keystore %s; %s", path, err.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,179 @@
+package consensus
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/providenetwork/baseledger/common"
+	"github.com/providenetwork/baseledger/protocol"
+	"github.com/providenetwork/tendermint/crypto"
+	"github.com/providenetwork/tendermint/crypto/ed25519"
+	tmjson "github.com/providenetwork/tendermint/libs/json"
+	tmos "github.com/providenetwork/tendermint/libs/os"
+	"github.com/providenetwork/tendermint/p2p"
+	"github.com/providenetwork/tendermint/privval"
+	"github.com/providenetwork/tendermint/types"
+)
+
+const validatorKeyFilePath = "validator.json"
+
+// InitNode initializes the genesis and keys of a node without starting it,
+// returning the genesis, the node key and the validator public key; the
+// validator public key is nil with the remote signer, which holds the key
+func InitNode(cfg *common.Config) (*types.GenesisDoc, *p2p.NodeKey, crypto.PubKey, error) {
+	genesis, err := GenesisFactory(cfg)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to initialize genesis; %s", err.Error())
+	}
+
+	nodeKey, err := nodeKeyFactory(cfg)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to initialize node key; %s", err.Error())
+	}
+
+	validator, err := privValidatorFactory(cfg)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to initialize validator key; %s", err.Error())
+	}
+
+	if validator == nil {
+		return genesis, nodeKey, nil, nil
+	}
+
+	pubkey, err := validator.GetPubKey()
+	if err != nil || pubkey == nil || len(pubkey.Bytes()) != ed25519.PubKeySize {
+		return nil, nil, nil, errors.New("failed to resolve validator public key")
+	}
+
+	return genesis, nodeKey, ed25519.PubKey(pubkey.Bytes()), nil
+}
+
+// NodeKey returns the p2p key of an initialized node
+func NodeKey(cfg *common.Config) (*p2p.NodeKey, error) {
+	if tmos.FileExists(cfg.NodeKeyFile()) {
+		return p2p.LoadNodeKey(cfg.NodeKeyFile())
+	}
+
+	if vaultConfigured(cfg) && cfg.VaultKeyID != nil {
+		nodeKey := p2p.FetchVaultedNodeKey(*cfg.VaultRefreshToken, *cfg.VaultID, *cfg.VaultKeyID)
+		if nodeKey == nil {
+			return nil, fmt.Errorf("failed to fetch vault key %s", cfg.VaultKeyID.String())
+		}
+		return nodeKey, nil
+	}
+
+	return nil, fmt.Errorf("node key not found at %s; initialize the node or configure VAULT_KEY_ID", cfg.NodeKeyFile())
+}
+
+// ValidatorPubKey returns the validator public key of an initialized node
+func ValidatorPubKey(cfg *common.Config) (crypto.PubKey, error) {
+	switch {
+	case cfg.UsesKeystoreSigner():
+		return keystorePubKey(cfg)
+	case cfg.UsesRemoteSigner():
+		return nil, errors.New("the validator key is held by the remote signer")
+	}
+
+	path := filepath.Join(cfg.RootDir, validatorKeyFilePath)
+	if tmos.FileExists(path) {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		var validator *privval.Validator
+		err = tmjson.Unmarshal(raw, &validator)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse validator key %s; %s", path, err.Error())
+		}
+
+		if validator.PubKey == nil {
+			return nil, fmt.Errorf("validator key %s has no public key", path)
+		}
+
+		if cfg.VaultRefreshToken != nil {
+			validator.PubKey.VaultRefreshToken = *cfg.VaultRefreshToken
+		}
+
+		pubkey := validator.PubKey.Bytes()
+		if len(pubkey) != ed25519.PubKeySize {
+			return nil, fmt.Errorf("failed to resolve public key of validator key %s", path)
+		}
+
+		return ed25519.PubKey(pubkey), nil
+	}
+
+	if vaultConfigured(cfg) && cfg.VaultKeyID != nil {
+		key := ed25519.LoadVaultedPrivKey(*cfg.VaultRefreshToken, *cfg.VaultID, *cfg.VaultKeyID)
+		if key == nil {
+			return nil, fmt.Errorf("failed to fetch vault key %s", cfg.VaultKeyID.String())
+		}
+
+		pubkey := key.PubKey()
+		if pubkey == nil || len(pubkey.Bytes()) != ed25519.PubKeySize {
+			return nil, fmt.Errorf("failed to resolve public key of vault key %s", cfg.VaultKeyID.String())
+		}
+
+		return ed25519.PubKey(pubkey.Bytes()), nil
+	}
+
+	return nil, fmt.Errorf("validator key not found at %s; initialize the node or configure VAULT_KEY_ID", path)
+}
+
+// ValidatorSigningKey returns the validator key of an initialized node, with
+// which the node signs data other than consensus messages, e.g. its genesis
+// signature; the remote signer only signs consensus messages, so its key
+// cannot be used
+func ValidatorSigningKey(cfg *common.Config) (crypto.PrivKey, error) {
+	if cfg.UsesRemoteSigner() {
+		return nil, errors.New("the remote signer only signs consensus messages")
+	}
+
+	// the validator key is never generated here
+	_, err := ValidatorPubKey(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	validator, err := privValidatorFactory(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	key := validatorSigningKey(validator)
+	if key == nil {
+		return nil, fmt.Errorf("the %s signer does not provide a signing key", cfg.Signer)
+	}
+
+	return key, nil
+}
+
+// ResetNode removes the blockchain data, write-ahead log, address book and
+// application state of a node, which must not be running; the genesis, keys
+// and validator sign state are retained, so the node can safely sync again
+func ResetNode(cfg *common.Config) error {
+	err := os.RemoveAll(cfg.DBDir())
+	if err != nil {
+		return err
+	}
+
+	walFiles, err := filepath.Glob(cfg.Consensus.WalFile() + "*")
+	if err != nil {
+		return err
+	}
+
+	for _, path := range append(walFiles, cfg.P2P.AddrBookFile()) {
+		err = os.RemoveAll(path)
+		if err != nil {
+			return err
+		}
+	}
+
+	return protocol.ResetState(cfg)
+}
+
+func vaultConfigured(cfg *common.Config) bool {
+	return cfg.VaultRefreshToken != nil && *cfg.VaultRefreshToken != "" && cfg.VaultID != nil
+}
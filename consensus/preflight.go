@@ -0,0 +1,240 @@
+package consensus
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	uuid "github.com/kthomas/go.uuid"
+	"github.com/providenetwork/baseledger/common"
+	"github.com/providenetwork/tendermint/crypto/ed25519"
+	tmjson "github.com/providenetwork/tendermint/libs/json"
+	tmos "github.com/providenetwork/tendermint/libs/os"
+	"github.com/providenetwork/tendermint/node"
+	"github.com/providenetwork/tendermint/privval"
+	"github.com/provideplatform/provide-go/api/ident"
+	"github.com/provideplatform/provide-go/api/vault"
+)
+
+const validatorStateFilePath = "validator-state.json"
+
+const vaultKeySpecEd25519 = "ed25519"
+
+// maximum consensus step of a sign state; see privval
+const signStepPrecommit = 3
+
+// validatorPreflight checks that a validator node can sign safely before it
+// is started: the validator key must be reachable and Ed25519, and the last
+// sign state must be consistent; the remote signer holds both, so it is
+// checked by tendermint when it connects
+func validatorPreflight(cfg *common.Config) error {
+	switch {
+	case cfg.UsesKeystoreSigner():
+		return keystorePreflight(cfg)
+	case cfg.UsesRemoteSigner():
+		return nil
+	}
+
+	return vaultPreflight(cfg)
+}
+
+// keystorePreflight checks that the keystore, if any, can be decrypted
+func keystorePreflight(cfg *common.Config) error {
+	if tmos.FileExists(cfg.KeystoreFile) {
+		_, err := loadOrGenKeystoreKey(cfg)
+		if err != nil {
+			return err
+		}
+	} else {
+		common.Log.Infof("no keystore found at %s; a new validator key will be generated", cfg.KeystoreFile)
+	}
+
+	_, err := readSignState(cfg)
+	return err
+}
+
+// vaultPreflight checks that the vault key is reachable and Ed25519, and
+// matches the key of the validator
+func vaultPreflight(cfg *common.Config) error {
+	if !vaultConfigured(cfg) {
+		return errors.New("VAULT_REFRESH_TOKEN and VAULT_ID are required in validator mode")
+	}
+
+	keyID := cfg.VaultKeyID
+	var pubkey []byte
+
+	path := filepath.Join(cfg.RootDir, validatorKeyFilePath)
+	if tmos.FileExists(path) {
+		validator, err := readValidatorKey(path)
+		if err != nil {
+			return err
+		}
+
+		if keyID != nil && !uuid.Equal(*keyID, validator.VaultKeyID) {
+			return fmt.Errorf("validator key %s uses vault key %s, but VAULT_KEY_ID is %s", path, validator.VaultKeyID.String(), keyID.String())
+		}
+
+		keyID = &validator.VaultKeyID
+		if validator.PubKey != nil {
+			pubkey = validator.PubKey.PublicKey
+		}
+	}
+
+	token, err := ident.CreateToken(*cfg.VaultRefreshToken, map[string]interface{}{
+		"grant_type": "refresh_token",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to authorize vault access; %s", err.Error())
+	}
+
+	if keyID == nil {
+		common.Log.Infof("no validator key found at %s and VAULT_KEY_ID is not set; a new vault key will be generated", path)
+	} else {
+		key, err := vault.FetchKey(*token.AccessToken, cfg.VaultID.String(), keyID.String())
+		if err != nil {
+			return fmt.Errorf("failed to fetch validator vault key %s; %s", keyID.String(), err.Error())
+		}
+
+		err = checkVaultKey(key, pubkey)
+		if err != nil {
+			return fmt.Errorf("invalid validator vault key %s; %s", keyID.String(), err.Error())
+		}
+	}
+
+	_, err = readSignState(cfg)
+	return err
+}
+
+// checkVaultKey checks that the given vault key is an Ed25519 signing key
+// with the given public key, if any
+func checkVaultKey(key *vault.Key, pubkey []byte) error {
+	if key.Spec == nil || !strings.EqualFold(*key.Spec, vaultKeySpecEd25519) {
+		spec := ""
+		if key.Spec != nil {
+			spec = *key.Spec
+		}
+		return fmt.Errorf("key spec must be Ed25519; got %q", spec)
+	}
+
+	if key.PublicKey == nil {
+		return errors.New("key has no public key")
+	}
+
+	keyPubkey, err := hex.DecodeString(strings.TrimPrefix(*key.PublicKey, "0x"))
+	if err != nil || len(keyPubkey) != ed25519.PubKeySize {
+		return fmt.Errorf("public key must be a %d-byte hex-encoded Ed25519 public key; got %q", ed25519.PubKeySize, *key.PublicKey)
+	}
+
+	if len(pubkey) > 0 && !bytes.Equal(pubkey, keyPubkey) {
+		return fmt.Errorf("public key %X does not match the validator public key %X", keyPubkey, pubkey)
+	}
+
+	return nil
+}
+
+func readValidatorKey(path string) (*privval.Validator, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var validator *privval.Validator
+	err = tmjson.Unmarshal(raw, &validator)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse validator key %s; %s", path, err.Error())
+	}
+
+	return validator, nil
+}
+
+// readSignState returns the last sign state of the validator, or nil if it
+// has never signed; an inconsistent sign state is an error, as signing from
+// it could equivocate
+func readSignState(cfg *common.Config) (*privval.LastSignState, error) {
+	path := filepath.Join(cfg.RootDir, validatorStateFilePath)
+	if !tmos.FileExists(path) {
+		return nil, nil
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var state *privval.LastSignState
+	err = tmjson.Unmarshal(raw, &state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse validator sign state %s; %s", path, err.Error())
+	}
+
+	if state.Height < 0 || state.Round < 0 || state.Step < 0 || state.Step > signStepPrecommit {
+		return nil, fmt.Errorf("inconsistent validator sign state %s; invalid height %d, round %d or step %d", path, state.Height, state.Round, state.Step)
+	}
+
+	if (len(state.Signature) == 0) != (len(state.SignBytes) == 0) {
+		return nil, fmt.Errorf("inconsistent validator sign state %s; signature and sign bytes must be present together", path)
+	}
+
+	if state.Height > 0 && len(state.SignBytes) == 0 {
+		return nil, fmt.Errorf("inconsistent validator sign state %s; no sign bytes for last signed height %d", path, state.Height)
+	}
+
+	return state, nil
+}
+
+// checkValidatorState warns if the validator is not in the current validator
+// set of the given node, or if its last sign state does not fit the local
+// blockchain, e.g. after restoring either from a backup
+func checkValidatorState(cfg *common.Config, n *node.Node) {
+	pubkey, err := n.PrivValidator().GetPubKey()
+	if err == nil && pubkey == nil {
+		err = errors.New("no public key")
+	}
+	if err != nil {
+		common.Log.Warningf("failed to resolve validator public key; %s", err.Error())
+		return
+	}
+
+	height, validators := n.ConsensusState().GetValidators()
+
+	inSet := false
+	for _, validator := range validators {
+		if bytes.Equal(validator.Address, pubkey.Address()) {
+			inSet = true
+			break
+		}
+	}
+
+	if inSet {
+		common.Log.Infof("validator %s is in the validator set at height %d", pubkey.Address(), height)
+	} else {
+		common.Log.Warningf("validator %s is not in the validator set at height %d; it will not sign blocks until it is added", pubkey.Address(), height)
+	}
+
+	// the remote signer keeps its own sign state
+	if cfg.UsesRemoteSigner() {
+		return
+	}
+
+	state, err := readSignState(cfg)
+	if err != nil {
+		common.Log.Warningf("%s", err.Error())
+		return
+	}
+
+	blockHeight := n.BlockStore().Height()
+	if state == nil || state.Height == 0 {
+		if blockHeight > 0 && cfg.Consensus.DoubleSignCheckHeight == 0 {
+			common.Log.Warningf("validator has no sign state but the blockchain is at height %d; if %s was lost or restored, set BASELEDGER_DOUBLE_SIGN_CHECK_HEIGHT to guard against signing twice", blockHeight, validatorStateFilePath)
+		}
+		return
+	}
+
+	if state.Height > blockHeight+1 {
+		common.Log.Warningf("validator last signed height %d, which is ahead of the blockchain at height %d; it will not sign until the node catches up", state.Height, blockHeight)
+	}
+}
@@ -0,0 +1,91 @@
+package consensus
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/providenetwork/baseledger/common"
+	"github.com/providenetwork/tendermint/crypto/ed25519"
+	tmjson "github.com/providenetwork/tendermint/libs/json"
+	"github.com/providenetwork/tendermint/privval"
+	"github.com/provideplatform/provide-go/api/vault"
+)
+
+func TestCheckVaultKey(t *testing.T) {
+	pubkey := ed25519.GenPrivKey().PubKey().Bytes()
+	encoded := hex.EncodeToString(pubkey)
+
+	tests := []struct {
+		name   string
+		spec   *string
+		key    *string
+		pubkey []byte
+		err    bool
+	}{
+		{name: "ed25519 key", spec: common.StringOrNil("Ed25519"), key: common.StringOrNil(encoded)},
+		{name: "0x-prefixed public key", spec: common.StringOrNil("ed25519"), key: common.StringOrNil("0x" + encoded), pubkey: pubkey},
+		{name: "validator public key", spec: common.StringOrNil("Ed25519"), key: common.StringOrNil(strings.ToUpper(encoded)), pubkey: pubkey},
+		{name: "other validator public key", spec: common.StringOrNil("Ed25519"), key: common.StringOrNil(encoded), pubkey: ed25519.GenPrivKey().PubKey().Bytes(), err: true},
+		{name: "secp256k1 key", spec: common.StringOrNil("secp256k1"), key: common.StringOrNil(encoded), err: true},
+		{name: "no key spec", key: common.StringOrNil(encoded), err: true},
+		{name: "no public key", spec: common.StringOrNil("Ed25519"), err: true},
+		{name: "short public key", spec: common.StringOrNil("Ed25519"), key: common.StringOrNil(encoded[2:]), err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkVaultKey(&vault.Key{Spec: test.spec, PublicKey: test.key}, test.pubkey)
+			if (err != nil) != test.err {
+				t.Fatalf("expected error: %v; got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestReadSignState(t *testing.T) {
+	tests := []struct {
+		name  string
+		state *privval.LastSignState // nil if the validator has never signed
+		err   bool
+	}{
+		{name: "never signed"},
+		{name: "initial sign state", state: &privval.LastSignState{}},
+		{name: "signed precommit", state: &privval.LastSignState{Height: 10, Round: 1, Step: signStepPrecommit, Signature: []byte{1}, SignBytes: []byte{2}}},
+		{name: "negative height", state: &privval.LastSignState{Height: -1}, err: true},
+		{name: "negative round", state: &privval.LastSignState{Height: 10, Round: -1, Signature: []byte{1}, SignBytes: []byte{2}}, err: true},
+		{name: "unknown step", state: &privval.LastSignState{Height: 10, Step: signStepPrecommit + 1, Signature: []byte{1}, SignBytes: []byte{2}}, err: true},
+		{name: "signature without sign bytes", state: &privval.LastSignState{Height: 10, Step: 1, Signature: []byte{1}}, err: true},
+		{name: "signed height without sign bytes", state: &privval.LastSignState{Height: 10, Step: 1}, err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := &common.Config{}
+			cfg.RootDir = t.TempDir()
+
+			if test.state != nil {
+				raw, err := tmjson.Marshal(test.state)
+				if err != nil {
+					t.Fatalf("failed to marshal sign state; %s", err.Error())
+				}
+
+				err = os.WriteFile(filepath.Join(cfg.RootDir, validatorStateFilePath), raw, 0600)
+				if err != nil {
+					t.Fatalf("failed to write sign state; %s", err.Error())
+				}
+			}
+
+			state, err := readSignState(cfg)
+			if (err != nil) != test.err {
+				t.Fatalf("expected error: %v; got %v", test.err, err)
+			}
+
+			if err == nil && (state == nil) != (test.state == nil) {
+				t.Fatalf("expected sign state: %v", test.state != nil)
+			}
+		})
+	}
+}
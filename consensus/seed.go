@@ -0,0 +1,179 @@
+package consensus
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/providenetwork/baseledger/common"
+	"github.com/providenetwork/tendermint/libs/log"
+	"github.com/providenetwork/tendermint/libs/service"
+	"github.com/providenetwork/tendermint/p2p"
+	"github.com/providenetwork/tendermint/p2p/pex"
+	"github.com/providenetwork/tendermint/version"
+)
+
+// defaultSeedDisconnectWaitPeriod is how long a seed waits before
+// disconnecting a peer, as in tendermint
+const defaultSeedDisconnectWaitPeriod = 28 * time.Hour
+
+// seedNode is a minimal node which runs only the p2p switch and the
+// peer-exchange reactor in seed mode; it crawls the network and hands out
+// peer addresses, but has no blockchain data, application state or
+// validator key, and does not depend on vault, provide or the genesis
+type seedNode struct {
+	service.BaseService
+
+	cfg       *common.Config
+	nodeKey   *p2p.NodeKey
+	sw        *p2p.Switch
+	transport *p2p.MultiplexTransport
+}
+
+// InitSeedNode initializes the p2p key of a seed node without starting it
+func InitSeedNode(cfg *common.Config) (*p2p.NodeKey, error) {
+	nodeKey, err := p2p.LoadOrGenNodeKey(cfg.NodeKeyFile(), "", nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize node key; %s", err.Error())
+	}
+
+	return nodeKey, nil
+}
+
+func seedNodeFactory(cfg *common.Config, logger log.Logger) (*seedNode, error) {
+	nodeKey, err := InitSeedNode(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	listenAddress := cfg.P2P.ExternalAddress
+	if listenAddress == "" {
+		listenAddress = cfg.P2P.ListenAddress
+	}
+
+	// peers only require a matching network and block protocol, and a
+	// channel in common, to exchange addresses with a seed
+	nodeInfo := p2p.DefaultNodeInfo{
+		ProtocolVersion: p2p.NewProtocolVersion(version.P2PProtocol, version.BlockProtocol, defaultGenesisAppVersion),
+		DefaultNodeID:   nodeKey.ID(),
+		ListenAddr:      listenAddress,
+		Network:         cfg.ChainID,
+		Version:         version.TMCoreSemVer,
+		Channels:        []byte{pex.PexChannel},
+		Moniker:         cfg.Moniker,
+		Other: p2p.DefaultNodeInfoOther{
+			TxIndex: "off",
+		},
+	}
+
+	err = nodeInfo.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid seed node info; %s", err.Error())
+	}
+
+	p2pLogger := logger.With("module", "p2p")
+
+	transport := p2p.NewMultiplexTransport(nodeInfo, *nodeKey, p2p.MConnConfig(cfg.P2P))
+	if !cfg.P2P.AllowDuplicateIP {
+		p2p.MultiplexTransportConnFilters(p2p.ConnDuplicateIPFilter())(transport)
+	}
+	p2p.MultiplexTransportMaxIncomingConnections(cfg.P2P.MaxNumInboundPeers)(transport)
+
+	sw := p2p.NewSwitch(cfg.P2P, transport)
+	sw.SetLogger(p2pLogger)
+	sw.SetNodeInfo(nodeInfo)
+	sw.SetNodeKey(nodeKey)
+
+	err = sw.AddPersistentPeers(splitPeers(cfg.P2P.PersistentPeers))
+	if err != nil {
+		return nil, fmt.Errorf("invalid persistent peers; %s", err.Error())
+	}
+
+	addrBook := pex.NewAddrBook(cfg.P2P.AddrBookFile(), cfg.P2P.AddrBookStrict)
+	addrBook.SetLogger(p2pLogger.With("book", cfg.P2P.AddrBookFile()))
+	for _, addr := range []string{cfg.P2P.ExternalAddress, cfg.P2P.ListenAddress} {
+		if addr == "" {
+			continue
+		}
+
+		netAddr, err := p2p.NewNetAddressString(p2p.IDAddressString(nodeKey.ID(), addr))
+		if err != nil {
+			return nil, fmt.Errorf("invalid peer address %s; %s", addr, err.Error())
+		}
+
+		// prevent dialing ourselves
+		addrBook.AddOurAddress(netAddr)
+	}
+	sw.SetAddrBook(addrBook)
+
+	err = sw.AddPrivatePeerIDs(splitPeers(cfg.P2P.PrivatePeerIDs))
+	if err != nil {
+		return nil, fmt.Errorf("invalid private peer ids; %s", err.Error())
+	}
+
+	pexReactor := pex.NewReactor(addrBook, &pex.ReactorConfig{
+		Seeds:                        splitPeers(cfg.P2P.Seeds),
+		SeedMode:                     true,
+		SeedDisconnectWaitPeriod:     defaultSeedDisconnectWaitPeriod,
+		PersistentPeersMaxDialPeriod: cfg.P2P.PersistentPeersMaxDialPeriod,
+	})
+	pexReactor.SetLogger(logger.With("module", "pex"))
+	sw.AddReactor("PEX", pexReactor)
+
+	node := &seedNode{
+		cfg:       cfg,
+		nodeKey:   nodeKey,
+		sw:        sw,
+		transport: transport,
+	}
+	node.BaseService = *service.NewBaseService(logger, "SeedNode", node)
+
+	return node, nil
+}
+
+// OnStart listens for peers and starts the switch
+func (n *seedNode) OnStart() error {
+	addr, err := p2p.NewNetAddressString(p2p.IDAddressString(n.nodeKey.ID(), n.cfg.P2P.ListenAddress))
+	if err != nil {
+		return err
+	}
+
+	err = n.transport.Listen(*addr)
+	if err != nil {
+		return err
+	}
+
+	err = n.sw.Start()
+	if err != nil {
+		return err
+	}
+
+	common.Log.Infof("started seed node %s listening on %s", n.nodeKey.ID(), n.cfg.P2P.ListenAddress)
+	return n.sw.DialPeersAsync(splitPeers(n.cfg.P2P.PersistentPeers))
+}
+
+// OnStop stops the switch and closes the transport
+func (n *seedNode) OnStop() {
+	err := n.sw.Stop()
+	if err != nil {
+		common.Log.Warningf("failed to stop seed node switch; %s", err.Error())
+	}
+
+	err = n.transport.Close()
+	if err != nil {
+		common.Log.Warningf("failed to close seed node transport; %s", err.Error())
+	}
+}
+
+// splitPeers splits a comma-separated list of peers or peer ids
+func splitPeers(peers string) []string {
+	split := make([]string, 0)
+	for _, peer := range strings.Split(peers, ",") {
+		peer = strings.TrimSpace(peer)
+		if peer != "" {
+			split = append(split, peer)
+		}
+	}
+
+	return split
+}
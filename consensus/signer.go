@@ -0,0 +1,170 @@
+package consensus
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/providenetwork/baseledger/common"
+	"github.com/providenetwork/tendermint/crypto"
+	"github.com/providenetwork/tendermint/crypto/ed25519"
+	tmjson "github.com/providenetwork/tendermint/libs/json"
+	tmos "github.com/providenetwork/tendermint/libs/os"
+	"github.com/providenetwork/tendermint/p2p"
+	"github.com/providenetwork/tendermint/privval"
+	"github.com/providenetwork/tendermint/types"
+)
+
+// privValidatorFactory returns the signer of the validator key of a node;
+// the remote signer connects to tendermint once the node has started, so
+// no signer is returned for it
+func privValidatorFactory(cfg *common.Config) (types.PrivValidator, error) {
+	switch {
+	case cfg.UsesVaultSigner():
+		return vaultValidator(cfg)
+	case cfg.UsesKeystoreSigner():
+		return keystoreValidator(cfg)
+	case cfg.UsesRemoteSigner():
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("unsupported signer: %s", cfg.Signer)
+}
+
+// validatorSigningKey returns the key of the given validator signer, which
+// the node signs its own transactions with, or nil for the remote signer
+func validatorSigningKey(validator types.PrivValidator) crypto.PrivKey {
+	switch signer := validator.(type) {
+	case *privval.Validator:
+		if signer.PrivKey != nil {
+			return signer.PrivKey
+		}
+	case *privval.FilePV:
+		return signer.Key.PrivKey
+	}
+
+	return nil
+}
+
+// vaultValidator loads the validator key held by vault, generating it if
+// necessary
+func vaultValidator(cfg *common.Config) (*privval.Validator, error) {
+	if !vaultConfigured(cfg) {
+		return nil, errors.New("VAULT_REFRESH_TOKEN and VAULT_ID are required by the vault signer")
+	}
+
+	validator, err := privval.LoadOrGenValidator(cfg.RootDir, *cfg.VaultRefreshToken, *cfg.VaultID, cfg.VaultKeyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load vault validator key; %s", err.Error())
+	}
+
+	// the refresh token is not persisted with the validator key
+	validator.VaultRefreshToken = *cfg.VaultRefreshToken
+	if validator.PrivKey != nil {
+		validator.PrivKey.VaultRefreshToken = *cfg.VaultRefreshToken
+	}
+	if validator.PubKey != nil {
+		validator.PubKey.VaultRefreshToken = *cfg.VaultRefreshToken
+	}
+
+	return validator, nil
+}
+
+// keystoreValidator decrypts the validator key held by the local keystore,
+// generating it if necessary; the last sign state is shared with the other
+// signers, so double-sign protection survives a change of signer
+func keystoreValidator(cfg *common.Config) (*privval.FilePV, error) {
+	privKey, err := loadOrGenKeystoreKey(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	statePath := cfg.PrivValidatorStateFile()
+	validator := privval.NewFilePV(privKey, "", statePath)
+
+	if tmos.FileExists(statePath) {
+		raw, err := os.ReadFile(statePath)
+		if err != nil {
+			return nil, err
+		}
+
+		// keep the state file path set by NewFilePV
+		var state privval.FilePVLastSignState
+		err = tmjson.Unmarshal(raw, &state)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse validator sign state %s; %s", statePath, err.Error())
+		}
+
+		validator.LastSignState.Height = state.Height
+		validator.LastSignState.Round = state.Round
+		validator.LastSignState.Step = state.Step
+		validator.LastSignState.Signature = state.Signature
+		validator.LastSignState.SignBytes = state.SignBytes
+	}
+
+	return validator, nil
+}
+
+func loadOrGenKeystoreKey(cfg *common.Config) (ed25519.PrivKey, error) {
+	if cfg.KeystorePassphrase == nil {
+		return nil, errors.New("BASELEDGER_KEYSTORE_PASSPHRASE or BASELEDGER_KEYSTORE_PASSPHRASE_FILE is required by the keystore signer")
+	}
+
+	if !tmos.FileExists(cfg.KeystoreFile) {
+		privKey := ed25519.GenPrivKey()
+		keystore, err := EncryptKeystore(privKey, *cfg.KeystorePassphrase)
+		if err != nil {
+			return nil, err
+		}
+
+		err = WriteKeystore(cfg.KeystoreFile, keystore)
+		if err != nil {
+			return nil, err
+		}
+
+		common.Log.Infof("generated validator key %s in keystore %s", keystore.Address, cfg.KeystoreFile)
+		return privKey, nil
+	}
+
+	keystore, err := ReadKeystore(cfg.KeystoreFile)
+	if err != nil {
+		return nil, err
+	}
+
+	privKey, err := keystore.Decrypt(*cfg.KeystorePassphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt keystore %s; %s", cfg.KeystoreFile, err.Error())
+	}
+
+	return privKey, nil
+}
+
+// keystorePubKey returns the public key of the local keystore, which does
+// not require the passphrase
+func keystorePubKey(cfg *common.Config) (crypto.PubKey, error) {
+	if !tmos.FileExists(cfg.KeystoreFile) {
+		return nil, fmt.Errorf("keystore not found at %s; initialize the node or import a key", cfg.KeystoreFile)
+	}
+
+	keystore, err := ReadKeystore(cfg.KeystoreFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if keystore.PubKey == nil {
+		return nil, fmt.Errorf("keystore %s has no public key", cfg.KeystoreFile)
+	}
+
+	return keystore.PubKey, nil
+}
+
+// nodeKeyFactory loads the p2p key of a node, generating it if necessary;
+// the node key is held by vault when the validator key is, and is otherwise
+// kept in a local file
+func nodeKeyFactory(cfg *common.Config) (*p2p.NodeKey, error) {
+	if cfg.UsesVaultSigner() && vaultConfigured(cfg) {
+		return p2p.LoadOrGenNodeKey(cfg.NodeKeyFile(), *cfg.VaultRefreshToken, cfg.VaultID, cfg.VaultKeyID)
+	}
+
+	return p2p.LoadOrGenNodeKey(cfg.NodeKeyFile(), "", nil, nil)
+}
@@ -7,8 +7,9 @@ import (
 	"github.com/providenetwork/baseledger/protocol"
 	"github.com/providenetwork/tendermint/libs/log"
 	"github.com/providenetwork/tendermint/libs/service"
+	"github.com/providenetwork/tendermint/mempool"
 	"github.com/providenetwork/tendermint/node"
-	"github.com/providenetwork/tendermint/proxy"
+	"github.com/providenetwork/tendermint/p2p"
 	"github.com/providenetwork/tendermint/types"
 )
 
@@ -20,28 +21,49 @@ type Tendermint struct {
 }
 
 // TendermintFactory initializes and returns the baseledger tendermint consensus service
-func TendermintFactory() (*Tendermint, error) {
-	cfg, err := common.ConfigFactory()
-	if err != nil {
-		return nil, fmt.Errorf("failed to initialize baseledger core consensus; failed to load configuration; %s", err.Error())
-	}
-
+func TendermintFactory(cfg *common.Config) (*Tendermint, error) {
 	logger, err := LogFactory(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize baseledger core consensus; failed to initialize logger; %s", err.Error())
 	}
 
+	if cfg.IsSeedNode() {
+		return seedFactory(cfg, logger)
+	}
+
 	genesis, err := GenesisFactory(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize baseledger core consensus; failed to initialize genesis; %s", err.Error())
 	}
 
-	baseline, err := protocol.BaselineProtocolFactory(cfg, genesis)
+	if cfg.IsValidatorNode() {
+		err = validatorPreflight(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize baseledger core consensus; validator preflight failed; %s", err.Error())
+		}
+	}
+
+	err = cfg.DiscoverPeerAddress()
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize baseledger core consensus; %s", err.Error())
+	}
+
+	nodeKey, err := nodeKeyFactory(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize baseledger core consensus; failed to load or generate node key %s; %s", cfg.NodeKeyFile(), err.Error())
+	}
+
+	pval, err := privValidatorFactory(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize baseledger core consensus; %s", err.Error())
+	}
+
+	baseline, err := protocol.BaselineProtocolFactory(cfg, genesis, validatorSigningKey(pval), nodeKey)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize baseledger core consensus; failed to initialize baseline protocol service implementation; %s", err.Error())
 	}
 
-	service, err := initTendermint(cfg, logger, genesis, baseline)
+	service, err := initTendermint(cfg, logger, genesis, baseline, nodeKey, pval)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize baseledger core consensus; %s", err.Error())
 	}
@@ -54,6 +76,25 @@ func TendermintFactory() (*Tendermint, error) {
 	}, nil
 }
 
+// seedFactory initializes and returns a seed node, which runs neither the
+// baseline protocol nor consensus
+func seedFactory(cfg *common.Config, logger *log.Logger) (*Tendermint, error) {
+	err := cfg.DiscoverPeerAddress()
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize baseledger seed node; %s", err.Error())
+	}
+
+	seed, err := seedNodeFactory(cfg, *logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize baseledger seed node; %s", err.Error())
+	}
+
+	return &Tendermint{
+		logger:  logger,
+		service: seed,
+	}, nil
+}
+
 // Start attempts to start the consensus engine
 func (t *Tendermint) Start() error {
 	err := t.service.Start()
@@ -65,6 +106,16 @@ func (t *Tendermint) Start() error {
 	return nil
 }
 
+// Halted returns a channel which receives the reason the node must halt;
+// seed nodes never halt
+func (t *Tendermint) Halted() <-chan string {
+	if t.baseline == nil {
+		return nil
+	}
+
+	return t.baseline.Halted()
+}
+
 // Stop gracefully stops the consensus engine
 func (t *Tendermint) Stop() {
 	defer func() {
@@ -73,7 +124,9 @@ func (t *Tendermint) Stop() {
 		}
 	}()
 
-	t.baseline.Shutdown()
+	if t.baseline != nil {
+		t.baseline.Shutdown()
+	}
 	t.service.Stop()
 }
 
@@ -82,16 +135,54 @@ func initTendermint(
 	logger *log.Logger,
 	genesis *types.GenesisDoc,
 	baseline *protocol.Baseline,
+	nodeKey *p2p.NodeKey,
+	pval types.PrivValidator,
 ) (service.Service, error) {
-	service, err := node.New(
+	clientCreator := haltingClientCreatorFactory(baseline)
+	n, err := node.NewNode(
 		&cfg.Config,
+		pval,
+		nodeKey,
+		clientCreator,
+		func() (*types.GenesisDoc, error) { return genesis, nil },
+		node.DefaultDBProvider,
+		node.DefaultMetricsProvider(cfg.Instrumentation),
 		*logger,
-		proxy.NewLocalClientCreator(baseline),
-		genesis,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize baseledger node: %s", err.Error())
 	}
 
-	return service, nil
+	baseline.BroadcastTx = func(tx []byte) error {
+		return n.Mempool().CheckTx(tx, nil, mempool.TxInfo{})
+	}
+
+	clientCreator.fastSyncing = n.ConsensusReactor().WaitSync
+
+	// blocks are executed by the blockchain reactor while fast syncing, and
+	// by consensus afterwards; a routine which starts another block once the
+	// node halts is refused by the ABCI client, so neither commits it
+	baseline.StopConsensus = func() {
+		if n.ConsensusReactor().WaitSync() {
+			err := n.Switch().Reactor("BLOCKCHAIN").Stop()
+			if err != nil {
+				common.Log.Warningf("failed to stop fast sync; %s", err.Error())
+			}
+		}
+
+		consensusState := n.ConsensusState()
+		if consensusState.IsRunning() {
+			err := consensusState.Stop()
+			if err != nil {
+				common.Log.Warningf("failed to stop consensus; %s", err.Error())
+			}
+			consensusState.Wait()
+		}
+	}
+
+	if cfg.IsValidatorNode() {
+		checkValidatorState(cfg, n)
+	}
+
+	return n, nil
 }
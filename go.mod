@@ -20,6 +20,7 @@ require (
 	github.com/lib/pq v1.10.2 // indirect
 	github.com/minio/highwayhash v1.0.2 // indirect
 	github.com/nats-io/nats.go v1.11.0
+	github.com/oasisprotocol/curve25519-voi v0.0.0-20210816150552-4da56de5ed17
 	github.com/onsi/ginkgo v1.16.1 // indirect
 	github.com/onsi/gomega v1.11.0 // indirect
 	github.com/opencontainers/go-digest v1.0.0-rc1 // indirect
@@ -27,5 +28,6 @@ require (
 	github.com/providenetwork/tendermint v0.34.11-0.20210817071358-d1046c6c13ba
 	github.com/provideplatform/provide-go v0.0.0-20210823190919-440948fc25cf
 	github.com/rs/cors v1.8.0 // indirect
+	golang.org/x/crypto v0.0.0-20210813211128-0a44fdfbc16e
 	google.golang.org/grpc v1.39.1 // indirect
 )
@@ -0,0 +1,72 @@
+package protocol
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const stateKeyPrefixAccounts = "accounts/"
+
+// Account is an initial account balance configured in the genesis app_state
+type Account struct {
+	Address string `json:"address"`
+	Balance int64  `json:"balance"`
+}
+
+func accountStateKey(address string) string {
+	return fmt.Sprintf("%s%s", stateKeyPrefixAccounts, address)
+}
+
+// normalizeAccountAddress returns the upper-case hex encoding of the given
+// 20-byte account address, the encoding used for validator addresses
+func normalizeAccountAddress(address string) (string, error) {
+	addr := strings.ToUpper(strings.TrimSpace(address))
+	raw, err := hex.DecodeString(addr)
+	if err != nil || len(raw) != 20 {
+		return "", fmt.Errorf("invalid account address: %s", address)
+	}
+
+	return addr, nil
+}
+
+// validateAccounts validates the genesis accounts; each account requires a
+// well-formed address, which is not repeated, and a non-negative balance
+func validateAccounts(accounts []*Account) error {
+	addresses := map[string]bool{}
+	for _, account := range accounts {
+		if account == nil {
+			return errors.New("nil genesis account")
+		}
+
+		address, err := normalizeAccountAddress(account.Address)
+		if err != nil {
+			return fmt.Errorf("invalid genesis account; %s", err.Error())
+		}
+
+		if account.Balance < 0 {
+			return fmt.Errorf("genesis account %s requires a non-negative balance", address)
+		}
+
+		if addresses[address] {
+			return fmt.Errorf("duplicate genesis account: %s", address)
+		}
+		addresses[address] = true
+	}
+
+	return nil
+}
+
+// importAccounts sets the balances of the given genesis accounts, which must
+// have been validated
+func (s *State) importAccounts(accounts []*Account) {
+	if s.Accounts == nil {
+		s.Accounts = map[string]int64{}
+	}
+
+	for _, account := range accounts {
+		address, _ := normalizeAccountAddress(account.Address)
+		s.Accounts[address] = account.Balance
+	}
+}
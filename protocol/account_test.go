@@ -0,0 +1,90 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	abcitypes "github.com/providenetwork/tendermint/abci/types"
+	"github.com/providenetwork/tendermint/crypto/ed25519"
+	"github.com/providenetwork/tendermint/types"
+)
+
+func TestValidateAccounts(t *testing.T) {
+	address := ed25519.GenPrivKey().PubKey().Address().String()
+
+	tests := []struct {
+		name     string
+		accounts []*Account
+		valid    bool
+	}{
+		{name: "no accounts", valid: true},
+		{name: "one account", accounts: []*Account{{Address: address, Balance: 100}}, valid: true},
+		{name: "zero balance", accounts: []*Account{{Address: address}}, valid: true},
+		{name: "lower-case address", accounts: []*Account{{Address: strings.ToLower(address), Balance: 1}}, valid: true},
+		{name: "negative balance", accounts: []*Account{{Address: address, Balance: -1}}},
+		{name: "malformed address", accounts: []*Account{{Address: "not-an-address", Balance: 1}}},
+		{name: "short address", accounts: []*Account{{Address: address[:38], Balance: 1}}},
+		{name: "nil account", accounts: []*Account{nil}},
+		{
+			name: "duplicate address",
+			accounts: []*Account{
+				{Address: address, Balance: 1},
+				{Address: strings.ToLower(address), Balance: 2},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateAccounts(test.accounts)
+			if test.valid && err != nil {
+				t.Fatalf("expected accounts to be valid; %s", err.Error())
+			}
+
+			if !test.valid && err == nil {
+				t.Fatal("expected accounts to be invalid")
+			}
+		})
+	}
+}
+
+func TestInitChainAccounts(t *testing.T) {
+	validatorKey := ed25519.GenPrivKey()
+	address := ed25519.GenPrivKey().PubKey().Address().String()
+
+	initChain := func(t *testing.T, accounts []*Account) *Baseline {
+		appState, _ := json.Marshal(&StateParams{Accounts: accounts})
+		b := testBaseline()
+		b.Genesis = &types.GenesisDoc{ChainID: testChainID, AppState: appState}
+
+		_, err := b.initChain(abcitypes.RequestInitChain{
+			ChainId:       testChainID,
+			AppStateBytes: appState,
+			Validators: []abcitypes.ValidatorUpdate{
+				abcitypes.Ed25519ValidatorUpdate(validatorKey.PubKey().Bytes(), 10),
+			},
+		})
+		if err != nil {
+			t.Fatalf("failed to initialize chain; %s", err.Error())
+		}
+
+		return b
+	}
+
+	b := initChain(t, []*Account{{Address: strings.ToLower(address), Balance: 100}})
+	if balance, ok := b.DeliverTxState.Accounts[address]; !ok || balance != 100 {
+		t.Fatalf("expected account %s to hold a balance of 100; got %d", address, balance)
+	}
+
+	root, err := b.DeliverTxState.calculateRoot()
+	if err != nil {
+		t.Fatalf("failed to calculate state root; %s", err.Error())
+	}
+
+	other, _ := initChain(t, []*Account{{Address: address, Balance: 101}}).DeliverTxState.calculateRoot()
+	if bytes.Equal(root, other) {
+		t.Fatal("expected the genesis state root to commit to the account balances")
+	}
+}
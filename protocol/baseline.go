@@ -1,12 +1,20 @@
 package protocol
 
 import (
+	"bytes"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/providenetwork/baseledger/common"
 	abcitypes "github.com/providenetwork/tendermint/abci/types"
+	"github.com/providenetwork/tendermint/crypto"
+	"github.com/providenetwork/tendermint/crypto/ed25519"
+	"github.com/providenetwork/tendermint/p2p"
 	"github.com/providenetwork/tendermint/types"
 )
 
@@ -34,11 +42,35 @@ type Baseline struct {
 	DeliverTxState *State
 	CommitState    *State
 
-	mutex         *sync.Mutex
-	queryHandlers *QueryHandlers
+	// BroadcastTx submits a locally-generated transaction to the mempool
+	BroadcastTx func(tx []byte) error
+
+	// StopConsensus stops the services executing blocks and waits for them
+	// to stop; it is called on its own routine once the node must halt, and
+	// the node is signalled to halt when it returns
+	StopConsensus func()
+
+	blockTime      time.Time
+	entropyProver  *entropyProver
+	halt           chan string
+	halting        bool
+	mutex          *sync.Mutex
+	peerReputation *peerReputationStore
+	queryHandlers  *QueryHandlers
+	stateHistory   *stateHistory
+
+	entropyKeyRegistrationHeight int64
+
+	nodeKey                *p2p.NodeKey
+	nodeRegistrationHeight int64
+	validatorKey           crypto.PrivKey
 }
 
-func BaselineProtocolFactory(cfg *common.Config, genesis *types.GenesisDoc) (*Baseline, error) {
+// BaselineProtocolFactory returns the baseline protocol application; a
+// validator node gives the key of its validator signer, which is nil for the
+// remote signer, to sign the transactions it dispatches itself, and its p2p
+// node key, so it can register the node ID by which peers know its node
+func BaselineProtocolFactory(cfg *common.Config, genesis *types.GenesisDoc, validatorKey crypto.PrivKey, nodeKey *p2p.NodeKey) (*Baseline, error) {
 	service, err := serviceFactory(cfg, genesis)
 	if err != nil {
 		return nil, err
@@ -59,6 +91,54 @@ func BaselineProtocolFactory(cfg *common.Config, genesis *types.GenesisDoc) (*Ba
 		return nil, fmt.Errorf("failed to initialize ABCI commit state; %s", err.Error())
 	}
 
+	// uncommitted block execution is replayed by tendermint; always resume
+	// from the last committed state
+	err = checkTxState.sync(commitState)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize ABCI check tx state; %s", err.Error())
+	}
+
+	err = deliverTxState.sync(commitState)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize ABCI deliver tx state; %s", err.Error())
+	}
+
+	// the validator set of a network whose genesis configures a staking
+	// contract follows the staking deltas observed by the service; a node
+	// without the service would fork from the network
+	if commitState.Staking != nil && service == nil {
+		return nil, errors.New("the genesis configures a staking contract, so the baseline protocol service is required; configure PROVIDE_REFRESH_TOKEN")
+	}
+
+	err = checkAppVersion(commitState)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.HaltHeight > 0 && commitState.Height >= cfg.HaltHeight {
+		return nil, fmt.Errorf("halt height %d has been reached; last committed height is %d", cfg.HaltHeight, commitState.Height)
+	}
+
+	stateHistory, err := stateHistoryFactory(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize ABCI state history; %s", err.Error())
+	}
+
+	peerReputation, err := peerReputationStoreFactory(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize peer reputation; %s", err.Error())
+	}
+
+	peerPolicy, err := peerPolicyEngineFactory(cfg, peerReputation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize peer policy; %s", err.Error())
+	}
+
+	entropyProver, err := entropyProverFactory(cfg, validatorKey)
+	if err != nil {
+		common.Log.Warningf("random beacon entropy will not be proposed by this node; %s", err.Error())
+	}
+
 	return &Baseline{
 		Config:  cfg,
 		Genesis: genesis,
@@ -69,13 +149,20 @@ func BaselineProtocolFactory(cfg *common.Config, genesis *types.GenesisDoc) (*Ba
 		DeliverTxState: deliverTxState,
 		CommitState:    commitState,
 
-		mutex:         &sync.Mutex{},
-		queryHandlers: queryHandlersFactory(),
+		entropyProver:  entropyProver,
+		halt:           make(chan string, 1),
+		mutex:          &sync.Mutex{},
+		peerReputation: peerReputation,
+		queryHandlers:  queryHandlersFactory(peerPolicy),
+		stateHistory:   stateHistory,
+
+		nodeKey:      nodeKey,
+		validatorKey: validatorKey,
 	}, nil
 }
 
 func (b *Baseline) ApplySnapshotChunk(req abcitypes.RequestApplySnapshotChunk) abcitypes.ResponseApplySnapshotChunk {
-	common.Log.Debugf("ApplySnapshotChunk; %s", req)
+	common.Log.Debugf("ApplySnapshotChunk; %v", req)
 	return abcitypes.ResponseApplySnapshotChunk{}
 }
 
@@ -83,6 +170,20 @@ func (b *Baseline) BeginBlock(req abcitypes.RequestBeginBlock) abcitypes.Respons
 	common.Log.Debugf("BeginBlock; %v", req)
 	resp := abcitypes.ResponseBeginBlock{}
 
+	// consensus refuses to start blocks once the node halts; a block which
+	// is started regardless is not executed, and leaves the state untouched
+	if b.halting {
+		common.Log.Warningf("refusing to execute block %d; the node halted at height %d", req.Header.Height, b.CommitState.Height)
+		return resp
+	}
+
+	b.blockTime = req.Header.Time
+
+	err := b.DeliverTxState.applyUpgrade(req.Header.Height)
+	if err != nil {
+		common.Log.Panicf("refusing to execute block %d; %s", req.Header.Height, err.Error())
+	}
+
 	rawHeader, err := json.Marshal(req.Header)
 	if err == nil {
 		resp.Events = append(resp.Events, abcitypes.Event{
@@ -96,43 +197,177 @@ func (b *Baseline) BeginBlock(req abcitypes.RequestBeginBlock) abcitypes.Respons
 		})
 	}
 
+	b.requestRandomBeaconEntropy(req)
+	b.recordMisbehavior(req)
+
 	return resp
 }
 
 func (b *Baseline) CheckTx(req abcitypes.RequestCheckTx) abcitypes.ResponseCheckTx {
 	tx, _ := TransactionFromRaw(req.Tx)
-	code := tx.isValid()
+	code := tx.isValid(b.Genesis.ChainID)
+	if code != transactionStatusCodeValid || tx.Opcode == nil {
+		return abcitypes.ResponseCheckTx{
+			Code:      code,
+			GasWanted: tx.calculateGas(),
+		}
+	}
+
+	code, err := b.checkTx(tx)
+	if err != nil {
+		return abcitypes.ResponseCheckTx{
+			Code: code,
+			Log:  err.Error(),
+		}
+	}
+
 	return abcitypes.ResponseCheckTx{
 		Code:      code,
 		GasWanted: tx.calculateGas(),
 	}
 }
 
-func (b Baseline) Commit() abcitypes.ResponseCommit {
-	b.CommitState.Height++
-	b.CommitState.Save() // TODO-- buffer this
+// checkTx authorizes the given well-formed transaction against the check tx
+// state, so transactions which cannot be delivered are kept out of the
+// mempool; signed transactions must be signed by a staked validator with its
+// next nonce, which is advanced in the check tx state so the validator can
+// submit several transactions in a block. Entropy is checked against the key
+// of the proposer, as its request may not be committed yet
+func (b *Baseline) checkTx(tx *Transaction) (uint32, error) {
+	if *tx.Opcode == transactionOpcodeEntropy {
+		entropy, _ := tx.entropy()
+		err := entropy.verifySignature(b.CheckTxState.GetValidator([]byte(entropy.Proposer)))
+		if err != nil {
+			return transactionStatusCodeInvalidEntropy, err
+		}
+
+		return transactionStatusCodeValid, nil
+	}
+
+	_, err := b.CheckTxState.authorizeValidatorTx(b.Genesis.ChainID, tx)
+	if err != nil {
+		return transactionStatusCodeUnauthorized, err
+	}
+
+	return transactionStatusCodeValid, nil
+}
+
+func (b *Baseline) Commit() abcitypes.ResponseCommit {
+	if b.halting {
+		return abcitypes.ResponseCommit{Data: b.CommitState.Root}
+	}
+
+	b.DeliverTxState.Height++
+
+	root, err := b.DeliverTxState.calculateRoot()
+	if err != nil {
+		common.Log.Panicf("failed to calculate state root at height %d; %s", b.DeliverTxState.Height, err.Error())
+	}
+	b.DeliverTxState.Root = root
+
+	err = b.CommitState.sync(b.DeliverTxState)
+	if err != nil {
+		common.Log.Panicf("failed to commit state at height %d; %s", b.DeliverTxState.Height, err.Error())
+	}
+
+	err = b.CheckTxState.sync(b.CommitState)
+	if err != nil {
+		common.Log.Warningf("failed to reset check tx state at height %d; %s", b.CommitState.Height, err.Error())
+	}
+
+	// the state root is returned as the app hash, so the state behind it
+	// must be stored before the block is committed
+	err = b.CommitState.Save()
+	if err != nil {
+		common.Log.Panicf("failed to save committed state at height %d; %s", b.CommitState.Height, err.Error())
+	}
+
+	err = b.stateHistory.save(b.CommitState)
+	if err != nil {
+		common.Log.Warningf("failed to retain state snapshot at height %d; %s", b.CommitState.Height, err.Error())
+	}
+
+	err = checkAppVersion(b.CommitState)
+	if err != nil {
+		b.requestHalt(err.Error())
+	} else if reason := b.haltReason(); reason != "" {
+		err = b.stateHistory.write(b.CommitState)
+		if err != nil {
+			common.Log.Warningf("failed to write final state snapshot at height %d; %s", b.CommitState.Height, err.Error())
+		}
+		b.requestHalt(reason)
+	}
+
+	// registrations are signed with consecutive nonces, so one is dispatched
+	// at a time
+	if !b.halting && !b.registerEntropyKey() {
+		b.registerNodeID()
+	}
+
 	return abcitypes.ResponseCommit{
+		Data:         root,
 		RetainHeight: 0,
 	}
 }
 
 func (b *Baseline) DeliverTx(req abcitypes.RequestDeliverTx) abcitypes.ResponseDeliverTx {
 	common.Log.Debugf("DeliverTx; %s", req)
-	return abcitypes.ResponseDeliverTx{Code: 0}
+
+	if b.halting {
+		return abcitypes.ResponseDeliverTx{}
+	}
+
+	tx, _ := TransactionFromRaw(req.Tx)
+	code := tx.isValid(b.Genesis.ChainID)
+	if code != transactionStatusCodeValid || tx.Opcode == nil {
+		return abcitypes.ResponseDeliverTx{Code: code}
+	}
+
+	switch *tx.Opcode {
+	case transactionOpcodeEntropy:
+		return b.deliverEntropy(tx)
+	case transactionOpcodeEntropyKeyRegistration:
+		return b.deliverEntropyKeyRegistration(tx)
+	case transactionOpcodeKeyRotation:
+		return b.deliverKeyRotation(tx)
+	case transactionOpcodeNodeRegistration:
+		return b.deliverNodeRegistration(tx)
+	case transactionOpcodePeerRegistry:
+		return b.deliverPeerRegistryChange(tx)
+	case transactionOpcodeProposal:
+		return b.deliverProposal(tx)
+	case transactionOpcodeVote:
+		return b.deliverVote(tx)
+	}
+
+	return abcitypes.ResponseDeliverTx{Code: code}
 }
 
 func (b *Baseline) EndBlock(req abcitypes.RequestEndBlock) abcitypes.ResponseEndBlock {
 	common.Log.Debugf("EndBlock; %v", req)
 
+	if b.halting {
+		return abcitypes.ResponseEndBlock{}
+	}
+
 	err := b.resolveRandomBeaconEntropy(req)
 	if err != nil {
 		common.Log.Warningf("failed to resolve random beacon entropy; %s", err.Error())
 	}
 
 	validatorUpdates := b.resolveValidatorUpdates(req)
+	validatorUpdates = mergeValidatorUpdates(append(validatorUpdates, b.DeliverTxState.applyKeyRotations(req.Height)...))
+
+	for _, key := range b.DeliverTxState.resolvePeerRegistryChanges(req.Height) {
+		common.Log.Debugf("applied peer registry change %s at height %d", key, req.Height)
+	}
+	consensusParamUpdates, events := b.DeliverTxState.endVoting(req.Height)
+	consensusParamUpdates = mergeConsensusParamUpdates(consensusParamUpdates, b.DeliverTxState.prepareUpgrade(req.Height))
 
 	return abcitypes.ResponseEndBlock{
-		ValidatorUpdates: validatorUpdates,
+		ConsensusParamUpdates: consensusParamUpdates,
+		Events:                events,
+		ValidatorUpdates:      validatorUpdates,
 	}
 }
 
@@ -145,7 +380,7 @@ func (b *Baseline) EndBlock(req abcitypes.RequestEndBlock) abcitypes.ResponseEnd
 // Version (string): The application software semantic version
 func (b *Baseline) Info(req abcitypes.RequestInfo) abcitypes.ResponseInfo {
 	return abcitypes.ResponseInfo{
-		AppVersion:       b.Genesis.ConsensusParams.Version.AppVersion,
+		AppVersion:       b.CommitState.appVersion(),
 		Data:             "hello world",
 		LastBlockAppHash: b.CommitState.Root,
 		LastBlockHeight:  b.CommitState.Height,
@@ -153,13 +388,27 @@ func (b *Baseline) Info(req abcitypes.RequestInfo) abcitypes.ResponseInfo {
 	}
 }
 
+// InitChain validates the genesis app_state and validators and initializes
+// the chain state; a malformed genesis halts the node
 func (b *Baseline) InitChain(req abcitypes.RequestInitChain) abcitypes.ResponseInitChain {
-	validators := defaultValidatorsFactory(b.Genesis)
-	for _, validator := range validators {
-		b.CommitState.Validators = append(
-			b.CommitState.Validators,
-			validatorFactory(validator.PubKey.GetEd25519(), validator.Power),
-		)
+	validators, err := b.initChain(req)
+	if err != nil {
+		common.Log.Panicf("failed to initialize chain %s; %s", req.ChainId, err.Error())
+	}
+
+	if req.InitialHeight > 1 {
+		b.DeliverTxState.Height = req.InitialHeight - 1
+	}
+
+	root, err := b.DeliverTxState.calculateRoot()
+	if err != nil {
+		common.Log.Panicf("failed to calculate genesis state root; %s", err.Error())
+	}
+	b.DeliverTxState.Root = root
+
+	err = b.CommitState.sync(b.DeliverTxState)
+	if err != nil {
+		common.Log.Panicf("failed to initialize chain state; %s", err.Error())
 	}
 
 	return abcitypes.ResponseInitChain{
@@ -169,13 +418,98 @@ func (b *Baseline) InitChain(req abcitypes.RequestInitChain) abcitypes.ResponseI
 	}
 }
 
+// initChain validates the genesis app_state and validators, populating the
+// deliver tx state with the genesis validators and returning them
+func (b *Baseline) initChain(req abcitypes.RequestInitChain) ([]abcitypes.ValidatorUpdate, error) {
+	if req.ChainId != b.Genesis.ChainID {
+		return nil, fmt.Errorf("chain id %s does not match the genesis chain id %s", req.ChainId, b.Genesis.ChainID)
+	}
+
+	// tendermint compacts the app_state when it persists the genesis document,
+	// so it is replayed with different whitespace after a restart
+	if !equalJSON(req.AppStateBytes, b.Genesis.AppState) {
+		return nil, errors.New("app_state does not match the genesis document used to initialize the application")
+	}
+
+	params, err := stateParamsFromAppState(req.AppStateBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	err = verifyGenesisSignatures(b.Genesis, params.Signatures)
+	if err != nil {
+		return nil, err
+	}
+
+	// the accounts are committed to by the genesis state root
+	b.DeliverTxState.importAccounts(params.Accounts)
+
+	genesisValidators := map[string]int64{}
+	for i, validator := range req.Validators {
+		pubkey := validator.PubKey.GetEd25519()
+		if len(pubkey) != ed25519.PubKeySize {
+			return nil, fmt.Errorf("genesis validator %d requires an ed25519 public key", i)
+		}
+
+		address := ed25519.PubKey(pubkey).Address().String()
+		if validator.Power <= 0 {
+			return nil, fmt.Errorf("genesis validator %s requires positive voting power", address)
+		}
+
+		if _, ok := genesisValidators[address]; ok {
+			return nil, fmt.Errorf("duplicate genesis validator: %s", address)
+		}
+		genesisValidators[address] = validator.Power
+	}
+
+	if len(b.DeliverTxState.Validators) > 0 {
+		// validators imported from an exported genesis state must agree with
+		// the genesis validator set, if one is given
+		validators := make([]abcitypes.ValidatorUpdate, 0)
+		for _, validator := range b.DeliverTxState.Validators {
+			if validator.VotingPower() <= 0 {
+				continue
+			}
+
+			if len(genesisValidators) > 0 && genesisValidators[*validator.Address] != validator.VotingPower() {
+				return nil, fmt.Errorf("genesis validator set does not match the voting power of validator %s in app_state", *validator.Address)
+			}
+			validators = append(validators, validator.AsValidatorUpdate())
+		}
+
+		if len(genesisValidators) > 0 && len(genesisValidators) != len(validators) {
+			return nil, errors.New("genesis validator set does not match the validators in app_state")
+		}
+
+		if len(validators) == 0 {
+			return nil, errors.New("genesis requires at least one validator with voting power")
+		}
+
+		return validators, nil
+	}
+
+	validators := req.Validators
+	if len(validators) == 0 {
+		validators = defaultValidatorsFactory(b.Genesis)
+	}
+
+	for _, validator := range validators {
+		b.DeliverTxState.Validators = append(
+			b.DeliverTxState.Validators,
+			validatorFactory(validator.PubKey.GetEd25519(), validator.Power),
+		)
+	}
+
+	return validators, nil
+}
+
 func (b *Baseline) ListSnapshots(req abcitypes.RequestListSnapshots) abcitypes.ResponseListSnapshots {
 	common.Log.Debugf("ListSnapshots; %s", req)
 	return abcitypes.ResponseListSnapshots{}
 }
 
 func (b *Baseline) LoadSnapshotChunk(req abcitypes.RequestLoadSnapshotChunk) abcitypes.ResponseLoadSnapshotChunk {
-	common.Log.Debugf("LoadSnapshotChunk; %s", req)
+	common.Log.Debugf("LoadSnapshotChunk; %v", req)
 	return abcitypes.ResponseLoadSnapshotChunk{}
 }
 
@@ -189,19 +523,93 @@ func (b *Baseline) SetOption(req abcitypes.RequestSetOption) abcitypes.ResponseS
 	return abcitypes.ResponseSetOption{}
 }
 
+// Query the application state; if a height is given, the query is answered
+// using the state committed at that height, provided it is still retained
 func (b *Baseline) Query(req abcitypes.RequestQuery) abcitypes.ResponseQuery {
-	resp, err := b.queryHandlers.handle(req)
-	if resp != nil && err == nil {
-		return *resp
+	state := b.CommitState
+
+	if req.Height > b.CommitState.Height {
+		return abcitypes.ResponseQuery{
+			Code:   queryResponseCodeBadRequest,
+			Log:    fmt.Sprintf("height %d has not been committed; latest height: %d", req.Height, b.CommitState.Height),
+			Height: req.Height,
+		}
+	} else if req.Height > 0 && req.Height != b.CommitState.Height {
+		historicalState, err := b.stateHistory.load(req.Height)
+		if err != nil {
+			return abcitypes.ResponseQuery{
+				Code:   queryResponseCodeNotFound,
+				Log:    err.Error(),
+				Height: req.Height,
+			}
+		}
+		state = historicalState
+	}
+
+	resp, err := b.queryHandlers.handle(state, req)
+	if err != nil {
+		common.Log.Debugf("failed to handle query for path: %s; %s", req.Path, err.Error())
+		return abcitypes.ResponseQuery{
+			Code:   queryResponseCodeUnknownPath,
+			Log:    err.Error(),
+			Height: state.Height,
+		}
+	}
+
+	return *resp
+}
+
+// Halted returns a channel which receives the reason the node must halt, once
+// it can no longer safely process blocks
+func (b *Baseline) Halted() <-chan string {
+	return b.halt
+}
+
+// Halting returns true once the node must halt; consensus must not start
+// another block
+func (b *Baseline) Halting() bool {
+	return b.halting
+}
+
+// haltReason returns the reason the operator-configured halt height or time
+// has been reached by the last committed block, or an empty string
+func (b *Baseline) haltReason() string {
+	if b.Config.HaltHeight > 0 && b.CommitState.Height >= b.Config.HaltHeight {
+		return fmt.Sprintf("reached halt height %d", b.Config.HaltHeight)
 	}
 
-	return abcitypes.ResponseQuery{
-		Code: 0,
+	if b.Config.HaltTime != nil && !b.blockTime.Before(*b.Config.HaltTime) {
+		return fmt.Sprintf("reached halt time %s", b.Config.HaltTime.Format(time.RFC3339))
 	}
+
+	return ""
+}
+
+// requestHalt refuses further blocks, stops consensus and then signals the
+// node to halt for the given reason; this is called from Commit on the
+// routine executing blocks, so consensus is stopped on another routine
+func (b *Baseline) requestHalt(reason string) {
+	common.Log.Warningf("halting at height %d; %s", b.CommitState.Height, reason)
+	b.halting = true
+
+	go func() {
+		if b.StopConsensus != nil {
+			b.StopConsensus()
+		}
+
+		select {
+		case b.halt <- reason:
+		default:
+		}
+	}()
 }
 
 // Shutdown handles the consolidated shutdown of all ABCI-owned resources
 func (b *Baseline) Shutdown() error {
+	if b.Service == nil {
+		return nil
+	}
+
 	err := b.Service.unsubscribeStakingSubscription()
 	if err != nil {
 		return err
@@ -210,12 +618,127 @@ func (b *Baseline) Shutdown() error {
 	return nil
 }
 
-// resolveBeaconEntropy resolves entropy for a random beacon and dispatches
-// a transaction to store this entropy as part of the next block
+// deliverEntropy verifies the entropy carried by the given transaction and stores
+// it in state by height; every node verifies the VRF proof independently
+func (b *Baseline) deliverEntropy(tx *Transaction) abcitypes.ResponseDeliverTx {
+	entropy, err := tx.entropy()
+	if err != nil {
+		return abcitypes.ResponseDeliverTx{
+			Code: transactionStatusCodeInvalidFormat,
+			Log:  err.Error(),
+		}
+	}
+
+	if b.DeliverTxState.GetEntropy(entropy.Height) != nil {
+		return abcitypes.ResponseDeliverTx{
+			Code: transactionStatusCodeInvalidEntropy,
+			Log:  fmt.Sprintf("entropy already stored at height %d", entropy.Height),
+		}
+	}
+
+	err = entropy.verify(
+		b.DeliverTxState.EntropyRequests[entropy.Height],
+		b.DeliverTxState.GetValidator([]byte(entropy.Proposer)),
+	)
+	if err != nil {
+		common.Log.Debugf("rejected entropy for height %d; %s", entropy.Height, err.Error())
+		return abcitypes.ResponseDeliverTx{
+			Code: transactionStatusCodeInvalidEntropy,
+			Log:  err.Error(),
+		}
+	}
+
+	b.DeliverTxState.SetEntropy(entropy)
+	common.Log.Debugf("stored random beacon entropy at height %d", entropy.Height)
+
+	return abcitypes.ResponseDeliverTx{Code: transactionStatusCodeValid}
+}
+
+func (b *Baseline) deliverEntropyKeyRegistration(tx *Transaction) abcitypes.ResponseDeliverTx {
+	registration, err := tx.entropyKeyRegistration()
+	if err != nil {
+		return abcitypes.ResponseDeliverTx{
+			Code: transactionStatusCodeInvalidFormat,
+			Log:  err.Error(),
+		}
+	}
+
+	validator, err := b.authorizeValidatorTx(tx)
+	if err != nil {
+		return abcitypes.ResponseDeliverTx{
+			Code: transactionStatusCodeUnauthorized,
+			Log:  err.Error(),
+		}
+	}
+
+	validator.registerEntropyKey(registration.PublicKey, b.DeliverTxState.Height+1)
+	common.Log.Debugf("validator %s registered entropy key %s", *validator.Address, hex.EncodeToString(registration.PublicKey))
+
+	return abcitypes.ResponseDeliverTx{Code: transactionStatusCodeValid}
+}
+
+// requestRandomBeaconEntropy records an entropy request every n blocks, where n is the
+// configured entropy interval; if this node proposed the block, it dispatches a
+// transaction carrying its VRF output over the previous block hash
+func (b *Baseline) requestRandomBeaconEntropy(req abcitypes.RequestBeginBlock) {
+	height := req.Header.Height
+	if height%b.DeliverTxState.EntropyParams.interval() != 0 {
+		return
+	}
+
+	request := &EntropyRequest{
+		Height:   height,
+		Proposer: crypto.Address(req.Header.ProposerAddress).String(),
+		Seed:     req.Header.LastBlockId.Hash,
+	}
+
+	if b.DeliverTxState.EntropyRequests == nil {
+		b.DeliverTxState.EntropyRequests = map[int64]*EntropyRequest{}
+	}
+	b.DeliverTxState.EntropyRequests[height] = request
+
+	if b.entropyProver == nil || b.entropyProver.address != request.Proposer {
+		return
+	}
+
+	go func() {
+		entropy, err := b.entropyProver.prove(request)
+		if err != nil {
+			common.Log.Warningf("failed to prove random beacon entropy at height %d; %s", height, err.Error())
+			return
+		}
+
+		tx, err := transactionFactory(transactionOpcodeEntropy, entropy)
+		if err != nil {
+			common.Log.Warningf("failed to create entropy transaction for height %d; %s", height, err.Error())
+			return
+		}
+
+		if b.BroadcastTx == nil {
+			common.Log.Warningf("no transaction broadcaster configured; entropy for height %d not dispatched", height)
+			return
+		}
+
+		err = b.BroadcastTx(tx.raw)
+		if err != nil {
+			common.Log.Warningf("failed to broadcast entropy transaction for height %d; %s", height, err.Error())
+			return
+		}
+
+		common.Log.Debugf("dispatched random beacon entropy for height %d", height)
+	}()
+}
+
+// resolveRandomBeaconEntropy expires entropy requests which were not satisfied
+// by their proposer within a single entropy interval
 func (b *Baseline) resolveRandomBeaconEntropy(req abcitypes.RequestEndBlock) error {
-	if req.Height%defaultEntropyBlockInterval == 0 {
-		// store latest L1-derived entropy...
-		common.Log.Debugf("TODO-- fetch and store entropy at height... %d", req.Height)
+	interval := b.DeliverTxState.EntropyParams.interval()
+
+	for height := range b.DeliverTxState.EntropyRequests {
+		if req.Height-height >= interval {
+			delete(b.DeliverTxState.EntropyRequests, height)
+			common.Log.Warningf("random beacon entropy request for height %d expired at height %d", height, req.Height)
+		}
 	}
 
 	return nil
@@ -225,18 +748,22 @@ func (b *Baseline) resolveRandomBeaconEntropy(req abcitypes.RequestEndBlock) err
 func (b *Baseline) resolveValidatorUpdates(req abcitypes.RequestEndBlock) []abcitypes.ValidatorUpdate {
 	validatorUpdates := make([]abcitypes.ValidatorUpdate, 0)
 
-	read := true
+	// staking deltas are applied on networks whose genesis configures a
+	// staking contract, where every node observes them through the service;
+	// the validator set of any other network is static
+	read := b.DeliverTxState.Staking != nil
 	for read {
 		select {
 		case delta := <-b.Service.validatorDeltasChannel:
-			validator := b.CommitState.GetValidator(delta.Address)
+			// the staking contract continues to refer to rotated keys
+			validator := b.DeliverTxState.resolveValidator(delta.Address)
 			if validator == nil {
 				validator = validatorFactory(delta.PublicKey, 0)
-				b.CommitState.Validators = append(b.CommitState.Validators, validator)
-				common.Log.Debugf("adding new validator %s in block %d", validator.Address, req.Height)
+				b.DeliverTxState.Validators = append(b.DeliverTxState.Validators, validator)
+				common.Log.Debugf("adding new validator %s in block %d", *validator.Address, req.Height)
 			}
 
-			common.Log.Debugf("applying validator staking delta to validator %s in block %d", validator.Address, req.Height)
+			common.Log.Debugf("applying validator staking delta to validator %s in block %d", *validator.Address, req.Height)
 			validator.AdjustStake(delta.StakingDelta)
 			validatorUpdates = append(validatorUpdates, validator.AsValidatorUpdate())
 		default:
@@ -245,10 +772,230 @@ func (b *Baseline) resolveValidatorUpdates(req abcitypes.RequestEndBlock) []abci
 		}
 	}
 
-	if b.CommitState.TotalVotingPower() == 0 {
+	if b.DeliverTxState.TotalVotingPower() == 0 {
 		common.Log.Debugf("all validator staking power withdrawn as of block %d; reverting to default validator set", req.Height)
 		validatorUpdates = append(validatorUpdates, defaultValidatorsFactory(b.Genesis)...)
 	}
 
 	return validatorUpdates
 }
+
+// authorizeValidatorTx returns the staked validator which signed the given
+// transaction, advancing its nonce in the deliver tx state, or an error if
+// the transaction is not authorized
+func (b *Baseline) authorizeValidatorTx(tx *Transaction) (*Validator, error) {
+	return b.DeliverTxState.authorizeValidatorTx(b.Genesis.ChainID, tx)
+}
+
+// authorizeValidatorTx returns the staked validator which signed the given
+// transaction for the given chain, advancing its nonce, or an error if the
+// transaction is not authorized
+func (s *State) authorizeValidatorTx(chainID string, tx *Transaction) (*Validator, error) {
+	err := tx.verifySignature(chainID)
+	if err != nil {
+		return nil, err
+	}
+
+	address := tx.signerAddress()
+	validator := s.GetValidator([]byte(address))
+	if validator == nil || validator.VotingPower() <= 0 {
+		return nil, fmt.Errorf("transaction signer %s is not a staked validator", address)
+	}
+
+	if tx.Nonce != validator.Nonce+1 {
+		return nil, fmt.Errorf("invalid nonce %d for validator %s; expected %d", tx.Nonce, address, validator.Nonce+1)
+	}
+
+	validator.Nonce = tx.Nonce
+	return validator, nil
+}
+
+func (b *Baseline) deliverPeerRegistryChange(tx *Transaction) abcitypes.ResponseDeliverTx {
+	change, err := tx.peerRegistryChange()
+	if err != nil {
+		return abcitypes.ResponseDeliverTx{
+			Code: transactionStatusCodeInvalidFormat,
+			Log:  err.Error(),
+		}
+	}
+
+	validator, err := b.authorizeValidatorTx(tx)
+	if err != nil {
+		return abcitypes.ResponseDeliverTx{
+			Code: transactionStatusCodeUnauthorized,
+			Log:  err.Error(),
+		}
+	}
+
+	registry := b.DeliverTxState.PeerRegistry
+	if registry == nil {
+		registry, _ = peerRegistryFactory(nil)
+		b.DeliverTxState.PeerRegistry = registry
+	}
+
+	applied, err := registry.approve(b.DeliverTxState, change, *validator.Address, b.DeliverTxState.Height+1)
+	if err != nil {
+		return abcitypes.ResponseDeliverTx{
+			Code: transactionStatusCodeInvalidPeerRegistryChange,
+			Log:  err.Error(),
+		}
+	}
+
+	if applied {
+		common.Log.Debugf("applied peer registry change: %s %s", change.Action, change.NodeID)
+	} else {
+		common.Log.Debugf("validator %s approved peer registry change: %s %s", *validator.Address, change.Action, change.NodeID)
+	}
+
+	return abcitypes.ResponseDeliverTx{Code: transactionStatusCodeValid}
+}
+
+// recordMisbehavior records the evidence of misbehavior included in the block
+// against the reputation of the offending nodes
+func (b *Baseline) recordMisbehavior(req abcitypes.RequestBeginBlock) {
+	for _, evidence := range req.ByzantineValidators {
+		nodeID := hex.EncodeToString(evidence.Validator.Address)
+		address := crypto.Address(evidence.Validator.Address).String()
+		if validator := b.DeliverTxState.resolveValidator([]byte(address)); validator != nil {
+			nodeID = validator.nodeID()
+		}
+
+		reason := fmt.Sprintf("%s at height %d", evidence.Type.String(), evidence.Height)
+		b.peerReputation.recordMisbehavior(peerReputationIDKey(nodeID), reason, evidence.Time)
+	}
+}
+
+func (b *Baseline) deliverProposal(tx *Transaction) abcitypes.ResponseDeliverTx {
+	proposal, err := tx.proposal()
+	if err != nil {
+		return abcitypes.ResponseDeliverTx{
+			Code: transactionStatusCodeInvalidFormat,
+			Log:  err.Error(),
+		}
+	}
+
+	validator, err := b.authorizeValidatorTx(tx)
+	if err != nil {
+		return abcitypes.ResponseDeliverTx{
+			Code: transactionStatusCodeUnauthorized,
+			Log:  err.Error(),
+		}
+	}
+
+	err = b.DeliverTxState.submitProposal(proposal, *validator.Address, b.DeliverTxState.Height+1)
+	if err != nil {
+		return abcitypes.ResponseDeliverTx{
+			Code: transactionStatusCodeInvalidProposal,
+			Log:  err.Error(),
+		}
+	}
+
+	common.Log.Debugf("validator %s submitted proposal %d; voting ends at height %d", *validator.Address, proposal.ID, proposal.VotingEndHeight)
+	return abcitypes.ResponseDeliverTx{
+		Code: transactionStatusCodeValid,
+		Data: []byte(strconv.FormatUint(proposal.ID, 10)),
+	}
+}
+
+// deliverKeyRotation schedules the rotation of the validator which signed the
+// given transaction to a new key
+func (b *Baseline) deliverKeyRotation(tx *Transaction) abcitypes.ResponseDeliverTx {
+	rotation, err := tx.keyRotation()
+	if err != nil {
+		return abcitypes.ResponseDeliverTx{
+			Code: transactionStatusCodeInvalidFormat,
+			Log:  err.Error(),
+		}
+	}
+
+	validator, err := b.authorizeValidatorTx(tx)
+	if err != nil {
+		return abcitypes.ResponseDeliverTx{
+			Code: transactionStatusCodeUnauthorized,
+			Log:  err.Error(),
+		}
+	}
+
+	err = b.DeliverTxState.scheduleKeyRotation(rotation, validator, b.DeliverTxState.Height+1)
+	if err != nil {
+		return abcitypes.ResponseDeliverTx{
+			Code: transactionStatusCodeInvalidKeyRotation,
+			Log:  err.Error(),
+		}
+	}
+
+	common.Log.Debugf("validator %s scheduled rotation to key %s at height %d", rotation.Validator, rotation.Address, rotation.Height)
+	return abcitypes.ResponseDeliverTx{Code: transactionStatusCodeValid}
+}
+
+// deliverNodeRegistration binds the validator which signed the given
+// transaction to the node ID of the registered node key
+func (b *Baseline) deliverNodeRegistration(tx *Transaction) abcitypes.ResponseDeliverTx {
+	registration, err := tx.nodeRegistration()
+	if err != nil {
+		return abcitypes.ResponseDeliverTx{
+			Code: transactionStatusCodeInvalidFormat,
+			Log:  err.Error(),
+		}
+	}
+
+	validator, err := b.authorizeValidatorTx(tx)
+	if err != nil {
+		return abcitypes.ResponseDeliverTx{
+			Code: transactionStatusCodeUnauthorized,
+			Log:  err.Error(),
+		}
+	}
+
+	nodeID := registration.nodeID()
+	err = b.DeliverTxState.registerNodeID(validator, nodeID)
+	if err != nil {
+		return abcitypes.ResponseDeliverTx{
+			Code: transactionStatusCodeInvalidNodeRegistration,
+			Log:  err.Error(),
+		}
+	}
+
+	common.Log.Debugf("validator %s registered node %s", *validator.Address, nodeID)
+	return abcitypes.ResponseDeliverTx{Code: transactionStatusCodeValid}
+}
+
+func (b *Baseline) deliverVote(tx *Transaction) abcitypes.ResponseDeliverTx {
+	vote, err := tx.vote()
+	if err != nil {
+		return abcitypes.ResponseDeliverTx{
+			Code: transactionStatusCodeInvalidFormat,
+			Log:  err.Error(),
+		}
+	}
+
+	validator, err := b.authorizeValidatorTx(tx)
+	if err != nil {
+		return abcitypes.ResponseDeliverTx{
+			Code: transactionStatusCodeUnauthorized,
+			Log:  err.Error(),
+		}
+	}
+
+	err = b.DeliverTxState.castVote(vote, *validator.Address, b.DeliverTxState.Height+1)
+	if err != nil {
+		return abcitypes.ResponseDeliverTx{
+			Code: transactionStatusCodeInvalidVote,
+			Log:  err.Error(),
+		}
+	}
+
+	common.Log.Debugf("validator %s voted %s on proposal %d", *validator.Address, vote.Option, vote.ProposalID)
+	return abcitypes.ResponseDeliverTx{Code: transactionStatusCodeValid}
+}
+
+// equalJSON returns true if the given json documents are equal ignoring
+// insignificant whitespace
+func equalJSON(a, b []byte) bool {
+	var compactA, compactB bytes.Buffer
+	if json.Compact(&compactA, a) != nil || json.Compact(&compactB, b) != nil {
+		return bytes.Equal(a, b)
+	}
+
+	return bytes.Equal(compactA.Bytes(), compactB.Bytes())
+}
@@ -0,0 +1,380 @@
+package protocol
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/providenetwork/baseledger/common"
+	"github.com/providenetwork/tendermint/crypto"
+	"github.com/providenetwork/tendermint/crypto/ed25519"
+)
+
+const defaultEntropyKeyFilePath = "entropy.json"
+
+// entropyKeyRegistrationRetryInterval is the number of blocks after which an
+// entropy key registration which has not been committed is dispatched again
+const entropyKeyRegistrationRetryInterval = int64(100)
+
+// EntropyParams defines the per-network random beacon parameters
+type EntropyParams struct {
+	Interval int64 `json:"interval"` // number of blocks between entropy injections
+}
+
+// Entropy is verified random beacon output stored in state by height; the output
+// is derived from the ECVRF proof over the hash of the block preceding the height
+type Entropy struct {
+	Height    int64  `json:"height"`
+	Proposer  string `json:"proposer"`
+	Seed      []byte `json:"seed"`
+	Output    []byte `json:"output"`
+	Proof     []byte `json:"proof"`
+	PublicKey []byte `json:"public_key"`
+	Signature []byte `json:"signature,omitempty"`
+}
+
+// EntropyRequest is recorded at each interval height and awaits a matching
+// entropy transaction from the proposer of that height
+type EntropyRequest struct {
+	Height   int64  `json:"height"`
+	Proposer string `json:"proposer"`
+	Seed     []byte `json:"seed"`
+}
+
+// EntropyKeyRegistration binds a VRF public key to the validator signing the
+// transaction; the VRF proof over the registration proves the key is held by
+// the validator. A registered key proves entropy only for seeds which were
+// not known when it was registered, so it cannot be chosen to suit a seed
+type EntropyKeyRegistration struct {
+	PublicKey []byte `json:"public_key"`
+	Proof     []byte `json:"proof"`
+}
+
+// entropyKeyFile is the on-disk representation of the local VRF key
+type entropyKeyFile struct {
+	PublicKey []byte `json:"public_key"`
+	Seed      []byte `json:"seed"`
+}
+
+// entropyProver produces signed entropy for heights at which the local
+// validator is the proposer
+type entropyProver struct {
+	address string
+	keypair *vrfKeypair
+	signer  crypto.PrivKey
+}
+
+func (p *EntropyParams) interval() int64 {
+	if p == nil || p.Interval <= 0 {
+		return defaultEntropyBlockInterval
+	}
+
+	return p.Interval
+}
+
+// signBytes returns the canonical bytes signed by the proposer's consensus key
+func (e *Entropy) signBytes() ([]byte, error) {
+	unsigned := *e
+	unsigned.Signature = nil
+	return json.Marshal(unsigned)
+}
+
+// verify the entropy against the request recorded at its height and the
+// proposing validator; the VRF output is recomputed from the proof
+func (e *Entropy) verify(req *EntropyRequest, validator *Validator) error {
+	if req == nil {
+		return fmt.Errorf("no pending entropy request at height %d", e.Height)
+	}
+
+	if !strings.EqualFold(e.Proposer, req.Proposer) {
+		return fmt.Errorf("entropy for height %d must be provided by proposer %s", e.Height, req.Proposer)
+	}
+
+	if !bytes.Equal(e.Seed, req.Seed) {
+		return fmt.Errorf("entropy seed does not match hash of block %d", e.Height-1)
+	}
+
+	err := e.verifySignature(validator)
+	if err != nil {
+		return err
+	}
+
+	// the seed is the hash of the block preceding the height, which must
+	// follow the block registering the key
+	if validator.EntropyKeyHeight >= e.Height-1 {
+		return fmt.Errorf("entropy key of validator %s was registered at height %d, before the seed of height %d was committed", e.Proposer, validator.EntropyKeyHeight, e.Height)
+	}
+
+	return nil
+}
+
+// verifySignature verifies the entropy was signed by the given proposing
+// validator, and that its VRF proof was made with the registered key of the
+// validator; the VRF output is recomputed from the proof
+func (e *Entropy) verifySignature(validator *Validator) error {
+	if validator == nil {
+		return fmt.Errorf("entropy proposer %s is not a validator", e.Proposer)
+	}
+
+	if validator.EntropyPublicKey == nil {
+		return fmt.Errorf("validator %s has not registered an entropy key", e.Proposer)
+	}
+
+	if !bytes.Equal(validator.EntropyPublicKey, e.PublicKey) {
+		return fmt.Errorf("entropy public key does not match key registered for validator %s", e.Proposer)
+	}
+
+	msg, err := e.signBytes()
+	if err != nil {
+		return err
+	}
+
+	if !ed25519.PubKey(validator.PublicKey).VerifySignature(msg, e.Signature) {
+		return fmt.Errorf("invalid entropy signature for validator %s", e.Proposer)
+	}
+
+	output, err := vrfVerify(e.PublicKey, e.Seed, e.Proof)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(output, e.Output) {
+		return errors.New("entropy output does not match VRF proof")
+	}
+
+	return nil
+}
+
+// entropyProverFactory returns the entropy prover for a validator node which
+// signs with the given validator key, or nil if the node is not configured to
+// propose entropy
+func entropyProverFactory(cfg *common.Config, signer crypto.PrivKey) (*entropyProver, error) {
+	if !cfg.IsValidatorNode() {
+		return nil, nil
+	}
+
+	// the remote signer only signs consensus messages
+	if signer == nil {
+		return nil, fmt.Errorf("the %s signer does not sign entropy", cfg.Signer)
+	}
+
+	pubkey := signer.PubKey()
+	if pubkey == nil || len(pubkey.Bytes()) == 0 {
+		return nil, errors.New("failed to resolve validator public key")
+	}
+
+	keypair, err := loadOrGenEntropyKey(fmt.Sprintf("%s%s%s", cfg.RootDir, string(os.PathSeparator), defaultEntropyKeyFilePath))
+	if err != nil {
+		return nil, err
+	}
+
+	return &entropyProver{
+		address: pubkey.Address().String(),
+		keypair: keypair,
+		signer:  signer,
+	}, nil
+}
+
+// prove returns signed entropy satisfying the given request
+func (p *entropyProver) prove(req *EntropyRequest) (*Entropy, error) {
+	output, proof, err := p.keypair.Prove(req.Seed)
+	if err != nil {
+		return nil, err
+	}
+
+	entropy := &Entropy{
+		Height:    req.Height,
+		Proposer:  p.address,
+		Seed:      req.Seed,
+		Output:    output,
+		Proof:     proof,
+		PublicKey: p.keypair.PublicKey,
+	}
+
+	msg, err := entropy.signBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	entropy.Signature, err = p.signer.Sign(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	return entropy, nil
+}
+
+// loadOrGenEntropyKey reads the VRF key at the given path, generating it if
+// it does not exist
+func loadOrGenEntropyKey(path string) (*vrfKeypair, error) {
+	if _, err := os.Stat(path); err == nil {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		var keyFile *entropyKeyFile
+		err = json.Unmarshal(raw, &keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal entropy key; %s", err.Error())
+		}
+
+		return vrfKeypairFromSeed(keyFile.Seed)
+	}
+
+	seed := make([]byte, vrfSeedLength)
+	_, err := rand.Read(seed)
+	if err != nil {
+		return nil, err
+	}
+
+	keypair, err := vrfKeypairFromSeed(seed)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := json.MarshalIndent(&entropyKeyFile{
+		PublicKey: keypair.PublicKey,
+		Seed:      seed,
+	}, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.WriteFile(path, raw, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	common.Log.Debugf("generated entropy key: %s", hex.EncodeToString(keypair.PublicKey))
+	return keypair, nil
+}
+
+// entropyKeyRegistrationTransaction returns an entropy key registration
+// transaction which binds the VRF key of the given prover to its validator,
+// signed for the given chain using the given nonce
+func entropyKeyRegistrationTransaction(chainID string, prover *entropyProver, nonce uint64) (*Transaction, error) {
+	registration := &EntropyKeyRegistration{
+		PublicKey: prover.keypair.PublicKey,
+	}
+
+	msg, err := registration.signBytes(chainID, prover.signer.PubKey().Bytes(), nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	_, registration.Proof, err = prover.keypair.Prove(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := transactionFactory(transactionOpcodeEntropyKeyRegistration, registration)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Sign(chainID, prover.signer, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	return tx, nil
+}
+
+// signBytes returns the bytes proven by the VRF key; these bind the
+// registration to the chain, the validator and the nonce of the transaction,
+// so the proof cannot be replayed by another validator
+func (r *EntropyKeyRegistration) signBytes(chainID string, signer []byte, nonce uint64) ([]byte, error) {
+	return json.Marshal(&struct {
+		ChainID   string `json:"chain_id"`
+		Signer    []byte `json:"signer"`
+		Nonce     uint64 `json:"nonce"`
+		PublicKey []byte `json:"public_key"`
+	}{
+		ChainID:   chainID,
+		Signer:    signer,
+		Nonce:     nonce,
+		PublicKey: r.PublicKey,
+	})
+}
+
+// verify the VRF key proved the registration on behalf of the given signer
+func (r *EntropyKeyRegistration) verify(chainID string, signer []byte, nonce uint64) error {
+	if len(r.PublicKey) != vrfPublicKeyLength {
+		return errors.New("entropy key registration requires a VRF public key")
+	}
+
+	msg, err := r.signBytes(chainID, signer, nonce)
+	if err != nil {
+		return err
+	}
+
+	_, err = vrfVerify(r.PublicKey, msg, r.Proof)
+	if err != nil {
+		return fmt.Errorf("invalid entropy key registration proof; %s", err.Error())
+	}
+
+	return nil
+}
+
+// registerEntropyKey binds the given VRF public key to the given validator
+// at the given height
+func (v *Validator) registerEntropyKey(publicKey []byte, height int64) {
+	v.EntropyPublicKey = publicKey
+	v.EntropyKeyHeight = height
+}
+
+// registerEntropyKey dispatches an entropy key registration for the validator
+// of this node once the network does not know its VRF key, and returns true
+// while its registration is outstanding; the registration is dispatched again if it has not been
+// committed after entropyKeyRegistrationRetryInterval blocks
+func (b *Baseline) registerEntropyKey() bool {
+	if b.entropyProver == nil || b.BroadcastTx == nil {
+		return false
+	}
+
+	validator := b.CommitState.GetValidator([]byte(b.entropyProver.address))
+	if validator == nil || validator.VotingPower() <= 0 {
+		return false
+	}
+
+	if bytes.Equal(validator.EntropyPublicKey, b.entropyProver.keypair.PublicKey) {
+		return false
+	}
+
+	// a dispatched registration which has not been committed yet holds the
+	// next nonce of the validator
+	height := b.CommitState.Height
+	if b.entropyKeyRegistrationHeight > 0 && height < b.entropyKeyRegistrationHeight+entropyKeyRegistrationRetryInterval {
+		return true
+	}
+
+	b.entropyKeyRegistrationHeight = height
+	address := *validator.Address
+	nonce := validator.Nonce + 1
+
+	// the validator key may be held by vault, so it is not used on the
+	// routine executing blocks
+	go func() {
+		tx, err := entropyKeyRegistrationTransaction(b.Genesis.ChainID, b.entropyProver, nonce)
+		if err != nil {
+			common.Log.Warningf("failed to create entropy key registration transaction for validator %s; %s", address, err.Error())
+			return
+		}
+
+		err = b.BroadcastTx(tx.raw)
+		if err != nil {
+			common.Log.Warningf("failed to broadcast entropy key registration transaction for validator %s; %s", address, err.Error())
+			return
+		}
+
+		common.Log.Debugf("dispatched registration of entropy key %s for validator %s", hex.EncodeToString(b.entropyProver.keypair.PublicKey), address)
+	}()
+
+	return true
+}
@@ -0,0 +1,173 @@
+package protocol
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/providenetwork/tendermint/crypto/ed25519"
+)
+
+// testEntropyProver returns an entropy prover for the given validator key
+// with a VRF key derived from the given seed byte
+func testEntropyProver(t *testing.T, validatorKey ed25519.PrivKey, seed byte) *entropyProver {
+	keypair, err := vrfKeypairFromSeed(bytes.Repeat([]byte{seed}, vrfSeedLength))
+	if err != nil {
+		t.Fatalf("failed to derive VRF keypair; %s", err.Error())
+	}
+
+	return &entropyProver{
+		address: validatorKey.PubKey().Address().String(),
+		keypair: keypair,
+		signer:  validatorKey,
+	}
+}
+
+func TestEntropyKeyRegistration(t *testing.T) {
+	validatorKey := ed25519.GenPrivKey()
+	otherValidatorKey := ed25519.GenPrivKey()
+	prover := testEntropyProver(t, validatorKey, 1)
+
+	tests := []struct {
+		name string
+		tx   func(t *testing.T) *Transaction
+		code uint32
+	}{
+		{
+			name: "proved by the VRF key",
+			tx: func(t *testing.T) *Transaction {
+				tx, _ := entropyKeyRegistrationTransaction(testChainID, prover, 1)
+				return tx
+			},
+			code: transactionStatusCodeValid,
+		},
+		{
+			name: "proof replayed by another validator",
+			tx: func(t *testing.T) *Transaction {
+				tx, _ := entropyKeyRegistrationTransaction(testChainID, prover, 1)
+				registration, _ := tx.entropyKeyRegistration()
+				replayed, _ := transactionFactory(transactionOpcodeEntropyKeyRegistration, registration)
+				replayed.Sign(testChainID, otherValidatorKey, 1)
+				return replayed
+			},
+			code: transactionStatusCodeInvalidEntropy,
+		},
+		{
+			name: "proof replayed with another nonce",
+			tx: func(t *testing.T) *Transaction {
+				tx, _ := entropyKeyRegistrationTransaction(testChainID, prover, 1)
+				registration, _ := tx.entropyKeyRegistration()
+				replayed, _ := transactionFactory(transactionOpcodeEntropyKeyRegistration, registration)
+				replayed.Sign(testChainID, validatorKey, 2)
+				return replayed
+			},
+			code: transactionStatusCodeInvalidEntropy,
+		},
+		{
+			name: "public key of another VRF key",
+			tx: func(t *testing.T) *Transaction {
+				tx, _ := entropyKeyRegistrationTransaction(testChainID, prover, 1)
+				registration, _ := tx.entropyKeyRegistration()
+				registration.PublicKey = testEntropyProver(t, validatorKey, 2).keypair.PublicKey
+				forged, _ := transactionFactory(transactionOpcodeEntropyKeyRegistration, registration)
+				forged.Sign(testChainID, validatorKey, 1)
+				return forged
+			},
+			code: transactionStatusCodeInvalidEntropy,
+		},
+		{
+			name: "signed for another chain",
+			tx: func(t *testing.T) *Transaction {
+				tx, _ := entropyKeyRegistrationTransaction("other-chain", prover, 1)
+				return tx
+			},
+			code: transactionStatusCodeUnauthorized,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tx := test.tx(t)
+			if code := tx.isValid(testChainID); code != test.code {
+				t.Fatalf("expected status code %d; got %d", test.code, code)
+			}
+		})
+	}
+}
+
+func TestEntropyRequiresRegisteredKey(t *testing.T) {
+	validatorKey := ed25519.GenPrivKey()
+	prover := testEntropyProver(t, validatorKey, 1)
+	validator := testValidator(validatorKey, 10)
+
+	request := func(height int64) *EntropyRequest {
+		return &EntropyRequest{
+			Height:   height,
+			Proposer: prover.address,
+			Seed:     bytes.Repeat([]byte{byte(height)}, 32),
+		}
+	}
+
+	tests := []struct {
+		name      string
+		publicKey []byte
+		keyHeight int64
+		height    int64
+		valid     bool
+	}{
+		{name: "no registered key", height: 10},
+		{name: "another registered key", publicKey: testEntropyProver(t, validatorKey, 2).keypair.PublicKey, height: 10},
+		{name: "key registered in the seed block", publicKey: prover.keypair.PublicKey, keyHeight: 9, height: 10},
+		{name: "key registered after the seed block", publicKey: prover.keypair.PublicKey, keyHeight: 10, height: 10},
+		{name: "key registered before the seed block", publicKey: prover.keypair.PublicKey, keyHeight: 8, height: 10, valid: true},
+		{name: "key registered at genesis", publicKey: prover.keypair.PublicKey, height: 2, valid: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			validator.registerEntropyKey(test.publicKey, test.keyHeight)
+
+			req := request(test.height)
+			entropy, err := prover.prove(req)
+			if err != nil {
+				t.Fatalf("failed to prove entropy; %s", err.Error())
+			}
+
+			err = entropy.verify(req, validator)
+			if test.valid && err != nil {
+				t.Fatalf("expected entropy to be valid; %s", err.Error())
+			}
+
+			if !test.valid && err == nil {
+				t.Fatal("expected entropy to be rejected")
+			}
+		})
+	}
+}
+
+func TestDeliverEntropyKeyRegistration(t *testing.T) {
+	validatorKey := ed25519.GenPrivKey()
+	prover := testEntropyProver(t, validatorKey, 1)
+	validator := testValidator(validatorKey, 10)
+
+	b := testBaseline(validator)
+	b.DeliverTxState.Height = 4
+
+	tx, err := entropyKeyRegistrationTransaction(testChainID, prover, 1)
+	if err != nil {
+		t.Fatalf("failed to create entropy key registration; %s", err.Error())
+	}
+
+	resp := b.deliverEntropyKeyRegistration(tx)
+	if resp.Code != transactionStatusCodeValid {
+		t.Fatalf("expected entropy key registration to be delivered; %s", resp.Log)
+	}
+
+	if !bytes.Equal(validator.EntropyPublicKey, prover.keypair.PublicKey) || validator.EntropyKeyHeight != 5 {
+		t.Fatalf("expected entropy key to be registered at height 5; got height %d", validator.EntropyKeyHeight)
+	}
+
+	resp = b.deliverEntropyKeyRegistration(tx)
+	if resp.Code != transactionStatusCodeUnauthorized {
+		t.Fatalf("expected replayed entropy key registration to be unauthorized; got code %d", resp.Code)
+	}
+}
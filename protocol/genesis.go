@@ -0,0 +1,337 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/providenetwork/baseledger/common"
+	"github.com/providenetwork/tendermint/crypto/ed25519"
+	"github.com/providenetwork/tendermint/crypto/tmhash"
+	tmjson "github.com/providenetwork/tendermint/libs/json"
+	"github.com/providenetwork/tendermint/types"
+)
+
+const genesisSignaturesAppStateKey = "signatures"
+
+// GenesisState is the committed application state carried in the app_state
+// of a genesis document exported from a running chain
+type GenesisState struct {
+	ExportHeight    int64            `json:"export_height"`
+	ExportChainID   string           `json:"export_chain_id"`
+	Validators      []*Validator     `json:"validators"`
+	Entropy         []*Entropy       `json:"entropy,omitempty"`
+	AppliedUpgrades map[string]int64 `json:"applied_upgrades,omitempty"`
+
+	// RotatedKeys maps the rotated keys of validators to their next keys, so
+	// stake changes made under a rotated key still reach the validator;
+	// pending rotations are scheduled by height and are not exported
+	RotatedKeys map[string]string `json:"rotated_keys,omitempty"`
+}
+
+// GenesisSignature is a founding validator's signature approving a genesis
+// document
+type GenesisSignature struct {
+	Address   string `json:"address"`
+	Signature []byte `json:"signature"`
+}
+
+// CanonicalJSON returns the canonical encoding of the given JSON document;
+// object keys are sorted at every level, insignificant whitespace is removed
+// and numbers keep their literal form, so a document encodes the same however
+// it was formatted or re-encoded along the way
+func CanonicalJSON(raw []byte) ([]byte, error) {
+	val, err := decodeJSON(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(val)
+}
+
+// decodeJSON decodes the given JSON document, keeping numbers as literals
+func decodeJSON(raw []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+
+	var val interface{}
+	err := decoder.Decode(&val)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errors.New("unexpected data after JSON document")
+	}
+
+	return val, nil
+}
+
+// GenesisSignBytes returns the bytes a founding validator signs to approve the
+// given genesis; these cover the entire genesis document except the signatures
+// carried in its app_state. The app_state is signed in its canonical JSON
+// encoding, so the signatures still verify after the genesis is re-encoded,
+// e.g. when it is served by a node
+func GenesisSignBytes(genesis *types.GenesisDoc) ([]byte, error) {
+	unsigned := *genesis
+
+	if len(bytes.TrimSpace(genesis.AppState)) > 0 {
+		decoded, err := decodeJSON(genesis.AppState)
+		if err != nil {
+			return nil, fmt.Errorf("malformed genesis app_state; %s", err.Error())
+		}
+
+		appState, ok := decoded.(map[string]interface{})
+		if !ok {
+			return nil, errors.New("malformed genesis app_state; expected a JSON object")
+		}
+		delete(appState, genesisSignaturesAppStateKey)
+
+		unsigned.AppState, err = json.Marshal(appState)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	raw, err := tmjson.Marshal(&unsigned)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal genesis; %s", err.Error())
+	}
+
+	return tmhash.Sum(raw), nil
+}
+
+// ValidateGenesis validates the given genesis document and its app_state,
+// including any founding validator signatures, and returns the state params
+func ValidateGenesis(genesis *types.GenesisDoc) (*StateParams, error) {
+	err := genesis.ValidateAndComplete()
+	if err != nil {
+		return nil, fmt.Errorf("invalid genesis; %s", err.Error())
+	}
+
+	params, err := stateParamsFromAppState(genesis.AppState)
+	if err != nil {
+		return nil, err
+	}
+
+	err = verifyGenesisSignatures(genesis, params.Signatures)
+	if err != nil {
+		return nil, err
+	}
+
+	return params, nil
+}
+
+// verifyGenesisSignatures verifies that each signature was made over the given
+// genesis by one of its validators
+func verifyGenesisSignatures(genesis *types.GenesisDoc, signatures []*GenesisSignature) error {
+	if len(signatures) == 0 {
+		return nil
+	}
+
+	signBytes, err := GenesisSignBytes(genesis)
+	if err != nil {
+		return err
+	}
+
+	signed := map[string]bool{}
+	for _, signature := range signatures {
+		if signature == nil {
+			return errors.New("nil genesis signature")
+		}
+
+		var validator *types.GenesisValidator
+		for i := range genesis.Validators {
+			if genesis.Validators[i].Address.String() == signature.Address {
+				validator = &genesis.Validators[i]
+				break
+			}
+		}
+
+		if validator == nil {
+			return fmt.Errorf("genesis signed by %s, which is not a genesis validator", signature.Address)
+		}
+
+		if signed[signature.Address] {
+			return fmt.Errorf("duplicate genesis signature: %s", signature.Address)
+		}
+		signed[signature.Address] = true
+
+		if !validator.PubKey.VerifySignature(signBytes, signature.Signature) {
+			return fmt.Errorf("invalid genesis signature: %s", signature.Address)
+		}
+	}
+
+	return nil
+}
+
+// ExportGenesis returns a genesis document for a new chain with the given
+// chain ID, whose app_state is the last committed state of the configured
+// chain; the new chain continues from the height following the export height
+func ExportGenesis(cfg *common.Config, genesis *types.GenesisDoc, chainID string) (*types.GenesisDoc, error) {
+	state, err := stateFactory(cfg, abciStateCommit, genesis)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load committed state; %s", err.Error())
+	}
+
+	if state.Height == 0 {
+		return nil, errors.New("no committed state to export")
+	}
+
+	appState, err := json.Marshal(state.exportStateParams(genesis.ChainID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal exported state; %s", err.Error())
+	}
+
+	consensusParams := *state.consensusParams()
+	exported := &types.GenesisDoc{
+		AppState:        appState,
+		ChainID:         chainID,
+		ConsensusParams: &consensusParams,
+		GenesisTime:     time.Now().UTC(),
+		InitialHeight:   state.Height + 1,
+		Validators:      make([]types.GenesisValidator, 0),
+	}
+
+	for _, validator := range state.Validators {
+		if validator.VotingPower() <= 0 {
+			continue
+		}
+
+		var name string
+		if validator.Name != nil {
+			name = *validator.Name
+		}
+
+		pubkey := ed25519.PubKey(validator.PublicKey)
+		exported.Validators = append(exported.Validators, types.GenesisValidator{
+			Address: pubkey.Address(),
+			PubKey:  pubkey,
+			Power:   validator.VotingPower(),
+			Name:    name,
+		})
+	}
+
+	err = exported.ValidateAndComplete()
+	if err != nil {
+		return nil, fmt.Errorf("exported genesis is invalid; %s", err.Error())
+	}
+
+	return exported, nil
+}
+
+// exportStateParams returns the state params describing the state; pending
+// entropy requests, peer registry changes and proposals are not exported
+func (s *State) exportStateParams(chainID string) *StateParams {
+	params := &StateParams{
+		Accounts:   make([]*Account, 0, len(s.Accounts)),
+		Entropy:    s.EntropyParams,
+		Governance: s.GovernanceParams,
+		Staking:    s.Staking,
+		State: &GenesisState{
+			ExportHeight:    s.Height,
+			ExportChainID:   chainID,
+			Validators:      s.Validators,
+			Entropy:         make([]*Entropy, 0, len(s.Entropy)),
+			AppliedUpgrades: s.AppliedUpgrades,
+			RotatedKeys:     s.RotatedKeys,
+		},
+	}
+
+	if s.PeerRegistry != nil {
+		params.PeerRegistry = &PeerRegistryParams{
+			Enabled: s.PeerRegistry.Enabled,
+			NodeIDs: make([]string, 0, len(s.PeerRegistry.Nodes)),
+		}
+		for nodeID := range s.PeerRegistry.Nodes {
+			params.PeerRegistry.NodeIDs = append(params.PeerRegistry.NodeIDs, nodeID)
+		}
+		sort.Strings(params.PeerRegistry.NodeIDs)
+	}
+
+	for address, balance := range s.Accounts {
+		params.Accounts = append(params.Accounts, &Account{Address: address, Balance: balance})
+	}
+	sort.Slice(params.Accounts, func(i, j int) bool {
+		return params.Accounts[i].Address < params.Accounts[j].Address
+	})
+
+	for _, entropy := range s.Entropy {
+		params.State.Entropy = append(params.State.Entropy, entropy)
+	}
+	sort.Slice(params.State.Entropy, func(i, j int) bool {
+		return params.State.Entropy[i].Height < params.State.Entropy[j].Height
+	})
+
+	return params
+}
+
+func (g *GenesisState) validate() error {
+	addresses := map[string]bool{}
+	nodeIDs := map[string]bool{}
+	for _, validator := range g.Validators {
+		if validator == nil || validator.Address == nil {
+			return errors.New("genesis validator address required")
+		}
+
+		if len(validator.PublicKey) != ed25519.PubKeySize {
+			return fmt.Errorf("genesis validator %s requires an ed25519 public key", *validator.Address)
+		}
+
+		address := ed25519.PubKey(validator.PublicKey).Address().String()
+		if address != *validator.Address {
+			return fmt.Errorf("genesis validator address %s does not match its public key", *validator.Address)
+		}
+
+		if validator.Stake == nil || *validator.Stake < 0 {
+			return fmt.Errorf("genesis validator %s requires a non-negative stake", address)
+		}
+
+		if addresses[address] {
+			return fmt.Errorf("duplicate genesis validator: %s", address)
+		}
+		addresses[address] = true
+
+		if validator.NodeID != nil {
+			nodeID, err := normalizeNodeID(*validator.NodeID)
+			if err != nil || nodeID != *validator.NodeID {
+				return fmt.Errorf("genesis validator %s has an invalid node id", address)
+			}
+		}
+
+		nodeID := validator.nodeID()
+		if nodeIDs[nodeID] {
+			return fmt.Errorf("duplicate genesis validator node id: %s", nodeID)
+		}
+		nodeIDs[nodeID] = true
+	}
+
+	for _, entropy := range g.Entropy {
+		if entropy == nil || entropy.Height <= 0 || entropy.Height > g.ExportHeight {
+			return errors.New("genesis entropy must be stored at or below the export height")
+		}
+	}
+
+	return nil
+}
+
+// importGenesisState populates the state from an exported genesis state
+func (s *State) importGenesisState(genesis *GenesisState) {
+	s.Validators = append(s.Validators, genesis.Validators...)
+
+	for _, entropy := range genesis.Entropy {
+		s.SetEntropy(entropy)
+	}
+
+	for name, height := range genesis.AppliedUpgrades {
+		s.AppliedUpgrades[name] = height
+	}
+
+	for address, rotated := range genesis.RotatedKeys {
+		s.RotatedKeys[address] = rotated
+	}
+}
@@ -0,0 +1,440 @@
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/providenetwork/baseledger/common"
+	abcitypes "github.com/providenetwork/tendermint/abci/types"
+	tmproto "github.com/providenetwork/tendermint/proto/tendermint/types"
+	"github.com/providenetwork/tendermint/types"
+)
+
+const defaultGovernanceQuorum = int64(34)
+const defaultGovernanceThreshold = int64(50)
+const defaultGovernanceVotingPeriod = int64(17280) // ~24 hours at 5-second blocks
+const defaultKeyRotationWindow = int64(120960)     // ~7 days at 5-second blocks
+const defaultPeerRegistryChangeWindow = int64(120960)
+
+const proposalStatusVoting = "voting"
+const proposalStatusPassed = "passed"
+const proposalStatusRejected = "rejected"
+const proposalStatusFailed = "failed"
+
+const voteOptionYes = "yes"
+const voteOptionNo = "no"
+const voteOptionAbstain = "abstain"
+
+const stateKeyPrefixProposals = "governance/proposals/"
+const stateKeyProposalCount = "governance/proposal_count"
+
+const stateParamsConsensus = "consensus"
+const stateParamsGovernance = "governance"
+
+const eventTypeProposal = "proposal"
+const eventProposalTallied = "tallied"
+
+// GovernanceParams define how proposals are decided; quorum is the percentage
+// of the total voting power which must vote, and threshold the percentage of
+// the non-abstaining voting power which must vote yes, for a proposal to pass
+type GovernanceParams struct {
+	VotingPeriod int64 `json:"voting_period"`
+	Quorum       int64 `json:"quorum"`
+	Threshold    int64 `json:"threshold"`
+
+	// KeyRotationWindow is the number of blocks by which a validator key
+	// rotation may be scheduled ahead of the block which includes it
+	KeyRotationWindow int64 `json:"key_rotation_window,omitempty"`
+
+	// PeerRegistryChangeWindow is the number of blocks after its submission
+	// by which a peer registry change must be approved, or it expires
+	PeerRegistryChangeWindow int64 `json:"peer_registry_change_window,omitempty"`
+}
+
+// ProposalContent is the set of changes applied if a proposal passes
+type ProposalContent struct {
+	Consensus  *abcitypes.ConsensusParams `json:"consensus,omitempty"`
+	Entropy    *EntropyParams             `json:"entropy,omitempty"`
+	Governance *GovernanceParams          `json:"governance,omitempty"`
+
+	// Upgrade schedules a software upgrade, replacing any scheduled upgrade
+	Upgrade       *UpgradePlan `json:"upgrade,omitempty"`
+	CancelUpgrade bool         `json:"cancel_upgrade,omitempty"`
+}
+
+// Proposal is a change put to a vote of the validators
+type Proposal struct {
+	ID          uint64           `json:"id"`
+	Proposer    string           `json:"proposer"`
+	Title       string           `json:"title"`
+	Description string           `json:"description,omitempty"`
+	Content     *ProposalContent `json:"content"`
+
+	SubmitHeight    int64 `json:"submit_height"`
+	VotingEndHeight int64 `json:"voting_end_height"`
+
+	Status string            `json:"status"`
+	Log    string            `json:"log,omitempty"`
+	Votes  map[string]string `json:"votes"` // validator address -> option
+	Tally  *TallyResult      `json:"tally,omitempty"`
+}
+
+// Vote is a validator's vote on a proposal
+type Vote struct {
+	ProposalID uint64 `json:"proposal_id"`
+	Option     string `json:"option"`
+}
+
+// TallyResult is the voting power cast for each option on a proposal
+type TallyResult struct {
+	Yes     int64 `json:"yes"`
+	No      int64 `json:"no"`
+	Abstain int64 `json:"abstain"`
+	Total   int64 `json:"total"`
+}
+
+// defaultGovernanceParams returns the governance params used when none are
+// given in the genesis state
+func defaultGovernanceParams() *GovernanceParams {
+	return &GovernanceParams{
+		VotingPeriod: defaultGovernanceVotingPeriod,
+		Quorum:       defaultGovernanceQuorum,
+		Threshold:    defaultGovernanceThreshold,
+
+		KeyRotationWindow:        defaultKeyRotationWindow,
+		PeerRegistryChangeWindow: defaultPeerRegistryChangeWindow,
+	}
+}
+
+// keyRotationWindow returns the number of blocks by which a key rotation may
+// be scheduled ahead; params which do not set it use the default
+func (p *GovernanceParams) keyRotationWindow() int64 {
+	if p == nil || p.KeyRotationWindow <= 0 {
+		return defaultKeyRotationWindow
+	}
+
+	return p.KeyRotationWindow
+}
+
+// peerRegistryChangeWindow returns the number of blocks by which a peer
+// registry change must be approved; params which do not set it use the default
+func (p *GovernanceParams) peerRegistryChangeWindow() int64 {
+	if p == nil || p.PeerRegistryChangeWindow <= 0 {
+		return defaultPeerRegistryChangeWindow
+	}
+
+	return p.PeerRegistryChangeWindow
+}
+
+func proposalStateKey(id uint64) string {
+	return fmt.Sprintf("%s%020d", stateKeyPrefixProposals, id)
+}
+
+func (p *GovernanceParams) validate() error {
+	if p.VotingPeriod <= 0 {
+		return fmt.Errorf("invalid governance voting period: %d", p.VotingPeriod)
+	}
+
+	if p.Quorum <= 0 || p.Quorum > 100 {
+		return fmt.Errorf("invalid governance quorum: %d", p.Quorum)
+	}
+
+	if p.Threshold <= 0 || p.Threshold >= 100 {
+		return fmt.Errorf("invalid governance threshold: %d", p.Threshold)
+	}
+
+	if p.KeyRotationWindow < 0 {
+		return fmt.Errorf("invalid governance key rotation window: %d", p.KeyRotationWindow)
+	}
+
+	if p.PeerRegistryChangeWindow < 0 {
+		return fmt.Errorf("invalid governance peer registry change window: %d", p.PeerRegistryChangeWindow)
+	}
+
+	return nil
+}
+
+// validate the proposal content against the given state
+func (c *ProposalContent) validate(state *State) error {
+	if c.Consensus == nil && c.Entropy == nil && c.Governance == nil && c.Upgrade == nil && !c.CancelUpgrade {
+		return errors.New("proposal content requires at least one change")
+	}
+
+	if c.Upgrade != nil && c.CancelUpgrade {
+		return errors.New("proposal cannot both schedule and cancel an upgrade")
+	}
+
+	if c.Consensus != nil && c.Consensus.Version != nil {
+		return errors.New("app version may only be changed by an upgrade")
+	}
+
+	if c.Consensus != nil {
+		params := types.UpdateConsensusParams(*state.consensusParams(), c.Consensus)
+		err := types.ValidateConsensusParams(params)
+		if err != nil {
+			return fmt.Errorf("invalid consensus params; %s", err.Error())
+		}
+	}
+
+	if c.Entropy != nil && c.Entropy.Interval <= 0 {
+		return fmt.Errorf("invalid entropy interval: %d", c.Entropy.Interval)
+	}
+
+	if c.Governance != nil {
+		err := c.Governance.validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.Upgrade != nil {
+		err := c.Upgrade.validate(state)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *Proposal) validate(state *State) error {
+	if p.Title == "" {
+		return errors.New("proposal title required")
+	}
+
+	if p.Content == nil {
+		return errors.New("proposal content required")
+	}
+
+	return p.Content.validate(state)
+}
+
+func (v *Vote) validate() error {
+	switch v.Option {
+	case voteOptionYes, voteOptionNo, voteOptionAbstain:
+		return nil
+	}
+
+	return fmt.Errorf("invalid vote option: %s", v.Option)
+}
+
+// tally the votes cast on the proposal, weighted by the current voting power
+// of each voting validator
+func (p *Proposal) tally(state *State) *TallyResult {
+	result := &TallyResult{
+		Total: state.TotalVotingPower(),
+	}
+
+	for address, option := range p.Votes {
+		validator := state.GetValidator([]byte(address))
+		if validator == nil {
+			continue
+		}
+
+		switch option {
+		case voteOptionYes:
+			result.Yes += validator.VotingPower()
+		case voteOptionNo:
+			result.No += validator.VotingPower()
+		case voteOptionAbstain:
+			result.Abstain += validator.VotingPower()
+		}
+	}
+
+	return result
+}
+
+// passed returns true if the tally meets the quorum and threshold of the
+// given params
+func (t *TallyResult) passed(params *GovernanceParams) bool {
+	voted := t.Yes + t.No + t.Abstain
+	if t.Total <= 0 || voted*100 < params.Quorum*t.Total {
+		return false
+	}
+
+	return t.Yes*100 > params.Threshold*(t.Yes+t.No)
+}
+
+// consensusParams returns the consensus params currently in effect
+func (s *State) consensusParams() *tmproto.ConsensusParams {
+	if s.ConsensusParams == nil {
+		return types.DefaultConsensusParams()
+	}
+
+	return s.ConsensusParams
+}
+
+// governanceParams returns the governance params currently in effect
+func (s *State) governanceParams() *GovernanceParams {
+	if s.GovernanceParams == nil {
+		return defaultGovernanceParams()
+	}
+
+	return s.GovernanceParams
+}
+
+// submitProposal assigns an ID to the given proposal and opens it for voting
+func (s *State) submitProposal(proposal *Proposal, proposer string, height int64) error {
+	err := proposal.validate(s)
+	if err != nil {
+		return err
+	}
+
+	votingEndHeight := height + s.governanceParams().VotingPeriod
+	if proposal.Content.Upgrade != nil && proposal.Content.Upgrade.Height <= votingEndHeight {
+		return fmt.Errorf("upgrade height %d must follow the end of voting at height %d", proposal.Content.Upgrade.Height, votingEndHeight)
+	}
+
+	if s.Proposals == nil {
+		s.Proposals = map[uint64]*Proposal{}
+	}
+
+	if s.ProposalEndHeights == nil {
+		s.ProposalEndHeights = map[int64][]uint64{}
+	}
+
+	s.ProposalCount++
+	proposal.ID = s.ProposalCount
+	proposal.Proposer = proposer
+	proposal.SubmitHeight = height
+	proposal.VotingEndHeight = votingEndHeight
+	proposal.Status = proposalStatusVoting
+	proposal.Log = ""
+	proposal.Votes = map[string]string{}
+	proposal.Tally = nil
+	s.Proposals[proposal.ID] = proposal
+	s.ProposalEndHeights[votingEndHeight] = append(s.ProposalEndHeights[votingEndHeight], proposal.ID)
+
+	return nil
+}
+
+// castVote records the vote of the validator with the given address; a
+// validator may change its vote until voting ends
+func (s *State) castVote(vote *Vote, voter string, height int64) error {
+	proposal := s.Proposals[vote.ProposalID]
+	if proposal == nil {
+		return fmt.Errorf("proposal not found: %d", vote.ProposalID)
+	}
+
+	if proposal.Status != proposalStatusVoting || height > proposal.VotingEndHeight {
+		return fmt.Errorf("voting has ended for proposal %d", proposal.ID)
+	}
+
+	proposal.Votes[voter] = vote.Option
+	return nil
+}
+
+// endVoting tallies each proposal whose voting period ends at the given
+// height, applying the content of each which passed, and returns the
+// resulting consensus param updates, if any, with an event carrying each
+// tallied proposal; tallied proposals are removed from the state
+func (s *State) endVoting(height int64) (*abcitypes.ConsensusParams, []abcitypes.Event) {
+	var updates *abcitypes.ConsensusParams
+	events := make([]abcitypes.Event, 0)
+
+	for _, id := range s.ProposalEndHeights[height] {
+		proposal := s.Proposals[id]
+		if proposal == nil {
+			continue
+		}
+
+		updates = mergeConsensusParamUpdates(updates, s.tallyProposal(proposal))
+		delete(s.Proposals, id)
+
+		raw, err := json.Marshal(proposal)
+		if err != nil {
+			common.Log.Warningf("failed to marshal tallied proposal %d; %s", id, err.Error())
+			continue
+		}
+
+		events = append(events, abcitypes.Event{
+			Type: eventTypeProposal,
+			Attributes: []abcitypes.EventAttribute{
+				{
+					Key:   []byte(eventProposalTallied),
+					Value: raw,
+					Index: true,
+				},
+			},
+		})
+	}
+	delete(s.ProposalEndHeights, height)
+
+	return updates, events
+}
+
+// tallyProposal tallies the votes cast on the given proposal, applying its
+// content if it passed, and returns the resulting consensus param updates,
+// if any
+func (s *State) tallyProposal(proposal *Proposal) *abcitypes.ConsensusParams {
+	var updates *abcitypes.ConsensusParams
+
+	proposal.Tally = proposal.tally(s)
+	if !proposal.Tally.passed(s.governanceParams()) {
+		proposal.Status = proposalStatusRejected
+		return nil
+	}
+
+	// params may have changed since the proposal was submitted
+	err := proposal.Content.validate(s)
+	if err != nil {
+		proposal.Status = proposalStatusFailed
+		proposal.Log = err.Error()
+		return nil
+	}
+
+	proposal.Status = proposalStatusPassed
+	content := proposal.Content
+
+	if content.Consensus != nil {
+		params := types.UpdateConsensusParams(*s.consensusParams(), content.Consensus)
+		s.ConsensusParams = &params
+		updates = mergeConsensusParamUpdates(updates, content.Consensus)
+	}
+
+	if content.Entropy != nil {
+		s.EntropyParams = content.Entropy
+	}
+
+	if content.Governance != nil {
+		s.GovernanceParams = content.Governance
+	}
+
+	if content.CancelUpgrade {
+		s.UpgradePlan = nil
+	}
+
+	if content.Upgrade != nil {
+		s.scheduleUpgrade(content.Upgrade)
+	}
+
+	return updates
+}
+
+// mergeConsensusParamUpdates returns the given updates overlaid with the
+// non-nil sections of next
+func mergeConsensusParamUpdates(updates, next *abcitypes.ConsensusParams) *abcitypes.ConsensusParams {
+	if next == nil {
+		return updates
+	}
+
+	if updates == nil {
+		updates = &abcitypes.ConsensusParams{}
+	}
+
+	if next.Block != nil {
+		updates.Block = next.Block
+	}
+	if next.Evidence != nil {
+		updates.Evidence = next.Evidence
+	}
+	if next.Validator != nil {
+		updates.Validator = next.Validator
+	}
+	if next.Version != nil {
+		updates.Version = next.Version
+	}
+
+	return updates
+}
@@ -0,0 +1,120 @@
+package protocol
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/providenetwork/tendermint/crypto/ed25519"
+)
+
+// testProposal returns a proposal changing the entropy interval
+func testProposal(interval int64) *Proposal {
+	return &Proposal{
+		Title:   "entropy interval",
+		Content: &ProposalContent{Entropy: &EntropyParams{Interval: interval}},
+	}
+}
+
+func TestEndVoting(t *testing.T) {
+	validator := testValidator(ed25519.GenPrivKey(), 10)
+	state := &State{
+		Validators:       []*Validator{validator},
+		GovernanceParams: &GovernanceParams{VotingPeriod: 10, Quorum: 50, Threshold: 50},
+	}
+
+	// proposals 1 and 2 end at height 11, proposal 3 at height 12
+	for _, proposal := range []*Proposal{testProposal(5), testProposal(6)} {
+		if err := state.submitProposal(proposal, *validator.Address, 1); err != nil {
+			t.Fatalf("failed to submit proposal; %s", err.Error())
+		}
+	}
+	if err := state.submitProposal(testProposal(7), *validator.Address, 2); err != nil {
+		t.Fatalf("failed to submit proposal; %s", err.Error())
+	}
+
+	for _, id := range []uint64{1, 3} {
+		if err := state.castVote(&Vote{ProposalID: id, Option: voteOptionYes}, *validator.Address, 2); err != nil {
+			t.Fatalf("failed to vote on proposal %d; %s", id, err.Error())
+		}
+	}
+
+	tests := []struct {
+		height   int64
+		tallied  map[uint64]string // id -> status
+		open     []uint64
+		interval int64
+	}{
+		{height: 10, open: []uint64{1, 2, 3}},
+		{height: 11, tallied: map[uint64]string{1: proposalStatusPassed, 2: proposalStatusRejected}, open: []uint64{3}, interval: 5},
+		{height: 12, tallied: map[uint64]string{3: proposalStatusPassed}, interval: 7},
+		{height: 13},
+	}
+
+	for _, test := range tests {
+		_, events := state.endVoting(test.height)
+		if len(events) != len(test.tallied) {
+			t.Fatalf("expected %d tallied proposals at height %d; got %d", len(test.tallied), test.height, len(events))
+		}
+
+		for _, event := range events {
+			var proposal *Proposal
+			err := json.Unmarshal(event.Attributes[0].Value, &proposal)
+			if err != nil {
+				t.Fatalf("failed to unmarshal tallied proposal; %s", err.Error())
+			}
+
+			if status, ok := test.tallied[proposal.ID]; !ok || proposal.Status != status {
+				t.Fatalf("expected proposal %d to be %s at height %d; got %s", proposal.ID, status, test.height, proposal.Status)
+			}
+		}
+
+		if len(state.Proposals) != len(test.open) {
+			t.Fatalf("expected %d open proposals after height %d; got %d", len(test.open), test.height, len(state.Proposals))
+		}
+
+		for _, id := range test.open {
+			if state.Proposals[id] == nil {
+				t.Fatalf("expected proposal %d to be open after height %d", id, test.height)
+			}
+		}
+
+		if _, ok := state.ProposalEndHeights[test.height]; ok {
+			t.Fatalf("expected no proposals indexed at height %d after voting ended", test.height)
+		}
+
+		if test.interval > 0 && state.EntropyParams.Interval != test.interval {
+			t.Fatalf("expected entropy interval %d after height %d; got %d", test.interval, test.height, state.EntropyParams.Interval)
+		}
+	}
+
+	if err := state.castVote(&Vote{ProposalID: 1, Option: voteOptionNo}, *validator.Address, 12); err == nil {
+		t.Fatal("expected a vote on a tallied proposal to be rejected")
+	}
+}
+
+func TestTallyResultPassed(t *testing.T) {
+	params := &GovernanceParams{Quorum: 40, Threshold: 50}
+
+	tests := []struct {
+		name   string
+		tally  *TallyResult
+		passed bool
+	}{
+		{name: "no voting power", tally: &TallyResult{}},
+		{name: "quorum met exactly", tally: &TallyResult{Yes: 40, Total: 100}, passed: true},
+		{name: "quorum missed", tally: &TallyResult{Yes: 39, Total: 100}},
+		{name: "abstentions count toward quorum", tally: &TallyResult{Yes: 10, Abstain: 30, Total: 100}, passed: true},
+		{name: "threshold met exactly", tally: &TallyResult{Yes: 25, No: 25, Total: 100}},
+		{name: "threshold exceeded", tally: &TallyResult{Yes: 26, No: 25, Total: 100}, passed: true},
+		{name: "threshold missed", tally: &TallyResult{Yes: 24, No: 26, Total: 100}},
+		{name: "abstentions only", tally: &TallyResult{Abstain: 100, Total: 100}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.tally.passed(params) != test.passed {
+				t.Fatalf("expected passed: %v", test.passed)
+			}
+		})
+	}
+}
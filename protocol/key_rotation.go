@@ -0,0 +1,304 @@
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/providenetwork/baseledger/common"
+	abcitypes "github.com/providenetwork/tendermint/abci/types"
+	"github.com/providenetwork/tendermint/crypto"
+	"github.com/providenetwork/tendermint/crypto/ed25519"
+	"github.com/providenetwork/tendermint/crypto/tmhash"
+	tmcrypto "github.com/providenetwork/tendermint/proto/tendermint/crypto"
+)
+
+const stateKeyPrefixKeyRotations = "key_rotations/pending/"
+const stateKeyPrefixRotatedKeys = "key_rotations/rotated/"
+
+// KeyRotation moves a validator, with its stake, to a new consensus key at
+// the end of the given height; tendermint applies validator updates two
+// blocks after they are returned, so the new key signs blocks from height
+// + 2. The rotation is signed by the current key as the transaction signer,
+// and by the new key to prove it is held by the validator
+type KeyRotation struct {
+	PublicKey []byte `json:"public_key"`
+	Height    int64  `json:"height"`
+	Signature []byte `json:"signature"`
+
+	// set when the rotation is scheduled
+	Validator    string `json:"validator,omitempty"`
+	Address      string `json:"address,omitempty"`
+	SubmitHeight int64  `json:"submit_height,omitempty"`
+}
+
+// KeyRotationTransaction returns a key rotation transaction which moves the
+// validator holding the current key to the new key at the end of the given
+// height, signed by both keys for the given chain using the given nonce
+func KeyRotationTransaction(chainID string, current, next crypto.PrivKey, nonce uint64, height int64) (*Transaction, error) {
+	rotation := &KeyRotation{
+		PublicKey: next.PubKey().Bytes(),
+		Height:    height,
+	}
+
+	msg, err := rotation.signBytes(chainID, current.PubKey().Bytes(), nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	rotation.Signature, err = next.Sign(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := transactionFactory(transactionOpcodeKeyRotation, rotation)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Sign(chainID, current, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	return tx, nil
+}
+
+func keyRotationStateKey(address string) string {
+	return fmt.Sprintf("%s%s", stateKeyPrefixKeyRotations, address)
+}
+
+func rotatedKeyStateKey(address string) string {
+	return fmt.Sprintf("%s%s", stateKeyPrefixRotatedKeys, address)
+}
+
+// signBytes returns the bytes signed by the new key; these bind the rotation
+// to the chain, the current key and the nonce of the transaction, so the
+// signature cannot be replayed by another validator or on another chain
+func (r *KeyRotation) signBytes(chainID string, signer []byte, nonce uint64) ([]byte, error) {
+	return json.Marshal(&struct {
+		ChainID   string `json:"chain_id"`
+		Signer    []byte `json:"signer"`
+		Nonce     uint64 `json:"nonce"`
+		PublicKey []byte `json:"public_key"`
+		Height    int64  `json:"height"`
+	}{
+		ChainID:   chainID,
+		Signer:    signer,
+		Nonce:     nonce,
+		PublicKey: r.PublicKey,
+		Height:    r.Height,
+	})
+}
+
+// verify the new key signed the rotation on behalf of the given signer
+func (r *KeyRotation) verify(chainID string, signer []byte, nonce uint64) error {
+	if len(r.PublicKey) != ed25519.PubKeySize {
+		return errors.New("key rotation requires an ed25519 public key")
+	}
+
+	if r.Height <= 0 {
+		return fmt.Errorf("invalid key rotation height: %d", r.Height)
+	}
+
+	if len(r.Signature) == 0 {
+		return errors.New("key rotation requires a signature by the new key")
+	}
+
+	msg, err := r.signBytes(chainID, signer, nonce)
+	if err != nil {
+		return err
+	}
+
+	if !ed25519.PubKey(r.PublicKey).VerifySignature(msg, r.Signature) {
+		return fmt.Errorf("invalid key rotation signature for new key %s", r.address())
+	}
+
+	return nil
+}
+
+// address returns the validator address of the new key
+func (r *KeyRotation) address() string {
+	return crypto.Address(tmhash.SumTruncated(r.PublicKey)).String()
+}
+
+// resolveValidator returns the validator with the given address, following
+// any key rotations from the address to the current key of the validator,
+// or nil
+func (s *State) resolveValidator(address []byte) *Validator {
+	current := string(address)
+	for i := 0; i <= len(s.RotatedKeys); i++ {
+		if validator := s.GetValidator([]byte(current)); validator != nil {
+			return validator
+		}
+
+		next, ok := s.RotatedKeys[current]
+		if !ok {
+			return nil
+		}
+		current = next
+	}
+
+	return nil
+}
+
+// scheduleKeyRotation schedules the rotation of the given validator to a new
+// key within the key rotation window of the governance params; a validator
+// may have a single rotation pending, and the new key must never have been
+// used by a validator
+func (s *State) scheduleKeyRotation(rotation *KeyRotation, validator *Validator, height int64) error {
+	if rotation.Height < height {
+		return fmt.Errorf("key rotation height %d must not precede the current height %d", rotation.Height, height)
+	}
+
+	window := s.GovernanceParams.keyRotationWindow()
+	if rotation.Height > height+window {
+		return fmt.Errorf("key rotation height %d must not exceed the current height %d by more than %d blocks", rotation.Height, height, window)
+	}
+
+	address := rotation.address()
+	if address == *validator.Address {
+		return errors.New("key rotation requires a new key")
+	}
+
+	if s.GetValidator([]byte(address)) != nil {
+		return fmt.Errorf("key %s is already used by a validator", address)
+	}
+
+	if _, ok := s.RotatedKeys[address]; ok {
+		return fmt.Errorf("key %s was rotated out and cannot be used again", address)
+	}
+
+	if _, ok := s.KeyRotations[*validator.Address]; ok {
+		return fmt.Errorf("validator %s already has a key rotation pending", *validator.Address)
+	}
+
+	for _, pending := range s.KeyRotations {
+		if pending.Address == address {
+			return fmt.Errorf("key %s is the new key of the pending rotation of validator %s", address, pending.Validator)
+		}
+	}
+
+	if s.KeyRotations == nil {
+		s.KeyRotations = map[string]*KeyRotation{}
+	}
+
+	rotation.Validator = *validator.Address
+	rotation.Address = address
+	rotation.SubmitHeight = height
+	s.KeyRotations[rotation.Validator] = rotation
+
+	return nil
+}
+
+// applyKeyRotations applies the key rotations scheduled up to the given
+// height, moving each validator to its new key with its stake, nonce and
+// votes, and returns the resulting validator updates; a rotation which can
+// no longer be applied, e.g. because the validator withdrew its stake, is
+// dropped
+func (s *State) applyKeyRotations(height int64) []abcitypes.ValidatorUpdate {
+	updates := make([]abcitypes.ValidatorUpdate, 0)
+
+	addresses := make([]string, 0, len(s.KeyRotations))
+	for address, rotation := range s.KeyRotations {
+		if rotation.Height <= height {
+			addresses = append(addresses, address)
+		}
+	}
+	sort.Strings(addresses)
+
+	for _, address := range addresses {
+		rotation := s.KeyRotations[address]
+		delete(s.KeyRotations, address)
+
+		validator := s.GetValidator([]byte(address))
+		if validator == nil || validator.VotingPower() <= 0 {
+			common.Log.Warningf("dropped key rotation of validator %s at height %d; validator is not staked", address, height)
+			continue
+		}
+
+		if s.GetValidator([]byte(rotation.Address)) != nil {
+			common.Log.Warningf("dropped key rotation of validator %s at height %d; key %s is already used by a validator", address, height, rotation.Address)
+			continue
+		}
+
+		// remove the current key from the validator set
+		updates = append(updates, abcitypes.ValidatorUpdate{
+			PubKey: tmcrypto.PublicKey{
+				Sum: &tmcrypto.PublicKey_Ed25519{
+					Ed25519: validator.PublicKey,
+				},
+			},
+			Power: 0,
+		})
+
+		// the node key is not rotated with the validator key, so a validator
+		// known by its address keeps that address as its node id
+		validator.NodeID = common.StringOrNil(validator.nodeID())
+		validator.Address = common.StringOrNil(rotation.Address)
+		validator.PublicKey = rotation.PublicKey
+		updates = append(updates, validator.AsValidatorUpdate())
+
+		if s.RotatedKeys == nil {
+			s.RotatedKeys = map[string]string{}
+		}
+		s.RotatedKeys[address] = rotation.Address
+		s.rekeyValidator(address, rotation.Address)
+
+		common.Log.Debugf("rotated validator %s to key %s at height %d", address, rotation.Address, height)
+	}
+
+	return updates
+}
+
+// rekeyValidator moves the open proposals, the votes on them and the
+// approvals of pending peer registry changes from the given address to the
+// new address
+func (s *State) rekeyValidator(address, rotated string) {
+	for _, proposal := range s.Proposals {
+		if proposal.Status != proposalStatusVoting {
+			continue
+		}
+
+		if proposal.Proposer == address {
+			proposal.Proposer = rotated
+		}
+
+		if option, ok := proposal.Votes[address]; ok {
+			delete(proposal.Votes, address)
+			proposal.Votes[rotated] = option
+		}
+	}
+
+	if s.PeerRegistry != nil {
+		for _, pending := range s.PeerRegistry.Pending {
+			for i, approval := range pending.Approvals {
+				if approval == address {
+					pending.Approvals[i] = rotated
+				}
+			}
+		}
+	}
+}
+
+// mergeValidatorUpdates returns the given validator updates with a single
+// update per key, as required by tendermint; a later update of a key
+// replaces an earlier one
+func mergeValidatorUpdates(updates []abcitypes.ValidatorUpdate) []abcitypes.ValidatorUpdate {
+	merged := make([]abcitypes.ValidatorUpdate, 0, len(updates))
+	index := map[string]int{}
+
+	for _, update := range updates {
+		key := string(update.PubKey.GetEd25519())
+		if i, ok := index[key]; ok {
+			merged[i] = update
+			continue
+		}
+
+		index[key] = len(merged)
+		merged = append(merged, update)
+	}
+
+	return merged
+}
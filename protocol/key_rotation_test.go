@@ -0,0 +1,172 @@
+package protocol
+
+import (
+	"bytes"
+	"testing"
+
+	abcitypes "github.com/providenetwork/tendermint/abci/types"
+	"github.com/providenetwork/tendermint/crypto/ed25519"
+	tmcrypto "github.com/providenetwork/tendermint/proto/tendermint/crypto"
+)
+
+func testValidatorUpdate(key []byte, power int64) abcitypes.ValidatorUpdate {
+	return abcitypes.ValidatorUpdate{
+		PubKey: tmcrypto.PublicKey{Sum: &tmcrypto.PublicKey_Ed25519{Ed25519: key}},
+		Power:  power,
+	}
+}
+
+func TestScheduleKeyRotation(t *testing.T) {
+	validatorKey := ed25519.GenPrivKey()
+	otherKey := ed25519.GenPrivKey()
+	rotatedKey := ed25519.GenPrivKey()
+
+	tests := []struct {
+		name   string
+		key    ed25519.PrivKey
+		height int64 // the state is at height 100, with a window of 10 blocks
+		err    bool
+	}{
+		{name: "current height", key: ed25519.GenPrivKey(), height: 100},
+		{name: "last height of the window", key: ed25519.GenPrivKey(), height: 110},
+		{name: "past height", key: ed25519.GenPrivKey(), height: 99, err: true},
+		{name: "beyond the window", key: ed25519.GenPrivKey(), height: 111, err: true},
+		{name: "current key", key: validatorKey, height: 105, err: true},
+		{name: "key of another validator", key: otherKey, height: 105, err: true},
+		{name: "key rotated out", key: rotatedKey, height: 105, err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			validator := testValidator(validatorKey, 10)
+			state := &State{
+				Validators:       []*Validator{validator, testValidator(otherKey, 10)},
+				GovernanceParams: &GovernanceParams{KeyRotationWindow: 10},
+				RotatedKeys:      map[string]string{rotatedKey.PubKey().Address().String(): *validator.Address},
+			}
+
+			rotation := &KeyRotation{PublicKey: test.key.PubKey().Bytes(), Height: test.height}
+			err := state.scheduleKeyRotation(rotation, validator, 100)
+			if (err != nil) != test.err {
+				t.Fatalf("expected error: %v; got %v", test.err, err)
+			}
+
+			if _, ok := state.KeyRotations[*validator.Address]; ok == test.err {
+				t.Fatalf("expected key rotation pending: %v", !test.err)
+			}
+		})
+	}
+}
+
+func TestApplyKeyRotations(t *testing.T) {
+	validatorKey := ed25519.GenPrivKey()
+	nextKey := ed25519.GenPrivKey()
+	validator := testValidator(validatorKey, 10)
+	address := *validator.Address
+
+	state := &State{
+		Validators: []*Validator{validator},
+		Proposals: map[uint64]*Proposal{
+			1: {ID: 1, Proposer: address, Status: proposalStatusVoting, Votes: map[string]string{address: voteOptionYes}},
+		},
+	}
+
+	rotation := &KeyRotation{PublicKey: nextKey.PubKey().Bytes(), Height: 105}
+	if err := state.scheduleKeyRotation(rotation, validator, 100); err != nil {
+		t.Fatalf("failed to schedule key rotation; %s", err.Error())
+	}
+
+	if updates := state.applyKeyRotations(104); len(updates) != 0 {
+		t.Fatalf("expected no validator updates before the rotation height; got %d", len(updates))
+	}
+
+	updates := state.applyKeyRotations(105)
+	if len(updates) != 2 {
+		t.Fatalf("expected validator updates for the current and new key; got %d", len(updates))
+	}
+
+	if !bytes.Equal(updates[0].PubKey.GetEd25519(), validatorKey.PubKey().Bytes()) || updates[0].Power != 0 {
+		t.Fatal("expected the current key to be removed from the validator set")
+	}
+
+	if !bytes.Equal(updates[1].PubKey.GetEd25519(), nextKey.PubKey().Bytes()) || updates[1].Power != validator.VotingPower() {
+		t.Fatal("expected the new key to carry the voting power of the validator")
+	}
+
+	rotated := nextKey.PubKey().Address().String()
+	if resolved := state.resolveValidator([]byte(address)); resolved == nil || *resolved.Address != rotated {
+		t.Fatalf("expected address %s to resolve to the new key %s", address, rotated)
+	}
+
+	if state.Proposals[1].Proposer != rotated || state.Proposals[1].Votes[rotated] != voteOptionYes {
+		t.Fatal("expected the open proposal and its vote to move to the new key")
+	}
+
+	if len(state.KeyRotations) != 0 {
+		t.Fatalf("expected no key rotations pending; got %d", len(state.KeyRotations))
+	}
+}
+
+func TestApplyKeyRotationsUnstaked(t *testing.T) {
+	validator := testValidator(ed25519.GenPrivKey(), 10)
+	state := &State{Validators: []*Validator{validator}}
+
+	rotation := &KeyRotation{PublicKey: ed25519.GenPrivKey().PubKey().Bytes(), Height: 100}
+	if err := state.scheduleKeyRotation(rotation, validator, 100); err != nil {
+		t.Fatalf("failed to schedule key rotation; %s", err.Error())
+	}
+
+	stake := int64(0)
+	validator.Stake = &stake
+
+	if updates := state.applyKeyRotations(100); len(updates) != 0 {
+		t.Fatalf("expected the rotation of an unstaked validator to be dropped; got %d updates", len(updates))
+	}
+
+	if len(state.KeyRotations) != 0 || len(state.RotatedKeys) != 0 {
+		t.Fatal("expected the dropped rotation to leave no key rotation behind")
+	}
+}
+
+func TestMergeValidatorUpdates(t *testing.T) {
+	current := ed25519.GenPrivKey().PubKey().Bytes()
+	next := ed25519.GenPrivKey().PubKey().Bytes()
+	other := ed25519.GenPrivKey().PubKey().Bytes()
+
+	tests := []struct {
+		name    string
+		updates []abcitypes.ValidatorUpdate
+		merged  []abcitypes.ValidatorUpdate
+	}{
+		{
+			name:    "distinct keys",
+			updates: []abcitypes.ValidatorUpdate{testValidatorUpdate(current, 10), testValidatorUpdate(other, 5)},
+			merged:  []abcitypes.ValidatorUpdate{testValidatorUpdate(current, 10), testValidatorUpdate(other, 5)},
+		},
+		{
+			name:    "stake change of a rotated key",
+			updates: []abcitypes.ValidatorUpdate{testValidatorUpdate(current, 20), testValidatorUpdate(current, 0), testValidatorUpdate(next, 20)},
+			merged:  []abcitypes.ValidatorUpdate{testValidatorUpdate(current, 0), testValidatorUpdate(next, 20)},
+		},
+		{
+			name:    "stake change of a new key",
+			updates: []abcitypes.ValidatorUpdate{testValidatorUpdate(current, 0), testValidatorUpdate(next, 10), testValidatorUpdate(other, 5), testValidatorUpdate(next, 20)},
+			merged:  []abcitypes.ValidatorUpdate{testValidatorUpdate(current, 0), testValidatorUpdate(next, 20), testValidatorUpdate(other, 5)},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			merged := mergeValidatorUpdates(test.updates)
+			if len(merged) != len(test.merged) {
+				t.Fatalf("expected %d validator updates; got %d", len(test.merged), len(merged))
+			}
+
+			for i, update := range test.merged {
+				if !bytes.Equal(merged[i].PubKey.GetEd25519(), update.PubKey.GetEd25519()) || merged[i].Power != update.Power {
+					t.Fatalf("expected validator update %d to set power %d; got %d", i, update.Power, merged[i].Power)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/providenetwork/tendermint/crypto/merkle"
+	"github.com/providenetwork/tendermint/crypto/tmhash"
+	tmcrypto "github.com/providenetwork/tendermint/proto/tendermint/crypto"
+)
+
+const stateKeyPrefixEntropy = "entropy/"
+const stateKeyPrefixEntropyRequests = "entropy_requests/"
+const stateKeyPrefixParams = "params/"
+const stateKeyPrefixValidators = "validators/"
+
+const stateParamsEntropy = "entropy"
+const stateParamsStaking = "staking"
+
+// stateRecord is a single key-value pair committed to by the state root
+type stateRecord struct {
+	key   string
+	value []byte
+}
+
+func entropyStateKey(height int64) string {
+	return fmt.Sprintf("%s%020d", stateKeyPrefixEntropy, height)
+}
+
+func entropyRequestStateKey(height int64) string {
+	return fmt.Sprintf("%s%020d", stateKeyPrefixEntropyRequests, height)
+}
+
+func paramsStateKey(name string) string {
+	return fmt.Sprintf("%s%s", stateKeyPrefixParams, name)
+}
+
+func validatorStateKey(address string) string {
+	return fmt.Sprintf("%s%s", stateKeyPrefixValidators, address)
+}
+
+// records returns the key-ordered records committed to by the state root
+func (s *State) records() ([]*stateRecord, error) {
+	records := make([]*stateRecord, 0)
+
+	add := func(key string, val interface{}) error {
+		raw, err := json.Marshal(val)
+		if err != nil {
+			return fmt.Errorf("failed to marshal state record %s; %s", key, err.Error())
+		}
+		records = append(records, &stateRecord{key: key, value: raw})
+		return nil
+	}
+
+	if s.ConsensusParams != nil {
+		if err := add(paramsStateKey(stateParamsConsensus), s.ConsensusParams); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.EntropyParams != nil {
+		if err := add(paramsStateKey(stateParamsEntropy), s.EntropyParams); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.GovernanceParams != nil {
+		if err := add(paramsStateKey(stateParamsGovernance), s.GovernanceParams); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.Staking != nil {
+		if err := add(paramsStateKey(stateParamsStaking), s.Staking); err != nil {
+			return nil, err
+		}
+	}
+
+	for address, balance := range s.Accounts {
+		if err := add(accountStateKey(address), balance); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, validator := range s.Validators {
+		if validator.Address == nil {
+			continue
+		}
+		if err := add(validatorStateKey(*validator.Address), validator); err != nil {
+			return nil, err
+		}
+	}
+
+	for height, entropy := range s.Entropy {
+		if err := add(entropyStateKey(height), entropy); err != nil {
+			return nil, err
+		}
+	}
+
+	for height, req := range s.EntropyRequests {
+		if err := add(entropyRequestStateKey(height), req); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.PeerRegistry != nil {
+		if err := add(paramsStateKey(stateParamsPeerRegistry), &PeerRegistryParams{Enabled: s.PeerRegistry.Enabled}); err != nil {
+			return nil, err
+		}
+
+		for nodeID, height := range s.PeerRegistry.Nodes {
+			if err := add(peerRegistryNodeStateKey(nodeID), height); err != nil {
+				return nil, err
+			}
+		}
+
+		for key, pending := range s.PeerRegistry.Pending {
+			if err := add(peerRegistryPendingStateKey(key), pending); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// the proposal count assigns the next proposal id, so it is committed
+	// even when no proposals are stored
+	if err := add(stateKeyProposalCount, s.ProposalCount); err != nil {
+		return nil, err
+	}
+
+	for id, proposal := range s.Proposals {
+		if err := add(proposalStateKey(id), proposal); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.UpgradePlan != nil {
+		if err := add(stateKeyUpgradePlan, s.UpgradePlan); err != nil {
+			return nil, err
+		}
+	}
+
+	for name, height := range s.AppliedUpgrades {
+		if err := add(appliedUpgradeStateKey(name), height); err != nil {
+			return nil, err
+		}
+	}
+
+	for address, rotation := range s.KeyRotations {
+		if err := add(keyRotationStateKey(address), rotation); err != nil {
+			return nil, err
+		}
+	}
+
+	for address, rotated := range s.RotatedKeys {
+		if err := add(rotatedKeyStateKey(address), rotated); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].key < records[j].key
+	})
+
+	return records, nil
+}
+
+// calculateRoot returns the merkle root of the state records; the root is
+// reported to tendermint as the application hash
+func (s *State) calculateRoot() ([]byte, error) {
+	records, err := s.records()
+	if err != nil {
+		return nil, err
+	}
+
+	return merkle.HashFromByteSlices(stateRecordLeaves(records)), nil
+}
+
+// prove returns the value stored at the given key with a merkle proof of its
+// inclusion under the state root
+func (s *State) prove(key string) ([]byte, *tmcrypto.ProofOps, error) {
+	records, err := s.records()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	root, proofs := merkle.ProofsFromByteSlices(stateRecordLeaves(records))
+	for i, record := range records {
+		if record.key == key {
+			if !bytes.Equal(root, s.Root) {
+				return nil, nil, fmt.Errorf("state root mismatch at height %d", s.Height)
+			}
+
+			op := merkle.NewValueOp([]byte(key), proofs[i]).ProofOp()
+			return record.value, &tmcrypto.ProofOps{Ops: []tmcrypto.ProofOp{op}}, nil
+		}
+	}
+
+	return nil, nil, fmt.Errorf("no state record for key: %s", key)
+}
+
+// stateRecordLeaves encodes each record as a length-prefixed key and value
+// hash, compatible with the tendermint simple:v proof operator
+func stateRecordLeaves(records []*stateRecord) [][]byte {
+	leaves := make([][]byte, len(records))
+	for i, record := range records {
+		buf := new(bytes.Buffer)
+		encodeByteSlice(buf, []byte(record.key))
+		encodeByteSlice(buf, tmhash.Sum(record.value))
+		leaves[i] = buf.Bytes()
+	}
+
+	return leaves
+}
+
+func encodeByteSlice(buf *bytes.Buffer, bz []byte) {
+	var prefix [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(prefix[:], uint64(len(bz)))
+	buf.Write(prefix[:n])
+	buf.Write(bz)
+}
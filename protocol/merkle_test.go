@@ -0,0 +1,127 @@
+package protocol
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/providenetwork/tendermint/crypto/ed25519"
+	"github.com/providenetwork/tendermint/crypto/merkle"
+)
+
+// testMerkleState returns a state holding entropy at the given heights
+func testMerkleState(validators []*Validator, heights ...int64) *State {
+	state := &State{
+		Validators:   validators,
+		Entropy:      map[int64]*Entropy{},
+		KeyRotations: map[string]*KeyRotation{},
+	}
+
+	for _, height := range heights {
+		state.SetEntropy(&Entropy{Height: height, Output: []byte{byte(height)}})
+	}
+
+	return state
+}
+
+func TestCalculateRootStable(t *testing.T) {
+	validators := []*Validator{
+		testValidator(ed25519.GenPrivKey(), 10),
+		testValidator(ed25519.GenPrivKey(), 20),
+	}
+
+	root, err := testMerkleState(validators, 100, 200, 300).calculateRoot()
+	if err != nil {
+		t.Fatalf("failed to calculate state root; %s", err.Error())
+	}
+
+	synced := &State{}
+	err = synced.sync(testMerkleState(validators, 100, 200, 300))
+	if err != nil {
+		t.Fatalf("failed to sync state; %s", err.Error())
+	}
+
+	changed := testMerkleState(validators, 100, 200, 300)
+	changed.Entropy[200].Output = []byte{0}
+
+	tests := []struct {
+		name  string
+		state *State
+		equal bool
+	}{
+		{name: "same records", state: testMerkleState(validators, 100, 200, 300), equal: true},
+		{name: "records inserted in another order", state: testMerkleState(validators, 300, 100, 200), equal: true},
+		{name: "synced copy", state: synced, equal: true},
+		{name: "changed record", state: changed},
+		{name: "missing record", state: testMerkleState(validators, 100, 200)},
+		{name: "additional record", state: testMerkleState(validators, 100, 200, 300, 400)},
+		{name: "validators in another order", state: testMerkleState([]*Validator{validators[1], validators[0]}, 100, 200, 300), equal: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			other, err := test.state.calculateRoot()
+			if err != nil {
+				t.Fatalf("failed to calculate state root; %s", err.Error())
+			}
+
+			if bytes.Equal(root, other) != test.equal {
+				t.Fatalf("expected equal roots: %v; got %X and %X", test.equal, root, other)
+			}
+		})
+	}
+}
+
+func TestProve(t *testing.T) {
+	state := testMerkleState([]*Validator{testValidator(ed25519.GenPrivKey(), 10)}, 100, 200, 300)
+	root, err := state.calculateRoot()
+	if err != nil {
+		t.Fatalf("failed to calculate state root; %s", err.Error())
+	}
+	state.Root = root
+
+	key := entropyStateKey(200)
+	value, proof, err := state.prove(key)
+	if err != nil {
+		t.Fatalf("failed to prove state record; %s", err.Error())
+	}
+
+	keyPath := new(merkle.KeyPath).AppendKey([]byte(key), merkle.KeyEncodingURL).String()
+	otherKeyPath := new(merkle.KeyPath).AppendKey([]byte(entropyStateKey(100)), merkle.KeyEncodingURL).String()
+
+	tests := []struct {
+		name    string
+		root    []byte
+		keyPath string
+		value   []byte
+		valid   bool
+	}{
+		{name: "proved record", root: root, keyPath: keyPath, value: value, valid: true},
+		{name: "tampered value", root: root, keyPath: keyPath, value: append([]byte{' '}, value...)},
+		{name: "another key", root: root, keyPath: otherKeyPath, value: value},
+		{name: "another root", root: bytes.Repeat([]byte{1}, len(root)), keyPath: keyPath, value: value},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := merkle.DefaultProofRuntime().VerifyValue(proof, test.root, test.keyPath, test.value)
+			if test.valid && err != nil {
+				t.Fatalf("expected proof to verify; %s", err.Error())
+			}
+
+			if !test.valid && err == nil {
+				t.Fatal("expected proof to be rejected")
+			}
+		})
+	}
+
+	_, _, err = state.prove(entropyStateKey(400))
+	if err == nil {
+		t.Fatal("expected no proof for a missing record")
+	}
+
+	state.SetEntropy(&Entropy{Height: 400})
+	_, _, err = state.prove(key)
+	if err == nil {
+		t.Fatal("expected no proof once the state no longer matches its root")
+	}
+}
@@ -0,0 +1,188 @@
+package protocol
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/providenetwork/baseledger/common"
+	"github.com/providenetwork/tendermint/crypto"
+	"github.com/providenetwork/tendermint/crypto/ed25519"
+)
+
+// nodeRegistrationRetryInterval is the number of blocks after which a node
+// registration which has not been committed is dispatched again
+const nodeRegistrationRetryInterval = int64(100)
+
+// NodeRegistration binds a validator to the node ID of its p2p node key, so
+// peers recognize the validator's node when its node key differs from its
+// validator key; the registration is signed by the validator as the
+// transaction signer, and by the node key to prove it is held by the
+// validator
+type NodeRegistration struct {
+	PublicKey []byte `json:"public_key"`
+	Signature []byte `json:"signature"`
+}
+
+// NodeRegistrationTransaction returns a node registration transaction which
+// binds the validator holding the given validator key to the given node key,
+// signed by both keys for the given chain using the given nonce
+func NodeRegistrationTransaction(chainID string, validator, node crypto.PrivKey, nonce uint64) (*Transaction, error) {
+	registration := &NodeRegistration{
+		PublicKey: node.PubKey().Bytes(),
+	}
+
+	msg, err := registration.signBytes(chainID, validator.PubKey().Bytes(), nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	registration.Signature, err = node.Sign(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := transactionFactory(transactionOpcodeNodeRegistration, registration)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Sign(chainID, validator, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	return tx, nil
+}
+
+// signBytes returns the bytes signed by the node key; these bind the
+// registration to the chain, the validator and the nonce of the transaction,
+// so the signature cannot be replayed by another validator
+func (r *NodeRegistration) signBytes(chainID string, signer []byte, nonce uint64) ([]byte, error) {
+	return json.Marshal(&struct {
+		ChainID   string `json:"chain_id"`
+		Signer    []byte `json:"signer"`
+		Nonce     uint64 `json:"nonce"`
+		PublicKey []byte `json:"public_key"`
+	}{
+		ChainID:   chainID,
+		Signer:    signer,
+		Nonce:     nonce,
+		PublicKey: r.PublicKey,
+	})
+}
+
+// verify the node key signed the registration on behalf of the given signer
+func (r *NodeRegistration) verify(chainID string, signer []byte, nonce uint64) error {
+	if len(r.PublicKey) != ed25519.PubKeySize {
+		return errors.New("node registration requires an ed25519 node public key")
+	}
+
+	if len(r.Signature) == 0 {
+		return errors.New("node registration requires a signature by the node key")
+	}
+
+	msg, err := r.signBytes(chainID, signer, nonce)
+	if err != nil {
+		return err
+	}
+
+	if !ed25519.PubKey(r.PublicKey).VerifySignature(msg, r.Signature) {
+		return fmt.Errorf("invalid node registration signature for node %s", r.nodeID())
+	}
+
+	return nil
+}
+
+// nodeID returns the p2p node ID of the registered node key
+func (r *NodeRegistration) nodeID() string {
+	return hex.EncodeToString(ed25519.PubKey(r.PublicKey).Address())
+}
+
+// nodeID returns the p2p node ID of the validator; a validator which has not
+// registered a node ID is assumed to use its validator key as its node key,
+// as vault nodes do
+func (v *Validator) nodeID() string {
+	if v.NodeID != nil {
+		return *v.NodeID
+	}
+
+	if v.Address == nil {
+		return ""
+	}
+
+	return strings.ToLower(*v.Address)
+}
+
+// validatorByNodeID returns the validator whose node has the given node ID,
+// or nil
+func (s *State) validatorByNodeID(nodeID string) *Validator {
+	for _, validator := range s.Validators {
+		if strings.EqualFold(validator.nodeID(), nodeID) {
+			return validator
+		}
+	}
+
+	return nil
+}
+
+// registerNodeID binds the given validator to the given node ID, which must
+// not be the node ID of another validator
+func (s *State) registerNodeID(validator *Validator, nodeID string) error {
+	if existing := s.validatorByNodeID(nodeID); existing != nil && existing != validator {
+		return fmt.Errorf("node id %s is the node id of validator %s", nodeID, *existing.Address)
+	}
+
+	validator.NodeID = common.StringOrNil(nodeID)
+	return nil
+}
+
+// registerNodeID dispatches a node registration for the validator of this
+// node once the network does not know its node by the node ID of its node
+// key, e.g. because the node key is kept apart from the validator key; the
+// registration is dispatched again if it has not been committed after
+// nodeRegistrationRetryInterval blocks
+func (b *Baseline) registerNodeID() {
+	if b.validatorKey == nil || b.nodeKey == nil || b.BroadcastTx == nil {
+		return
+	}
+
+	height := b.CommitState.Height
+	if b.nodeRegistrationHeight > 0 && height < b.nodeRegistrationHeight+nodeRegistrationRetryInterval {
+		return
+	}
+
+	validator := b.CommitState.GetValidator([]byte(b.validatorKey.PubKey().Address().String()))
+	if validator == nil || validator.VotingPower() <= 0 {
+		return
+	}
+
+	nodeID := string(b.nodeKey.ID())
+	if validator.nodeID() == nodeID {
+		return
+	}
+
+	b.nodeRegistrationHeight = height
+	address := *validator.Address
+	nonce := validator.Nonce + 1
+
+	// the validator key may be held by vault, so it is not used on the
+	// routine executing blocks
+	go func() {
+		tx, err := NodeRegistrationTransaction(b.Genesis.ChainID, b.validatorKey, b.nodeKey.PrivKey, nonce)
+		if err != nil {
+			common.Log.Warningf("failed to create node registration transaction for node %s; %s", nodeID, err.Error())
+			return
+		}
+
+		err = b.BroadcastTx(tx.raw)
+		if err != nil {
+			common.Log.Warningf("failed to broadcast node registration transaction for node %s; %s", nodeID, err.Error())
+			return
+		}
+
+		common.Log.Debugf("dispatched registration of node %s for validator %s", nodeID, address)
+	}()
+}
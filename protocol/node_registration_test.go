@@ -0,0 +1,159 @@
+package protocol
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/providenetwork/baseledger/common"
+	"github.com/providenetwork/tendermint/crypto"
+	"github.com/providenetwork/tendermint/crypto/ed25519"
+	"github.com/providenetwork/tendermint/p2p"
+	"github.com/providenetwork/tendermint/types"
+)
+
+const testChainID = "protocol-test"
+
+// testValidator returns a validator for the given key with the given stake
+func testValidator(key crypto.PrivKey, stake int64) *Validator {
+	return &Validator{
+		Address:   common.StringOrNil(key.PubKey().Address().String()),
+		PublicKey: key.PubKey().Bytes(),
+		Stake:     &stake,
+	}
+}
+
+// testBaseline returns a baseline whose deliver tx state holds the given
+// validators
+func testBaseline(validators ...*Validator) *Baseline {
+	return &Baseline{
+		Genesis:        &types.GenesisDoc{ChainID: testChainID},
+		CheckTxState:   &State{Validators: validators},
+		DeliverTxState: &State{Validators: validators},
+	}
+}
+
+func TestNodeRegistrationSignatures(t *testing.T) {
+	validatorKey := ed25519.GenPrivKey()
+	nodeKey := ed25519.GenPrivKey()
+	otherKey := ed25519.GenPrivKey()
+
+	tests := []struct {
+		name string
+		tx   func(t *testing.T) *Transaction
+		code uint32
+	}{
+		{
+			name: "signed by the validator and the node key",
+			tx: func(t *testing.T) *Transaction {
+				tx, _ := NodeRegistrationTransaction(testChainID, validatorKey, nodeKey, 1)
+				return tx
+			},
+			code: transactionStatusCodeValid,
+		},
+		{
+			name: "node signature by another key",
+			tx: func(t *testing.T) *Transaction {
+				tx, _ := NodeRegistrationTransaction(testChainID, validatorKey, nodeKey, 1)
+				registration, _ := tx.nodeRegistration()
+				forged, _ := NodeRegistrationTransaction(testChainID, validatorKey, otherKey, 1)
+				forgedRegistration, _ := forged.nodeRegistration()
+				registration.Signature = forgedRegistration.Signature
+				return testResign(t, registration, validatorKey, 1)
+			},
+			code: transactionStatusCodeInvalidNodeRegistration,
+		},
+		{
+			name: "transaction signature by another key",
+			tx: func(t *testing.T) *Transaction {
+				tx, _ := NodeRegistrationTransaction(testChainID, validatorKey, nodeKey, 1)
+				tx.Signature, _ = otherKey.Sign([]byte("forged"))
+				raw, _ := json.Marshal(tx)
+				tx, _ = TransactionFromRaw(raw)
+				return tx
+			},
+			code: transactionStatusCodeUnauthorized,
+		},
+		{
+			name: "signed for another chain",
+			tx: func(t *testing.T) *Transaction {
+				tx, _ := NodeRegistrationTransaction("other-chain", validatorKey, nodeKey, 1)
+				return tx
+			},
+			code: transactionStatusCodeUnauthorized,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tx := test.tx(t)
+			if code := tx.isValid(testChainID); code != test.code {
+				t.Fatalf("expected status code %d; got %d", test.code, code)
+			}
+		})
+	}
+}
+
+func TestNodeRegistrationReplay(t *testing.T) {
+	validatorKey := ed25519.GenPrivKey()
+	otherValidatorKey := ed25519.GenPrivKey()
+	nodeKey := ed25519.GenPrivKey()
+
+	validator := testValidator(validatorKey, 10)
+	otherValidator := testValidator(otherValidatorKey, 10)
+	b := testBaseline(validator, otherValidator)
+
+	tx, err := NodeRegistrationTransaction(testChainID, validatorKey, nodeKey, 1)
+	if err != nil {
+		t.Fatalf("failed to create node registration; %s", err.Error())
+	}
+
+	resp := b.deliverNodeRegistration(tx)
+	if resp.Code != transactionStatusCodeValid {
+		t.Fatalf("expected node registration to be delivered; %s", resp.Log)
+	}
+
+	nodeID := string(p2p.PubKeyToID(nodeKey.PubKey()))
+	if validator.nodeID() != nodeID {
+		t.Fatalf("expected node id %s; got %s", nodeID, validator.nodeID())
+	}
+
+	// the same transaction must not be delivered twice
+	resp = b.deliverNodeRegistration(tx)
+	if resp.Code != transactionStatusCodeUnauthorized {
+		t.Fatalf("expected replayed node registration to be unauthorized; got code %d", resp.Code)
+	}
+
+	// the node signature must not be reusable by another validator
+	registration, _ := tx.nodeRegistration()
+	replayed := testResign(t, registration, otherValidatorKey, 1)
+	if code := replayed.isValid(testChainID); code != transactionStatusCodeInvalidNodeRegistration {
+		t.Fatalf("expected node registration replayed by another validator to be invalid; got code %d", code)
+	}
+
+	// another validator must not take over the node id, even with the node key
+	taken, _ := NodeRegistrationTransaction(testChainID, otherValidatorKey, nodeKey, 1)
+	resp = b.deliverNodeRegistration(taken)
+	if resp.Code != transactionStatusCodeInvalidNodeRegistration {
+		t.Fatalf("expected registration of a taken node id to be invalid; got code %d", resp.Code)
+	}
+
+	if otherValidator.NodeID != nil {
+		t.Fatalf("expected node id of validator %s to be unchanged", *otherValidator.Address)
+	}
+}
+
+// testResign returns a transaction carrying the given registration, signed
+// by the given validator key
+func testResign(t *testing.T, registration *NodeRegistration, validatorKey crypto.PrivKey, nonce uint64) *Transaction {
+	tx, err := transactionFactory(transactionOpcodeNodeRegistration, registration)
+	if err != nil {
+		t.Fatalf("failed to create transaction; %s", err.Error())
+	}
+
+	err = tx.Sign(testChainID, validatorKey, nonce)
+	if err != nil {
+		t.Fatalf("failed to sign transaction; %s", err.Error())
+	}
+
+	return tx
+}
@@ -0,0 +1,109 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const defaultPageLimit = 100
+const maxPageLimit = 1000
+
+// PageRequest is the pagination convention for list queries, sent as the
+// JSON-encoded query data; a page key takes precedence over an offset
+type PageRequest struct {
+	Key        string `json:"key,omitempty"`
+	Offset     int    `json:"offset,omitempty"`
+	Limit      int    `json:"limit,omitempty"`
+	CountTotal bool   `json:"count_total,omitempty"`
+}
+
+// PageResponse accompanies the results of a list query; an empty next key
+// indicates there are no further results
+type PageResponse struct {
+	NextKey string `json:"next_key,omitempty"`
+	Total   *int   `json:"total,omitempty"`
+}
+
+// PagedResults is the JSON-encoded value returned by list queries
+type PagedResults struct {
+	Results    []json.RawMessage `json:"results"`
+	Pagination *PageResponse     `json:"pagination"`
+}
+
+// StoredRecord is a key-value record returned by prefix scans
+type StoredRecord struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+// pageRequestFromQueryData parses the pagination parameters from the given
+// query data; empty data results in the default page
+func pageRequestFromQueryData(data []byte) (*PageRequest, error) {
+	page := &PageRequest{}
+	if len(data) > 0 {
+		err := json.Unmarshal(data, &page)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse pagination parameters; %s", err.Error())
+		}
+	}
+
+	if page.Offset < 0 {
+		return nil, fmt.Errorf("invalid pagination offset: %d", page.Offset)
+	}
+
+	if page.Limit < 0 {
+		return nil, fmt.Errorf("invalid pagination limit: %d", page.Limit)
+	} else if page.Limit == 0 {
+		page.Limit = defaultPageLimit
+	} else if page.Limit > maxPageLimit {
+		page.Limit = maxPageLimit
+	}
+
+	return page, nil
+}
+
+// scan returns a page of the key-ordered records having the given key prefix
+func (s *State) scan(prefix string, page *PageRequest) ([]*stateRecord, *PageResponse, error) {
+	records, err := s.records()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	start := sort.Search(len(records), func(i int) bool {
+		return records[i].key >= prefix
+	})
+
+	end := start
+	for end < len(records) && strings.HasPrefix(records[end].key, prefix) {
+		end++
+	}
+
+	matches := records[start:end]
+	resp := &PageResponse{}
+	if page.CountTotal {
+		total := len(matches)
+		resp.Total = &total
+	}
+
+	offset := page.Offset
+	if page.Key != "" {
+		offset = sort.Search(len(matches), func(i int) bool {
+			return matches[i].key >= page.Key
+		})
+	}
+
+	if offset > len(matches) {
+		offset = len(matches)
+	}
+
+	limit := offset + page.Limit
+	if limit < len(matches) {
+		resp.NextKey = matches[limit].key
+	} else {
+		limit = len(matches)
+	}
+
+	return matches[offset:limit], resp, nil
+}
@@ -0,0 +1,89 @@
+package protocol
+
+import (
+	"testing"
+)
+
+func TestPageRequestFromQueryData(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		limit  int
+		offset int
+		err    bool
+	}{
+		{name: "empty query data", limit: defaultPageLimit},
+		{name: "offset", data: `{"offset":5}`, limit: defaultPageLimit, offset: 5},
+		{name: "limit", data: `{"limit":10}`, limit: 10},
+		{name: "limit above the maximum", data: `{"limit":5000}`, limit: maxPageLimit},
+		{name: "negative offset", data: `{"offset":-1}`, err: true},
+		{name: "negative limit", data: `{"limit":-1}`, err: true},
+		{name: "malformed query data", data: `{"limit":`, err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			page, err := pageRequestFromQueryData([]byte(test.data))
+			if (err != nil) != test.err {
+				t.Fatalf("expected error: %v; got %v", test.err, err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if page.Limit != test.limit || page.Offset != test.offset {
+				t.Fatalf("expected limit %d and offset %d; got %d and %d", test.limit, test.offset, page.Limit, page.Offset)
+			}
+		})
+	}
+}
+
+func TestScan(t *testing.T) {
+	state := testMerkleState(nil, 1, 2, 3, 4, 5)
+	state.EntropyRequests = map[int64]*EntropyRequest{6: {Height: 6}}
+
+	tests := []struct {
+		name    string
+		page    *PageRequest
+		heights []int64
+		nextKey string
+	}{
+		{name: "first page", page: &PageRequest{Limit: 2}, heights: []int64{1, 2}, nextKey: entropyStateKey(3)},
+		{name: "page key", page: &PageRequest{Key: entropyStateKey(3), Limit: 2}, heights: []int64{3, 4}, nextKey: entropyStateKey(5)},
+		{name: "last page", page: &PageRequest{Key: entropyStateKey(5), Limit: 2}, heights: []int64{5}},
+		{name: "page key between records", page: &PageRequest{Key: entropyStateKey(3) + "0", Limit: 2}, heights: []int64{4, 5}},
+		{name: "page key takes precedence over offset", page: &PageRequest{Key: entropyStateKey(2), Offset: 4, Limit: 1}, heights: []int64{2}, nextKey: entropyStateKey(3)},
+		{name: "offset", page: &PageRequest{Offset: 3, Limit: 10}, heights: []int64{4, 5}},
+		{name: "offset past the end", page: &PageRequest{Offset: 10, Limit: 10}},
+		{name: "limit equal to the remaining records", page: &PageRequest{Offset: 3, Limit: 2}, heights: []int64{4, 5}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.page.CountTotal = true
+			records, resp, err := state.scan(stateKeyPrefixEntropy, test.page)
+			if err != nil {
+				t.Fatalf("failed to scan state records; %s", err.Error())
+			}
+
+			if len(records) != len(test.heights) {
+				t.Fatalf("expected %d records; got %d", len(test.heights), len(records))
+			}
+
+			for i, height := range test.heights {
+				if records[i].key != entropyStateKey(height) {
+					t.Fatalf("expected record %s; got %s", entropyStateKey(height), records[i].key)
+				}
+			}
+
+			if resp.NextKey != test.nextKey {
+				t.Fatalf("expected next key %q; got %q", test.nextKey, resp.NextKey)
+			}
+
+			if resp.Total == nil || *resp.Total != 5 {
+				t.Fatalf("expected a total of 5 records; got %v", resp.Total)
+			}
+		})
+	}
+}
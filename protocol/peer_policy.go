@@ -0,0 +1,334 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/providenetwork/baseledger/common"
+)
+
+const defaultPeerPolicyDialTimeout = time.Millisecond * 100
+const defaultPeerPolicyPeerTTL = time.Minute * 10
+
+// PeerPolicy defines which peers are admitted by the /p2p/filter queries; deny
+// lists take precedence over allow lists, and empty allow lists admit all
+type PeerPolicy struct {
+	AllowCIDRs []string `json:"allow_cidrs,omitempty"`
+	DenyCIDRs  []string `json:"deny_cidrs,omitempty"`
+	AllowIDs   []string `json:"allow_ids,omitempty"`
+	DenyIDs    []string `json:"deny_ids,omitempty"`
+
+	// MaxPeersPerIP limits the number of distinct peer addresses admitted
+	// from a single IP within the peer TTL; zero is unlimited
+	MaxPeersPerIP int    `json:"max_peers_per_ip,omitempty"`
+	PeerTTL       string `json:"peer_ttl,omitempty"`
+
+	// ValidatorsOnly admits only nodes whose ID is the node ID of a staked
+	// validator
+	ValidatorsOnly bool `json:"validators_only,omitempty"`
+
+	// RequireReachable admits only peer addresses which accept a TCP
+	// connection within the dial timeout
+	RequireReachable bool   `json:"require_reachable"`
+	DialTimeout      string `json:"dial_timeout,omitempty"`
+
+	allowNets   []*net.IPNet
+	denyNets    []*net.IPNet
+	dialTimeout time.Duration
+	peerTTL     time.Duration
+}
+
+// peerPolicyEngine evaluates peer filter queries against the configured
+// policy, reloading the policy file when it changes
+type peerPolicyEngine struct {
+	mutex   *sync.Mutex
+	path    string
+	modTime time.Time
+	policy  *PeerPolicy
+
+	reputation *peerReputationStore
+	admitted   map[string]map[string]time.Time // ip -> address -> admitted at
+}
+
+// defaultPeerPolicy admits any reachable peer
+func defaultPeerPolicy() *PeerPolicy {
+	policy := &PeerPolicy{
+		RequireReachable: true,
+	}
+	policy.compile()
+	return policy
+}
+
+func peerPolicyEngineFactory(cfg *common.Config, reputation *peerReputationStore) (*peerPolicyEngine, error) {
+	engine := &peerPolicyEngine{
+		mutex:      &sync.Mutex{},
+		policy:     defaultPeerPolicy(),
+		reputation: reputation,
+		admitted:   map[string]map[string]time.Time{},
+	}
+
+	if cfg.PeerPolicyPath != nil {
+		engine.path = *cfg.PeerPolicyPath
+		err := engine.reload()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return engine, nil
+}
+
+// compile parses the network and duration parameters of the policy
+func (p *PeerPolicy) compile() error {
+	var err error
+
+	p.allowNets, err = parseCIDRs(p.AllowCIDRs)
+	if err != nil {
+		return err
+	}
+
+	p.denyNets, err = parseCIDRs(p.DenyCIDRs)
+	if err != nil {
+		return err
+	}
+
+	p.dialTimeout = defaultPeerPolicyDialTimeout
+	if p.DialTimeout != "" {
+		p.dialTimeout, err = time.ParseDuration(p.DialTimeout)
+		if err != nil {
+			return fmt.Errorf("invalid dial timeout: %s", p.DialTimeout)
+		}
+	}
+
+	p.peerTTL = defaultPeerPolicyPeerTTL
+	if p.PeerTTL != "" {
+		p.peerTTL, err = time.ParseDuration(p.PeerTTL)
+		if err != nil {
+			return fmt.Errorf("invalid peer ttl: %s", p.PeerTTL)
+		}
+	}
+
+	if p.MaxPeersPerIP < 0 {
+		return fmt.Errorf("invalid max peers per ip: %d", p.MaxPeersPerIP)
+	}
+
+	return nil
+}
+
+// reload the policy file if it has been modified since it was last loaded
+func (e *peerPolicyEngine) reload() error {
+	if e.path == "" {
+		return nil
+	}
+
+	info, err := os.Stat(e.path)
+	if err != nil {
+		return fmt.Errorf("failed to stat peer policy %s; %s", e.path, err.Error())
+	}
+
+	if !info.ModTime().After(e.modTime) {
+		return nil
+	}
+
+	raw, err := os.ReadFile(e.path)
+	if err != nil {
+		return fmt.Errorf("failed to read peer policy %s; %s", e.path, err.Error())
+	}
+
+	policy := defaultPeerPolicy()
+	err = json.Unmarshal(raw, &policy)
+	if err != nil {
+		return fmt.Errorf("failed to parse peer policy %s; %s", e.path, err.Error())
+	}
+
+	err = policy.compile()
+	if err != nil {
+		return fmt.Errorf("invalid peer policy %s; %s", e.path, err.Error())
+	}
+
+	e.policy = policy
+	e.modTime = info.ModTime()
+	common.Log.Debugf("loaded peer policy: %s", e.path)
+
+	return nil
+}
+
+// currentPolicy returns the latest valid policy
+func (e *peerPolicyEngine) currentPolicy() *PeerPolicy {
+	err := e.reload()
+	if err != nil {
+		common.Log.Warningf("retaining previous peer policy; %s", err.Error())
+	}
+
+	return e.policy
+}
+
+// admitAddress returns nil if the peer at the given address is admitted; the
+// engine is locked only to read the policy and to record the admission, so a
+// slow dial never blocks other queries
+func (e *peerPolicyEngine) admitAddress(addr string) error {
+	e.mutex.Lock()
+	policy := e.currentPolicy()
+	e.mutex.Unlock()
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid peer address: %s", addr)
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("invalid peer ip: %s", host)
+	}
+
+	for _, ipNet := range policy.denyNets {
+		if ipNet.Contains(ip) {
+			return fmt.Errorf("peer ip %s denied by %s", ip, ipNet)
+		}
+	}
+
+	if len(policy.allowNets) > 0 {
+		allowed := false
+		for _, ipNet := range policy.allowNets {
+			if ipNet.Contains(ip) {
+				allowed = true
+				break
+			}
+		}
+
+		if !allowed {
+			return fmt.Errorf("peer ip %s not in allowed networks", ip)
+		}
+	}
+
+	// an address over the limit is not dialed; the limit is checked again
+	// when the admission is recorded
+	err = e.checkPeersPerIP(policy, ip, addr)
+	if err != nil {
+		return err
+	}
+
+	if policy.RequireReachable {
+		conn, err := net.DialTimeout("tcp", addr, policy.dialTimeout)
+		if err != nil {
+			return fmt.Errorf("%w: %s", errPeerUnreachable, addr)
+		}
+		conn.Close()
+	}
+
+	return e.recordAdmission(policy, ip, addr)
+}
+
+// checkPeersPerIP returns an error if admitting the given address would
+// exceed the limit of peers admitted from its ip
+func (e *peerPolicyEngine) checkPeersPerIP(policy *PeerPolicy, ip net.IP, addr string) error {
+	if policy.MaxPeersPerIP <= 0 {
+		return nil
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return e.peersPerIPExceeded(policy, ip, addr)
+}
+
+// recordAdmission records the admission of the given address, unless peers
+// admitted from its ip in the meantime leave no room for it
+func (e *peerPolicyEngine) recordAdmission(policy *PeerPolicy, ip net.IP, addr string) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	err := e.peersPerIPExceeded(policy, ip, addr)
+	if err != nil {
+		return err
+	}
+
+	if e.admitted[ip.String()] == nil {
+		e.admitted[ip.String()] = map[string]time.Time{}
+	}
+	e.admitted[ip.String()][addr] = time.Now()
+
+	return nil
+}
+
+// peersPerIPExceeded returns an error if the given address is not admitted
+// from its ip and the ip has reached its limit; the engine must be locked
+func (e *peerPolicyEngine) peersPerIPExceeded(policy *PeerPolicy, ip net.IP, addr string) error {
+	if policy.MaxPeersPerIP <= 0 {
+		return nil
+	}
+
+	admitted := e.admittedFromIP(ip.String(), policy.peerTTL)
+	if _, ok := admitted[addr]; !ok && len(admitted) >= policy.MaxPeersPerIP {
+		return fmt.Errorf("peer ip %s exceeds limit of %d peers", ip, policy.MaxPeersPerIP)
+	}
+
+	return nil
+}
+
+// admitID returns nil if the peer with the given node ID is admitted
+func (e *peerPolicyEngine) admitID(state *State, id string) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	policy := e.currentPolicy()
+
+	for _, denied := range policy.DenyIDs {
+		if strings.EqualFold(denied, id) {
+			return fmt.Errorf("peer id %s denied", id)
+		}
+	}
+
+	if len(policy.AllowIDs) > 0 {
+		allowed := false
+		for _, allowedID := range policy.AllowIDs {
+			if strings.EqualFold(allowedID, id) {
+				allowed = true
+				break
+			}
+		}
+
+		if !allowed {
+			return fmt.Errorf("peer id %s not allowed", id)
+		}
+	}
+
+	if policy.ValidatorsOnly {
+		validator := state.validatorByNodeID(id)
+		if validator == nil || validator.VotingPower() <= 0 {
+			return fmt.Errorf("peer id %s is not a staked validator", id)
+		}
+	}
+
+	return nil
+}
+
+// admittedFromIP returns the unexpired addresses admitted from the given ip
+func (e *peerPolicyEngine) admittedFromIP(ip string, ttl time.Duration) map[string]time.Time {
+	admitted := e.admitted[ip]
+	for addr, at := range admitted {
+		if time.Since(at) > ttl {
+			delete(admitted, addr)
+		}
+	}
+
+	return admitted
+}
+
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0)
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, fmt.Errorf("invalid cidr: %s", cidr)
+		}
+		nets = append(nets, ipNet)
+	}
+
+	return nets, nil
+}
@@ -0,0 +1,241 @@
+package protocol
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const peerRegistryActionAdd = "add"
+const peerRegistryActionRemove = "remove"
+
+const stateKeyPrefixPeerRegistry = "peer_registry/"
+const stateKeyPrefixPeerRegistryNodes = "peer_registry/nodes/"
+const stateKeyPrefixPeerRegistryPending = "peer_registry/pending/"
+
+const stateParamsPeerRegistry = "peer_registry"
+
+// PeerRegistryParams configures the permissioned peer registry at genesis;
+// when enabled, only registered node IDs are admitted as peers
+type PeerRegistryParams struct {
+	Enabled bool     `json:"enabled"`
+	NodeIDs []string `json:"node_ids,omitempty"`
+}
+
+// PeerRegistryChange is a proposed addition or removal of a node ID, applied
+// once validators holding more than 2/3 of the voting power have approved it
+type PeerRegistryChange struct {
+	Action string `json:"action"`
+	NodeID string `json:"node_id"`
+}
+
+// PendingPeerRegistryChange is a peer registry change awaiting approval; it
+// expires once the governance peer registry change window has passed since
+// the height at which it was submitted
+type PendingPeerRegistryChange struct {
+	*PeerRegistryChange
+	Height    int64    `json:"height"`
+	Approvals []string `json:"approvals"`
+}
+
+// PeerRegistry is the set of node IDs permitted to join the network
+type PeerRegistry struct {
+	Enabled bool                                  `json:"enabled"`
+	Nodes   map[string]int64                      `json:"nodes"` // node id -> height registered
+	Pending map[string]*PendingPeerRegistryChange `json:"pending"`
+}
+
+func peerRegistryFactory(params *PeerRegistryParams) (*PeerRegistry, error) {
+	registry := &PeerRegistry{
+		Nodes:   map[string]int64{},
+		Pending: map[string]*PendingPeerRegistryChange{},
+	}
+
+	if params == nil {
+		return registry, nil
+	}
+
+	registry.Enabled = params.Enabled
+	for _, nodeID := range params.NodeIDs {
+		id, err := normalizeNodeID(nodeID)
+		if err != nil {
+			return nil, err
+		}
+		registry.Nodes[id] = 0
+	}
+
+	return registry, nil
+}
+
+func peerRegistryNodeStateKey(nodeID string) string {
+	return fmt.Sprintf("%s%s", stateKeyPrefixPeerRegistryNodes, nodeID)
+}
+
+func peerRegistryPendingStateKey(key string) string {
+	return fmt.Sprintf("%s%s", stateKeyPrefixPeerRegistryPending, key)
+}
+
+// normalizeNodeID returns the lowercase form of the given node ID, which must
+// be the hex-encoded 20-byte address of the node key
+func normalizeNodeID(nodeID string) (string, error) {
+	id := strings.ToLower(strings.TrimSpace(nodeID))
+	raw, err := hex.DecodeString(id)
+	if err != nil || len(raw) != 20 {
+		return "", fmt.Errorf("invalid node id: %s", nodeID)
+	}
+
+	return id, nil
+}
+
+func (c *PeerRegistryChange) key() string {
+	return fmt.Sprintf("%s/%s", c.Action, c.NodeID)
+}
+
+func (c *PeerRegistryChange) validate() error {
+	if c.Action != peerRegistryActionAdd && c.Action != peerRegistryActionRemove {
+		return fmt.Errorf("invalid peer registry action: %s", c.Action)
+	}
+
+	id, err := normalizeNodeID(c.NodeID)
+	if err != nil {
+		return err
+	}
+	c.NodeID = id
+
+	return nil
+}
+
+// Contains returns true if the given node ID is registered
+func (r *PeerRegistry) Contains(nodeID string) bool {
+	_, ok := r.Nodes[strings.ToLower(nodeID)]
+	return ok
+}
+
+// admit returns nil if the given node ID is permitted by the registry
+func (r *PeerRegistry) admit(nodeID string) error {
+	if r == nil || !r.Enabled {
+		return nil
+	}
+
+	if !r.Contains(nodeID) {
+		return fmt.Errorf("peer id %s is not registered", nodeID)
+	}
+
+	return nil
+}
+
+// approve records the approval of the given change by the validator with the
+// given address, applying the change if it has received sufficient approval;
+// returns true if the change was applied
+func (r *PeerRegistry) approve(state *State, change *PeerRegistryChange, address string, height int64) (bool, error) {
+	registered := r.Contains(change.NodeID)
+	if change.Action == peerRegistryActionAdd && registered {
+		return false, fmt.Errorf("node id %s is already registered", change.NodeID)
+	} else if change.Action == peerRegistryActionRemove && !registered {
+		return false, fmt.Errorf("node id %s is not registered", change.NodeID)
+	}
+
+	if r.Nodes == nil {
+		r.Nodes = map[string]int64{}
+	}
+
+	if r.Pending == nil {
+		r.Pending = map[string]*PendingPeerRegistryChange{}
+	}
+
+	pending := r.Pending[change.key()]
+	if pending == nil {
+		pending = &PendingPeerRegistryChange{
+			PeerRegistryChange: change,
+			Height:             height,
+			Approvals:          make([]string, 0),
+		}
+		r.Pending[change.key()] = pending
+	}
+
+	for _, approval := range pending.Approvals {
+		if approval == address {
+			return false, errors.New("peer registry change already approved by validator")
+		}
+	}
+	pending.Approvals = append(pending.Approvals, address)
+
+	if !pending.approved(state) {
+		return false, nil
+	}
+
+	r.apply(pending, height)
+	return true, nil
+}
+
+// approved returns true if the validators which approved the change hold more
+// than 2/3 of the total voting power of the given state
+func (c *PendingPeerRegistryChange) approved(state *State) bool {
+	power := int64(0)
+	for _, approval := range c.Approvals {
+		validator := state.GetValidator([]byte(approval))
+		if validator != nil {
+			power += validator.VotingPower()
+		}
+	}
+
+	return power*3 > state.TotalVotingPower()*2
+}
+
+// apply the given approved change at the given height
+func (r *PeerRegistry) apply(pending *PendingPeerRegistryChange, height int64) {
+	switch pending.Action {
+	case peerRegistryActionAdd:
+		r.Nodes[pending.NodeID] = height
+	case peerRegistryActionRemove:
+		delete(r.Nodes, pending.NodeID)
+	}
+	delete(r.Pending, pending.key())
+}
+
+// resolvePeerRegistryChanges recounts the approvals of each pending peer
+// registry change by the current voting power at the end of the given
+// height, applying each change which is now approved, and drops each change
+// whose approval window has passed; returns the keys of the applied changes
+func (s *State) resolvePeerRegistryChanges(height int64) []string {
+	applied := make([]string, 0)
+	if s.PeerRegistry == nil || len(s.PeerRegistry.Pending) == 0 {
+		return applied
+	}
+
+	keys := make([]string, 0, len(s.PeerRegistry.Pending))
+	for key := range s.PeerRegistry.Pending {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	window := s.GovernanceParams.peerRegistryChangeWindow()
+	for _, key := range keys {
+		pending := s.PeerRegistry.Pending[key]
+		if pending == nil {
+			continue
+		}
+
+		// the change may no longer apply, e.g. if its node id was added or
+		// removed by another change
+		registered := s.PeerRegistry.Contains(pending.NodeID)
+		if (pending.Action == peerRegistryActionAdd) == registered {
+			delete(s.PeerRegistry.Pending, key)
+			continue
+		}
+
+		if pending.approved(s) {
+			s.PeerRegistry.apply(pending, height)
+			applied = append(applied, key)
+			continue
+		}
+
+		if height >= pending.Height+window {
+			delete(s.PeerRegistry.Pending, key)
+		}
+	}
+
+	return applied
+}
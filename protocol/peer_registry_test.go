@@ -0,0 +1,102 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/providenetwork/tendermint/crypto/ed25519"
+)
+
+func TestResolvePeerRegistryChanges(t *testing.T) {
+	nodeID := "47c2a081f44770ef1a11f46eb4b44bf1a727fdcb"
+
+	tests := []struct {
+		name       string
+		height     int64
+		stake      [3]int64 // stake of each validator once the change is submitted
+		registered bool
+		pending    bool
+	}{
+		{name: "short of 2/3", height: 50, stake: [3]int64{10, 10, 10}, pending: true},
+		{name: "stake moved to the approvers", height: 50, stake: [3]int64{35, 10, 5}, registered: true},
+		{name: "approver withdrew", height: 50, stake: [3]int64{0, 10, 10}, pending: true},
+		{name: "last block of the window", height: 109, stake: [3]int64{10, 10, 10}, pending: true},
+		{name: "window passed", height: 110, stake: [3]int64{10, 10, 10}},
+		{name: "approved as the window passes", height: 110, stake: [3]int64{30, 10, 0}, registered: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			validators := []*Validator{
+				testValidator(ed25519.GenPrivKey(), 10),
+				testValidator(ed25519.GenPrivKey(), 10),
+				testValidator(ed25519.GenPrivKey(), 10),
+			}
+
+			registry, _ := peerRegistryFactory(&PeerRegistryParams{Enabled: true})
+			state := &State{
+				Validators:       validators,
+				PeerRegistry:     registry,
+				GovernanceParams: &GovernanceParams{PeerRegistryChangeWindow: 100},
+			}
+
+			change := &PeerRegistryChange{Action: peerRegistryActionAdd, NodeID: nodeID}
+			applied, err := registry.approve(state, change, *validators[0].Address, 10)
+			if err != nil || applied {
+				t.Fatalf("expected change to await approval; %v", err)
+			}
+
+			for i, stake := range test.stake {
+				stake := stake
+				validators[i].Stake = &stake
+			}
+
+			state.resolvePeerRegistryChanges(test.height)
+
+			if registry.Contains(nodeID) != test.registered {
+				t.Fatalf("expected node id registered: %v", test.registered)
+			}
+
+			if _, ok := registry.Pending[change.key()]; ok != test.pending {
+				t.Fatalf("expected change pending: %v", test.pending)
+			}
+		})
+	}
+}
+
+func TestApprovePeerRegistryChange(t *testing.T) {
+	validators := []*Validator{
+		testValidator(ed25519.GenPrivKey(), 10),
+		testValidator(ed25519.GenPrivKey(), 10),
+		testValidator(ed25519.GenPrivKey(), 10),
+	}
+
+	registry, _ := peerRegistryFactory(&PeerRegistryParams{Enabled: true})
+	state := &State{Validators: validators, PeerRegistry: registry}
+	change := &PeerRegistryChange{Action: peerRegistryActionAdd, NodeID: "47c2a081f44770ef1a11f46eb4b44bf1a727fdcb"}
+
+	tests := []struct {
+		name    string
+		voter   *Validator
+		applied bool
+		err     bool
+	}{
+		{name: "first approval", voter: validators[0]},
+		{name: "repeated approval", voter: validators[0], err: true},
+		{name: "second approval is 2/3", voter: validators[1]},
+		{name: "third approval exceeds 2/3", voter: validators[2], applied: true},
+		{name: "node id registered", voter: validators[0], err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			applied, err := registry.approve(state, change, *test.voter.Address, 10)
+			if (err != nil) != test.err {
+				t.Fatalf("expected error: %v; got %v", test.err, err)
+			}
+
+			if applied != test.applied {
+				t.Fatalf("expected applied: %v", test.applied)
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/providenetwork/baseledger/common"
+)
+
+const peerReputationFilePath = "peer-reputation.json"
+
+const peerEventDialFailure = "dial failure"
+const peerEventMisbehavior = "misbehavior"
+const peerEventRejection = "rejection"
+
+// errPeerUnreachable is returned by the peer policy when a peer address does
+// not accept a connection, and is recorded as a dial failure
+var errPeerUnreachable = errors.New("peer unreachable")
+
+// PeerReputation is the reputation of a single peer, keyed by node ID or IP
+type PeerReputation struct {
+	Key          string `json:"key"`
+	DialFailures int    `json:"dial_failures"`
+	Rejections   int    `json:"rejections"`
+	Misbehavior  int    `json:"misbehavior"`
+
+	LastEvent   string     `json:"last_event,omitempty"`
+	LastEventAt *time.Time `json:"last_event_at,omitempty"`
+
+	Bans        int        `json:"bans"`
+	BanReason   string     `json:"ban_reason,omitempty"`
+	BannedUntil *time.Time `json:"banned_until,omitempty"`
+}
+
+// peerReputationStore records failed dials, filter rejections and evidence of
+// misbehavior per peer, banning peers which exceed the configured thresholds;
+// the store is local to the node and persisted in the root directory
+type peerReputationStore struct {
+	mutex *sync.Mutex
+	path  string
+	peers map[string]*PeerReputation
+
+	dialFailureThreshold int
+	rejectionThreshold   int
+	misbehaviorThreshold int
+	banDuration          time.Duration
+	misbehaviorBan       time.Duration
+}
+
+func peerReputationStoreFactory(cfg *common.Config) (*peerReputationStore, error) {
+	store := &peerReputationStore{
+		mutex: &sync.Mutex{},
+		path:  filepath.Join(cfg.RootDir, peerReputationFilePath),
+		peers: map[string]*PeerReputation{},
+
+		dialFailureThreshold: cfg.PeerBanDialFailures,
+		rejectionThreshold:   cfg.PeerBanRejections,
+		misbehaviorThreshold: cfg.PeerBanMisbehavior,
+		banDuration:          cfg.PeerBanDuration,
+		misbehaviorBan:       cfg.PeerMisbehaviorBanDuration,
+	}
+
+	raw, err := os.ReadFile(store.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return store, nil
+		}
+		return nil, err
+	}
+
+	err = json.Unmarshal(raw, &store.peers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse peer reputation %s; %s", store.path, err.Error())
+	}
+
+	return store, nil
+}
+
+// peerReputationAddressKey returns the reputation key for the given peer
+// address; peers dialed by address are tracked by IP
+func peerReputationAddressKey(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+
+	return host
+}
+
+// peerReputationIDKey returns the reputation key for the given node ID
+func peerReputationIDKey(id string) string {
+	return strings.ToLower(id)
+}
+
+// banned returns an error describing the ban if the peer with the given key
+// is currently banned
+func (s *peerReputationStore) banned(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	peer := s.peers[key]
+	if peer == nil || peer.BannedUntil == nil {
+		return nil
+	}
+
+	if time.Now().After(*peer.BannedUntil) {
+		return nil
+	}
+
+	return fmt.Errorf("peer %s banned until %s; %s", key, peer.BannedUntil.Format(time.RFC3339), peer.BanReason)
+}
+
+// recordAdmitted clears the consecutive dial failures of the given peer
+func (s *peerReputationStore) recordAdmitted(key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	peer := s.peers[key]
+	if peer == nil || peer.DialFailures == 0 {
+		return
+	}
+
+	peer.DialFailures = 0
+	s.save()
+}
+
+// recordFilterResult records the outcome of a peer filter query
+func (s *peerReputationStore) recordFilterResult(key string, err error) {
+	if err == nil {
+		s.recordAdmitted(key)
+	} else if errors.Is(err, errPeerUnreachable) {
+		s.record(key, peerEventDialFailure, err.Error(), time.Now())
+	} else {
+		s.record(key, peerEventRejection, err.Error(), time.Now())
+	}
+}
+
+// recordMisbehavior records evidence of misbehavior committed at the given time
+func (s *peerReputationStore) recordMisbehavior(key, reason string, at time.Time) {
+	s.record(key, peerEventMisbehavior, reason, at)
+}
+
+// record the given event for the peer with the given key, banning the peer if
+// the corresponding threshold has been reached
+func (s *peerReputationStore) record(key, event, reason string, at time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	peer := s.peers[key]
+	if peer == nil {
+		peer = &PeerReputation{Key: key}
+		s.peers[key] = peer
+	}
+
+	// counts restart once a ban has lapsed
+	if peer.BannedUntil != nil && time.Now().After(*peer.BannedUntil) {
+		peer.DialFailures = 0
+		peer.Rejections = 0
+		peer.Misbehavior = 0
+		peer.BannedUntil = nil
+	}
+
+	var count, threshold int
+	duration := s.banDuration
+	switch event {
+	case peerEventDialFailure:
+		peer.DialFailures++
+		count, threshold = peer.DialFailures, s.dialFailureThreshold
+	case peerEventRejection:
+		peer.Rejections++
+		count, threshold = peer.Rejections, s.rejectionThreshold
+	case peerEventMisbehavior:
+		peer.Misbehavior++
+		count, threshold = peer.Misbehavior, s.misbehaviorThreshold
+		duration = s.misbehaviorBan
+	}
+
+	peer.LastEvent = fmt.Sprintf("%s: %s", event, reason)
+	peer.LastEventAt = &at
+
+	if threshold > 0 && count >= threshold {
+		until := at.Add(duration)
+		if peer.BannedUntil == nil || until.After(*peer.BannedUntil) {
+			peer.Bans++
+			peer.BanReason = fmt.Sprintf("%d %s events; last %s", count, event, reason)
+			peer.BannedUntil = &until
+			common.Log.Debugf("banned peer %s until %s; %s", key, until.Format(time.RFC3339), peer.BanReason)
+		}
+	}
+
+	s.save()
+}
+
+// get returns a copy of the reputation of the peer with the given key, or nil
+func (s *peerReputationStore) get(key string) *PeerReputation {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	peer := s.peers[key]
+	if peer == nil {
+		return nil
+	}
+
+	reputation := *peer
+	return &reputation
+}
+
+// list returns copies of all peer reputations, ordered by key
+func (s *peerReputationStore) list() []*PeerReputation {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	peers := make([]*PeerReputation, 0, len(s.peers))
+	for _, peer := range s.peers {
+		reputation := *peer
+		peers = append(peers, &reputation)
+	}
+
+	sort.Slice(peers, func(i, j int) bool {
+		return peers[i].Key < peers[j].Key
+	})
+
+	return peers
+}
+
+// save writes the store to disk; the caller must hold the mutex
+func (s *peerReputationStore) save() {
+	raw, err := json.MarshalIndent(s.peers, "", "    ")
+	if err != nil {
+		common.Log.Warningf("failed to marshal peer reputation; %s", err.Error())
+		return
+	}
+
+	err = os.WriteFile(s.path, raw, 0644)
+	if err != nil {
+		common.Log.Warningf("failed to write peer reputation %s; %s", s.path, err.Error())
+	}
+}
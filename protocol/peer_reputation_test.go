@@ -0,0 +1,111 @@
+package protocol
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/providenetwork/baseledger/common"
+)
+
+func testPeerReputationStore(t *testing.T, root string) *peerReputationStore {
+	cfg := &common.Config{
+		PeerBanDialFailures:        3,
+		PeerBanRejections:          2,
+		PeerBanMisbehavior:         1,
+		PeerBanDuration:            time.Hour,
+		PeerMisbehaviorBanDuration: 24 * time.Hour,
+	}
+	cfg.RootDir = root
+
+	store, err := peerReputationStoreFactory(cfg)
+	if err != nil {
+		t.Fatalf("failed to initialize peer reputation; %s", err.Error())
+	}
+
+	return store
+}
+
+func TestPeerReputationBans(t *testing.T) {
+	rejected := errors.New("peer not registered")
+	unreachable := errPeerUnreachable
+
+	tests := []struct {
+		name    string
+		results []error // filter results recorded in order
+		banned  bool
+	}{
+		{name: "dial failures below the threshold", results: []error{unreachable, unreachable}},
+		{name: "dial failures at the threshold", results: []error{unreachable, unreachable, unreachable}, banned: true},
+		{name: "admission clears dial failures", results: []error{unreachable, unreachable, nil, unreachable}},
+		{name: "rejections at the threshold", results: []error{rejected, rejected}, banned: true},
+		{name: "admission keeps rejections", results: []error{rejected, nil, rejected}, banned: true},
+		{name: "mixed events below each threshold", results: []error{unreachable, rejected, unreachable}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := testPeerReputationStore(t, t.TempDir())
+			for _, result := range test.results {
+				store.recordFilterResult("10.0.0.1", result)
+			}
+
+			if banned := store.banned("10.0.0.1") != nil; banned != test.banned {
+				t.Fatalf("expected banned: %v", test.banned)
+			}
+
+			if store.banned("10.0.0.2") != nil {
+				t.Fatal("expected other peers not to be banned")
+			}
+		})
+	}
+}
+
+func TestPeerReputationMisbehavior(t *testing.T) {
+	root := t.TempDir()
+	store := testPeerReputationStore(t, root)
+
+	tests := []struct {
+		name   string
+		at     time.Time
+		banned bool
+	}{
+		{name: "lapsed ban", at: time.Now().Add(-48 * time.Hour)},
+		{name: "current ban", at: time.Now(), banned: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			key := peerReputationIDKey("47C2A081F44770EF1A11F46EB4B44BF1A727FDCB")
+			store.recordMisbehavior(key, test.name, test.at)
+
+			if banned := store.banned(key) != nil; banned != test.banned {
+				t.Fatalf("expected banned: %v", test.banned)
+			}
+		})
+	}
+
+	// the reputation is persisted and the ban survives a restart
+	restored := testPeerReputationStore(t, root)
+	peer := restored.get(peerReputationIDKey("47c2a081f44770ef1a11f46eb4b44bf1a727fdcb"))
+	if peer == nil || peer.Bans != 2 || restored.banned(peer.Key) == nil {
+		t.Fatalf("expected the persisted peer reputation to carry both bans; got %+v", peer)
+	}
+}
+
+func TestPeerReputationAddressKey(t *testing.T) {
+	tests := []struct {
+		addr string
+		key  string
+	}{
+		{addr: "10.0.0.1:26656", key: "10.0.0.1"},
+		{addr: "[::1]:26656", key: "::1"},
+		{addr: "10.0.0.1", key: "10.0.0.1"},
+	}
+
+	for _, test := range tests {
+		if key := peerReputationAddressKey(test.addr); key != test.key {
+			t.Fatalf("expected key %s for address %s; got %s", test.key, test.addr, key)
+		}
+	}
+}
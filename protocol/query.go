@@ -1,11 +1,11 @@
 package protocol
 
 import (
+	"encoding/json"
 	"fmt"
-	"net"
 	"regexp"
+	"strconv"
 	"strings"
-	"time"
 
 	"github.com/providenetwork/baseledger/common"
 	abcitypes "github.com/providenetwork/tendermint/abci/types"
@@ -14,62 +14,424 @@ import (
 const queryBlockLatest = "latest"
 const queryRegexEntropyFetch = `^\/baseline\/entropy\/fetch\/(.*)$`
 
+const queryRegexGovernanceParams = `^\/governance\/params$`
+const queryRegexKeyRotations = `^\/key_rotations$`
+const queryRegexRotatedKeys = `^\/key_rotations\/rotated$`
+const queryRegexProposal = `^\/governance\/proposals\/(\d+)$`
+const queryRegexProposalTally = `^\/governance\/proposals\/(\d+)\/tally$`
+const queryRegexProposals = `^\/governance\/proposals$`
+const queryRegexStakingParams = `^\/staking\/params$`
+const queryRegexStateHeight = `^\/state\/height$`
+const queryRegexStateRoot = `^\/state\/root$`
+const queryRegexStore = `^\/store\/(.*)$`
+const queryRegexUpgradePlan = `^\/upgrade\/plan$`
+const queryRegexValidator = `^\/validators\/(.+)$`
+const queryRegexValidators = `^\/validators$`
+
 const queryRegexPeerAddressFilter = `^\/p2p\/filter\/addr\/(.*)$`
+const queryRegexPeerIDFilter = `^\/p2p\/filter\/id\/(.*)$`
+const queryRegexPeerReputation = `^\/p2p\/reputation\/(.+)$`
+const queryRegexPeerReputations = `^\/p2p\/reputation$`
+const queryRegexPeerRegistry = `^\/p2p\/registry$`
+const queryRegexPeerRegistryPending = `^\/p2p\/registry\/pending$`
 const peerAddressFilterResponseCode = 1
-const peerAddressFilterResponseTimeout = time.Millisecond * 100
+const peerIDFilterResponseCode = 1
+
+const queryResponseCodeBadRequest = uint32(2)
+const queryResponseCodeNotFound = uint32(3)
+const queryResponseCodeInternalError = uint32(4)
+const queryResponseCodeUnknownPath = uint32(5)
 
 type QueryHandlers struct {
 	expressions map[string]*regexp.Regexp
-	handlers    map[string]func(abcitypes.RequestQuery) abcitypes.ResponseQuery
+	handlers    map[string]func(*State, abcitypes.RequestQuery) abcitypes.ResponseQuery
 }
 
-func queryHandlersFactory() *QueryHandlers {
+func queryHandlersFactory(peers *peerPolicyEngine) *QueryHandlers {
 	return &QueryHandlers{
 		expressions: map[string]*regexp.Regexp{
-			queryRegexEntropyFetch:      regexp.MustCompile(queryRegexEntropyFetch),
-			queryRegexPeerAddressFilter: regexp.MustCompile(queryRegexPeerAddressFilter),
+			queryRegexEntropyFetch:        regexp.MustCompile(queryRegexEntropyFetch),
+			queryRegexGovernanceParams:    regexp.MustCompile(queryRegexGovernanceParams),
+			queryRegexKeyRotations:        regexp.MustCompile(queryRegexKeyRotations),
+			queryRegexRotatedKeys:         regexp.MustCompile(queryRegexRotatedKeys),
+			queryRegexProposal:            regexp.MustCompile(queryRegexProposal),
+			queryRegexProposalTally:       regexp.MustCompile(queryRegexProposalTally),
+			queryRegexProposals:           regexp.MustCompile(queryRegexProposals),
+			queryRegexPeerAddressFilter:   regexp.MustCompile(queryRegexPeerAddressFilter),
+			queryRegexPeerIDFilter:        regexp.MustCompile(queryRegexPeerIDFilter),
+			queryRegexPeerRegistry:        regexp.MustCompile(queryRegexPeerRegistry),
+			queryRegexPeerReputation:      regexp.MustCompile(queryRegexPeerReputation),
+			queryRegexPeerReputations:     regexp.MustCompile(queryRegexPeerReputations),
+			queryRegexPeerRegistryPending: regexp.MustCompile(queryRegexPeerRegistryPending),
+			queryRegexStakingParams:       regexp.MustCompile(queryRegexStakingParams),
+			queryRegexStateHeight:         regexp.MustCompile(queryRegexStateHeight),
+			queryRegexStateRoot:           regexp.MustCompile(queryRegexStateRoot),
+			queryRegexStore:               regexp.MustCompile(queryRegexStore),
+			queryRegexUpgradePlan:         regexp.MustCompile(queryRegexUpgradePlan),
+			queryRegexValidator:           regexp.MustCompile(queryRegexValidator),
+			queryRegexValidators:          regexp.MustCompile(queryRegexValidators),
 		},
-		handlers: map[string]func(abcitypes.RequestQuery) abcitypes.ResponseQuery{
-			queryRegexEntropyFetch:      fetchEntropy,
-			queryRegexPeerAddressFilter: filterPeerQuery,
+		handlers: map[string]func(*State, abcitypes.RequestQuery) abcitypes.ResponseQuery{
+			queryRegexEntropyFetch:        fetchEntropy,
+			queryRegexGovernanceParams:    fetchGovernanceParams,
+			queryRegexKeyRotations:        fetchKeyRotations,
+			queryRegexRotatedKeys:         fetchRotatedKeys,
+			queryRegexProposal:            fetchProposal,
+			queryRegexProposalTally:       fetchProposalTally,
+			queryRegexProposals:           fetchProposals,
+			queryRegexPeerAddressFilter:   peers.filterPeerQuery,
+			queryRegexPeerIDFilter:        peers.filterPeerIDQuery,
+			queryRegexPeerRegistry:        fetchPeerRegistry,
+			queryRegexPeerReputation:      peers.reputation.fetchPeerReputation,
+			queryRegexPeerReputations:     peers.reputation.fetchPeerReputations,
+			queryRegexPeerRegistryPending: fetchPeerRegistryPending,
+			queryRegexStakingParams:       fetchStakingParams,
+			queryRegexStateHeight:         fetchStateHeight,
+			queryRegexStateRoot:           fetchStateRoot,
+			queryRegexStore:               scanStore,
+			queryRegexUpgradePlan:         fetchUpgradePlan,
+			queryRegexValidator:           fetchValidator,
+			queryRegexValidators:          fetchValidators,
 		},
 	}
 }
 
-func (q *QueryHandlers) handle(query abcitypes.RequestQuery) (*abcitypes.ResponseQuery, error) {
+func (q *QueryHandlers) handle(state *State, query abcitypes.RequestQuery) (*abcitypes.ResponseQuery, error) {
 	for exp, regexp := range q.expressions {
 		if regexp.Match([]byte(query.Path)) {
-			resp := q.handlers[exp](query)
+			resp := q.handlers[exp](state, query)
 			return &resp, nil
 		}
 	}
 
-	return nil, fmt.Errorf("%d-byte query did not match a registered handler", len(query.Data))
+	return nil, fmt.Errorf("%d-byte query for path %s did not match a registered handler", len(query.Data), query.Path)
 }
 
 // handler implementations
 
-func filterPeerQuery(req abcitypes.RequestQuery) abcitypes.ResponseQuery {
+func (e *peerPolicyEngine) filterPeerQuery(state *State, req abcitypes.RequestQuery) abcitypes.ResponseQuery {
 	path := strings.Split(string(req.Path), "/")
 	addr := path[len(path)-1]
-	conn, err := net.DialTimeout("tcp", addr, peerAddressFilterResponseTimeout)
+
+	key := peerReputationAddressKey(addr)
+	err := e.reputation.banned(key)
+	if err == nil {
+		err = e.admitAddress(addr)
+		e.reputation.recordFilterResult(key, err)
+	}
+
 	if err != nil {
-		common.Log.Tracef("filtering unreachable peer: %s", addr)
+		common.Log.Tracef("filtering peer: %s; %s", addr, err.Error())
 		return abcitypes.ResponseQuery{
 			Code: peerAddressFilterResponseCode,
+			Log:  err.Error(),
 		}
 	}
-	conn.Close()
 
-	common.Log.Tracef("peer reachable: %s", addr)
+	common.Log.Tracef("peer admitted: %s", addr)
 	return abcitypes.ResponseQuery{
 		Code: 0,
 	}
 }
 
-func fetchEntropy(req abcitypes.RequestQuery) abcitypes.ResponseQuery {
-	// TODO: the work... query ethereum, chainlink network, etc....
+func (e *peerPolicyEngine) filterPeerIDQuery(state *State, req abcitypes.RequestQuery) abcitypes.ResponseQuery {
+	path := strings.Split(string(req.Path), "/")
+	id := path[len(path)-1]
+
+	key := peerReputationIDKey(id)
+	err := e.reputation.banned(key)
+	if err == nil {
+		err = e.admitID(state, id)
+		if err == nil {
+			err = state.PeerRegistry.admit(id)
+		}
+		e.reputation.recordFilterResult(key, err)
+	}
+
+	if err != nil {
+		common.Log.Tracef("filtering peer id: %s; %s", id, err.Error())
+		return abcitypes.ResponseQuery{
+			Code: peerIDFilterResponseCode,
+			Log:  err.Error(),
+		}
+	}
+
+	common.Log.Tracef("peer id admitted: %s", id)
 	return abcitypes.ResponseQuery{
 		Code: 0,
 	}
 }
+
+func fetchEntropy(state *State, req abcitypes.RequestQuery) abcitypes.ResponseQuery {
+	path := strings.Split(string(req.Path), "/")
+	param := path[len(path)-1]
+
+	var entropy *Entropy
+	if param == queryBlockLatest {
+		entropy = state.LatestEntropy()
+	} else {
+		height, err := strconv.ParseInt(param, 10, 64)
+		if err != nil {
+			return abcitypes.ResponseQuery{
+				Code: queryResponseCodeBadRequest,
+				Log:  fmt.Sprintf("invalid entropy height: %s", param),
+			}
+		}
+		entropy = state.GetEntropy(height)
+	}
+
+	if entropy == nil {
+		return abcitypes.ResponseQuery{
+			Code:   queryResponseCodeNotFound,
+			Log:    fmt.Sprintf("no entropy stored for height: %s", param),
+			Height: state.Height,
+		}
+	}
+
+	return stateRecordResponse(state, req, entropyStateKey(entropy.Height))
+}
+
+func fetchGovernanceParams(state *State, req abcitypes.RequestQuery) abcitypes.ResponseQuery {
+	if state.GovernanceParams == nil {
+		return abcitypes.ResponseQuery{
+			Code:   queryResponseCodeNotFound,
+			Log:    "no governance params configured",
+			Height: state.Height,
+		}
+	}
+
+	return stateRecordResponse(state, req, paramsStateKey(stateParamsGovernance))
+}
+
+func fetchKeyRotations(state *State, req abcitypes.RequestQuery) abcitypes.ResponseQuery {
+	return pagedResponse(state, req, stateKeyPrefixKeyRotations, false)
+}
+
+// fetchRotatedKeys returns the next address of each rotated validator key,
+// keyed by the rotated address
+func fetchRotatedKeys(state *State, req abcitypes.RequestQuery) abcitypes.ResponseQuery {
+	return pagedResponse(state, req, stateKeyPrefixRotatedKeys, true)
+}
+
+func fetchProposal(state *State, req abcitypes.RequestQuery) abcitypes.ResponseQuery {
+	proposal, resp := proposalFromQuery(state, req)
+	if proposal == nil {
+		return *resp
+	}
+
+	return stateRecordResponse(state, req, proposalStateKey(proposal.ID))
+}
+
+// fetchProposalTally returns the tally of the votes cast so far on an open
+// proposal
+func fetchProposalTally(state *State, req abcitypes.RequestQuery) abcitypes.ResponseQuery {
+	proposal, resp := proposalFromQuery(state, req)
+	if proposal == nil {
+		return *resp
+	}
+
+	return jsonResponse(state, proposal.tally(state))
+}
+
+func fetchProposals(state *State, req abcitypes.RequestQuery) abcitypes.ResponseQuery {
+	return pagedResponse(state, req, stateKeyPrefixProposals, false)
+}
+
+// proposalFromQuery returns the proposal identified by the query path, or a
+// response describing why it could not be found
+func proposalFromQuery(state *State, req abcitypes.RequestQuery) (*Proposal, *abcitypes.ResponseQuery) {
+	path := strings.Split(strings.TrimPrefix(req.Path, "/governance/proposals/"), "/")
+	id, err := strconv.ParseUint(path[0], 10, 64)
+	if err != nil || state.Proposals[id] == nil {
+		return nil, &abcitypes.ResponseQuery{
+			Code:   queryResponseCodeNotFound,
+			Log:    fmt.Sprintf("proposal not found: %s", path[0]),
+			Height: state.Height,
+		}
+	}
+
+	return state.Proposals[id], nil
+}
+
+// fetchPeerRegistry returns the registered node IDs, keyed by node ID, with the
+// height at which each was registered
+func fetchPeerRegistry(state *State, req abcitypes.RequestQuery) abcitypes.ResponseQuery {
+	return pagedResponse(state, req, stateKeyPrefixPeerRegistryNodes, true)
+}
+
+func fetchPeerRegistryPending(state *State, req abcitypes.RequestQuery) abcitypes.ResponseQuery {
+	return pagedResponse(state, req, stateKeyPrefixPeerRegistryPending, false)
+}
+
+// fetchPeerReputation returns the reputation of the peer with the given node ID
+// or IP; reputation is local to this node and not part of the committed state
+func (s *peerReputationStore) fetchPeerReputation(state *State, req abcitypes.RequestQuery) abcitypes.ResponseQuery {
+	path := strings.Split(string(req.Path), "/")
+	key := peerReputationIDKey(path[len(path)-1])
+
+	reputation := s.get(key)
+	if reputation == nil {
+		return abcitypes.ResponseQuery{
+			Code:   queryResponseCodeNotFound,
+			Log:    fmt.Sprintf("no reputation recorded for peer: %s", key),
+			Height: state.Height,
+		}
+	}
+
+	return jsonResponse(state, reputation)
+}
+
+func (s *peerReputationStore) fetchPeerReputations(state *State, req abcitypes.RequestQuery) abcitypes.ResponseQuery {
+	return jsonResponse(state, s.list())
+}
+
+func fetchStakingParams(state *State, req abcitypes.RequestQuery) abcitypes.ResponseQuery {
+	if state.Staking == nil {
+		return abcitypes.ResponseQuery{
+			Code:   queryResponseCodeNotFound,
+			Log:    "no staking params configured",
+			Height: state.Height,
+		}
+	}
+
+	return stateRecordResponse(state, req, paramsStateKey(stateParamsStaking))
+}
+
+func fetchStateHeight(state *State, req abcitypes.RequestQuery) abcitypes.ResponseQuery {
+	return jsonResponse(state, state.Height)
+}
+
+func fetchStateRoot(state *State, req abcitypes.RequestQuery) abcitypes.ResponseQuery {
+	return jsonResponse(state, state.Root)
+}
+
+func fetchUpgradePlan(state *State, req abcitypes.RequestQuery) abcitypes.ResponseQuery {
+	if state.UpgradePlan == nil {
+		return abcitypes.ResponseQuery{
+			Code:   queryResponseCodeNotFound,
+			Log:    "no upgrade scheduled",
+			Height: state.Height,
+		}
+	}
+
+	return stateRecordResponse(state, req, stateKeyUpgradePlan)
+}
+
+func fetchValidator(state *State, req abcitypes.RequestQuery) abcitypes.ResponseQuery {
+	path := strings.Split(string(req.Path), "/")
+	address := strings.ToUpper(path[len(path)-1])
+
+	if state.GetValidator([]byte(address)) == nil {
+		return abcitypes.ResponseQuery{
+			Code:   queryResponseCodeNotFound,
+			Log:    fmt.Sprintf("validator not found: %s", address),
+			Height: state.Height,
+		}
+	}
+
+	return stateRecordResponse(state, req, validatorStateKey(address))
+}
+
+func fetchValidators(state *State, req abcitypes.RequestQuery) abcitypes.ResponseQuery {
+	return pagedResponse(state, req, stateKeyPrefixValidators, false)
+}
+
+// scanStore returns the stored records having the given key prefix
+func scanStore(state *State, req abcitypes.RequestQuery) abcitypes.ResponseQuery {
+	prefix := strings.TrimPrefix(string(req.Path), "/store/")
+	return pagedResponse(state, req, prefix, true)
+}
+
+// pagedResponse returns a page of the records having the given key prefix, as
+// requested by the pagination parameters in the query data; if keys is true,
+// each result includes the record key alongside its value
+func pagedResponse(state *State, req abcitypes.RequestQuery, prefix string, keys bool) abcitypes.ResponseQuery {
+	page, err := pageRequestFromQueryData(req.Data)
+	if err != nil {
+		return abcitypes.ResponseQuery{
+			Code:   queryResponseCodeBadRequest,
+			Log:    err.Error(),
+			Height: state.Height,
+		}
+	}
+
+	records, pagination, err := state.scan(prefix, page)
+	if err != nil {
+		return abcitypes.ResponseQuery{
+			Code:   queryResponseCodeInternalError,
+			Log:    err.Error(),
+			Height: state.Height,
+		}
+	}
+
+	results := make([]json.RawMessage, 0, len(records))
+	for _, record := range records {
+		if !keys {
+			results = append(results, record.value)
+			continue
+		}
+
+		raw, err := json.Marshal(&StoredRecord{
+			Key:   record.key,
+			Value: record.value,
+		})
+		if err != nil {
+			return abcitypes.ResponseQuery{
+				Code:   queryResponseCodeInternalError,
+				Log:    err.Error(),
+				Height: state.Height,
+			}
+		}
+		results = append(results, raw)
+	}
+
+	return jsonResponse(state, &PagedResults{
+		Results:    results,
+		Pagination: pagination,
+	})
+}
+
+// jsonResponse returns the JSON representation of the given value as of the
+// height of the given state
+func jsonResponse(state *State, val interface{}) abcitypes.ResponseQuery {
+	raw, err := json.Marshal(val)
+	if err != nil {
+		return abcitypes.ResponseQuery{
+			Code:   queryResponseCodeInternalError,
+			Log:    err.Error(),
+			Height: state.Height,
+		}
+	}
+
+	return abcitypes.ResponseQuery{
+		Code:   0,
+		Value:  raw,
+		Height: state.Height,
+	}
+}
+
+// stateRecordResponse returns the state record at the given key, including a
+// merkle proof against the state root when requested
+func stateRecordResponse(state *State, req abcitypes.RequestQuery, key string) abcitypes.ResponseQuery {
+	value, proofOps, err := state.prove(key)
+	if err != nil {
+		return abcitypes.ResponseQuery{
+			Code:   queryResponseCodeInternalError,
+			Log:    err.Error(),
+			Height: state.Height,
+		}
+	}
+
+	resp := abcitypes.ResponseQuery{
+		Code:   0,
+		Key:    []byte(key),
+		Value:  value,
+		Height: state.Height,
+	}
+
+	if req.Prove {
+		resp.ProofOps = proofOps
+	}
+
+	return resp
+}
@@ -247,7 +247,7 @@ func (s *Service) vendContractSubscriptionBearerToken(token string, contract *nc
 		return nil, err
 	}
 
-	common.Log.Debugf("vended contract subscription token: %s", tkn.Token)
+	common.Log.Debugf("vended contract subscription token: %s", *tkn.Token)
 	return tkn.Token, nil
 }
 
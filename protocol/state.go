@@ -8,6 +8,7 @@ import (
 	"sync"
 
 	"github.com/providenetwork/baseledger/common"
+	tmproto "github.com/providenetwork/tendermint/proto/tendermint/types"
 	"github.com/providenetwork/tendermint/types"
 )
 
@@ -26,6 +27,29 @@ type State struct {
 	Root       []byte         `json:"root"`
 	Staking    *StakingParams `json:"staking"`
 	Validators []*Validator   `json:"validators"`
+
+	Accounts map[string]int64 `json:"accounts"` // address -> balance
+
+	EntropyParams   *EntropyParams            `json:"entropy_params"`
+	Entropy         map[int64]*Entropy        `json:"entropy"`
+	EntropyRequests map[int64]*EntropyRequest `json:"entropy_requests"`
+
+	PeerRegistry *PeerRegistry `json:"peer_registry"`
+
+	ConsensusParams  *tmproto.ConsensusParams `json:"consensus_params"`
+	GovernanceParams *GovernanceParams        `json:"governance_params"`
+	Proposals        map[uint64]*Proposal     `json:"proposals"` // open proposals
+	ProposalCount    uint64                   `json:"proposal_count"`
+
+	// ProposalEndHeights indexes the open proposals by the height at which
+	// their voting ends
+	ProposalEndHeights map[int64][]uint64 `json:"proposal_end_heights"`
+
+	UpgradePlan     *UpgradePlan     `json:"upgrade_plan"`
+	AppliedUpgrades map[string]int64 `json:"applied_upgrades"` // name -> height applied
+
+	KeyRotations map[string]*KeyRotation `json:"key_rotations"` // validator address -> pending rotation
+	RotatedKeys  map[string]string       `json:"rotated_keys"`  // rotated address -> next address
 }
 
 // GetValidator returns the validator if it exists in the state instance, or nil
@@ -39,6 +63,58 @@ func (s *State) GetValidator(address []byte) *Validator {
 	return nil
 }
 
+// GetEntropy returns the entropy stored at the given height, or nil
+func (s *State) GetEntropy(height int64) *Entropy {
+	if s.Entropy == nil {
+		return nil
+	}
+
+	return s.Entropy[height]
+}
+
+// LatestEntropy returns the entropy stored at the greatest height, or nil
+func (s *State) LatestEntropy() *Entropy {
+	var latest *Entropy
+	for height, entropy := range s.Entropy {
+		if latest == nil || height > latest.Height {
+			latest = entropy
+		}
+	}
+
+	return latest
+}
+
+// SetEntropy stores the given entropy by height and resolves the pending request
+func (s *State) SetEntropy(entropy *Entropy) {
+	if s.Entropy == nil {
+		s.Entropy = map[int64]*Entropy{}
+	}
+
+	s.Entropy[entropy.Height] = entropy
+	delete(s.EntropyRequests, entropy.Height)
+}
+
+// sync replaces the contents of the state instance with a deep copy of the
+// given state, retaining its own name and path
+func (s *State) sync(other *State) error {
+	raw, err := json.Marshal(other)
+	if err != nil {
+		return err
+	}
+
+	var state *State
+	err = json.Unmarshal(raw, &state)
+	if err != nil {
+		return err
+	}
+
+	state.path = s.path
+	state.Name = s.Name
+	*s = *state
+
+	return nil
+}
+
 func (s *State) Save() error {
 	stateMutex.Lock()
 	defer stateMutex.Unlock()
@@ -49,12 +125,15 @@ func (s *State) Save() error {
 		return err
 	}
 
-	err = os.WriteFile(s.path, stateJSON, 0644)
+	// replace the state atomically, so a failed write never leaves a
+	// partial state behind
+	err = os.WriteFile(s.path+".tmp", stateJSON, 0644)
 	if err != nil {
+		os.Remove(s.path + ".tmp")
 		return err
 	}
 
-	return nil
+	return os.Rename(s.path+".tmp", s.path)
 }
 
 // TotalVotingPower returns the total validator votinmg power, as it exists in the state instance
@@ -68,11 +147,29 @@ func (s *State) TotalVotingPower() int64 {
 	return power
 }
 
+// ResetState removes the persisted application state and state history, so
+// the application is initialized from genesis the next time it starts; the
+// node must not be running
+func ResetState(cfg *common.Config) error {
+	for _, name := range []string{abciStateCheckTx, abciStateDeliverTx, abciStateCommit} {
+		err := os.Remove(statePath(cfg, name))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return os.RemoveAll(fmt.Sprintf("%s%s%s", cfg.RootDir, string(os.PathSeparator), stateHistoryDirectory))
+}
+
+func statePath(cfg *common.Config, name string) string {
+	return fmt.Sprintf("%s%sabci-state-%s.json", cfg.RootDir, string(os.PathSeparator), name)
+}
+
 func stateFactory(cfg *common.Config, name string, genesis *types.GenesisDoc) (*State, error) {
 	stateMutex.Lock()
 	defer stateMutex.Unlock()
 
-	path := fmt.Sprintf("%s%sabci-state-%s.json", cfg.RootDir, string(os.PathSeparator), name)
+	path := statePath(cfg, name)
 	if _, err := os.Stat(path); err == nil {
 		stateJSON, err := os.ReadFile(path)
 		if err != nil {
@@ -86,23 +183,58 @@ func stateFactory(cfg *common.Config, name string, genesis *types.GenesisDoc) (*
 		}
 
 		state.path = path
+		if state.ConsensusParams == nil {
+			state.ConsensusParams = genesis.ConsensusParams
+		}
+
 		return state, nil
 	}
 
-	var stateParams *StateParams
-	var staking *StakingParams
-	err := json.Unmarshal(genesis.AppState, &stateParams)
-	if err == nil {
-		common.Log.Debug("unmarshaled genesis state to state params")
-		staking = stateParams.Staking
+	stateParams, err := stateParamsFromAppState(genesis.AppState)
+	if err != nil {
+		return nil, err
 	}
 
-	return &State{
+	governanceParams := stateParams.Governance
+	if governanceParams == nil {
+		governanceParams = defaultGovernanceParams()
+	}
+
+	peerRegistry, err := peerRegistryFactory(stateParams.PeerRegistry)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &State{
 		path:       path,
 		Name:       name,
 		Height:     0,
 		Root:       []byte{},
-		Staking:    staking,
+		Staking:    stateParams.Staking,
 		Validators: make([]*Validator, 0),
-	}, nil
+
+		EntropyParams:   stateParams.Entropy,
+		Entropy:         map[int64]*Entropy{},
+		EntropyRequests: map[int64]*EntropyRequest{},
+
+		PeerRegistry: peerRegistry,
+
+		ConsensusParams:  genesis.ConsensusParams,
+		GovernanceParams: governanceParams,
+		Proposals:        map[uint64]*Proposal{},
+
+		ProposalEndHeights: map[int64][]uint64{},
+
+		AppliedUpgrades: map[string]int64{},
+
+		KeyRotations: map[string]*KeyRotation{},
+		RotatedKeys:  map[string]string{},
+	}
+
+	if stateParams.State != nil {
+		state.importGenesisState(stateParams.State)
+		common.Log.Debugf("imported genesis state exported from %s at height %d", stateParams.State.ExportChainID, stateParams.State.ExportHeight)
+	}
+
+	return state, nil
 }
@@ -0,0 +1,106 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/providenetwork/baseledger/common"
+)
+
+const stateHistoryDirectory = "state-history"
+const stateHistoryFileExtension = ".json"
+
+// stateHistory retains snapshots of the committed state for a window of recent
+// heights, so queries can be answered as of a past committed height
+type stateHistory struct {
+	path   string
+	retain int64
+}
+
+func stateHistoryFactory(cfg *common.Config) (*stateHistory, error) {
+	path := fmt.Sprintf("%s%s%s", cfg.RootDir, string(os.PathSeparator), stateHistoryDirectory)
+	err := os.MkdirAll(path, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	return &stateHistory{
+		path:   path,
+		retain: cfg.StateRetainHeights,
+	}, nil
+}
+
+// load the state as it was committed at the given height
+func (h *stateHistory) load(height int64) (*State, error) {
+	raw, err := os.ReadFile(h.snapshotPath(height))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("state at height %d is not retained", height)
+		}
+		return nil, err
+	}
+
+	var state *State
+	err = json.Unmarshal(raw, &state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal state at height %d; %s", height, err.Error())
+	}
+
+	return state, nil
+}
+
+// save a snapshot of the given committed state and prune snapshots which have
+// fallen outside of the retention window
+func (h *stateHistory) save(state *State) error {
+	if h.retain <= 0 {
+		return nil
+	}
+
+	err := h.write(state)
+	if err != nil {
+		return err
+	}
+
+	return h.prune(state.Height - h.retain)
+}
+
+// write a snapshot of the given committed state, regardless of retention
+func (h *stateHistory) write(state *State) error {
+	raw, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(h.snapshotPath(state.Height), raw, 0644)
+}
+
+// prune removes all snapshots at or below the given height
+func (h *stateHistory) prune(height int64) error {
+	entries, err := os.ReadDir(h.path)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), stateHistoryFileExtension)
+		snapshotHeight, err := strconv.ParseInt(name, 10, 64)
+		if err != nil || snapshotHeight > height {
+			continue
+		}
+
+		err = os.Remove(filepath.Join(h.path, entry.Name()))
+		if err != nil {
+			common.Log.Warningf("failed to prune state snapshot at height %d; %s", snapshotHeight, err.Error())
+		}
+	}
+
+	return nil
+}
+
+func (h *stateHistory) snapshotPath(height int64) string {
+	return filepath.Join(h.path, fmt.Sprintf("%d%s", height, stateHistoryFileExtension))
+}
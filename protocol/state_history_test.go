@@ -0,0 +1,96 @@
+package protocol
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/providenetwork/baseledger/common"
+)
+
+func testStateHistory(t *testing.T, retain int64) *stateHistory {
+	cfg := &common.Config{StateRetainHeights: retain}
+	cfg.RootDir = t.TempDir()
+
+	history, err := stateHistoryFactory(cfg)
+	if err != nil {
+		t.Fatalf("failed to initialize state history; %s", err.Error())
+	}
+
+	return history
+}
+
+func TestStateHistory(t *testing.T) {
+	tests := []struct {
+		name     string
+		retain   int64
+		saved    int64 // states are saved at heights 1 through saved
+		retained []int64
+		pruned   []int64
+	}{
+		{name: "retention disabled", retain: 0, saved: 3, pruned: []int64{1, 2, 3}},
+		{name: "within the window", retain: 3, saved: 3, retained: []int64{1, 2, 3}},
+		{name: "window passed", retain: 3, saved: 6, retained: []int64{4, 5, 6}, pruned: []int64{1, 2, 3}},
+		{name: "single height", retain: 1, saved: 4, retained: []int64{4}, pruned: []int64{1, 2, 3}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			history := testStateHistory(t, test.retain)
+
+			for height := int64(1); height <= test.saved; height++ {
+				err := history.save(&State{Height: height, Root: []byte{byte(height)}})
+				if err != nil {
+					t.Fatalf("failed to save state at height %d; %s", height, err.Error())
+				}
+			}
+
+			for _, height := range test.retained {
+				state, err := history.load(height)
+				if err != nil {
+					t.Fatalf("expected state at height %d to be retained; %s", height, err.Error())
+				}
+
+				if state.Height != height || !bytes.Equal(state.Root, []byte{byte(height)}) {
+					t.Fatalf("expected state committed at height %d; got height %d", height, state.Height)
+				}
+			}
+
+			for _, height := range test.pruned {
+				if _, err := history.load(height); err == nil {
+					t.Fatalf("expected state at height %d not to be retained", height)
+				}
+			}
+		})
+	}
+}
+
+func TestStateHistoryPruneIgnoresOtherFiles(t *testing.T) {
+	history := testStateHistory(t, 1)
+	other := filepath.Join(history.path, "README")
+	if err := os.WriteFile(other, []byte{}, 0644); err != nil {
+		t.Fatalf("failed to write file; %s", err.Error())
+	}
+
+	for height := int64(1); height <= 2; height++ {
+		if err := history.save(&State{Height: height}); err != nil {
+			t.Fatalf("failed to save state at height %d; %s", height, err.Error())
+		}
+	}
+
+	if _, err := os.Stat(other); err != nil {
+		t.Fatalf("expected prune to leave other files in place; %s", err.Error())
+	}
+}
+
+func TestStateHistoryLoadMalformedSnapshot(t *testing.T) {
+	history := testStateHistory(t, 1)
+	if err := os.WriteFile(history.snapshotPath(1), []byte("{"), 0644); err != nil {
+		t.Fatalf("failed to write snapshot; %s", err.Error())
+	}
+
+	if _, err := history.load(1); err == nil {
+		t.Fatal("expected a malformed snapshot to be rejected")
+	}
+}
@@ -1,6 +1,9 @@
 package protocol
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 
 	"github.com/providenetwork/baseledger/common"
@@ -11,7 +14,83 @@ const nchainNetworkIDRopsten = "66d44f30-9092-4182-a3c4-bc02736d6ae5"
 const networkRopsten = "ropsten"
 
 type StateParams struct {
-	Staking *StakingParams `json:"staking"`
+	Accounts     []*Account          `json:"accounts,omitempty"`
+	Entropy      *EntropyParams      `json:"entropy"`
+	Governance   *GovernanceParams   `json:"governance"`
+	PeerRegistry *PeerRegistryParams `json:"peer_registry"`
+	Staking      *StakingParams      `json:"staking"`
+
+	// State is present when the genesis was exported from a running chain
+	State *GenesisState `json:"state,omitempty"`
+
+	// Signatures are the approvals of the genesis by its founding validators
+	Signatures []*GenesisSignature `json:"signatures,omitempty"`
+}
+
+// stateParamsFromAppState parses and validates the genesis app_state; an empty
+// app_state results in the default params
+func stateParamsFromAppState(appState []byte) (*StateParams, error) {
+	var params *StateParams
+	if len(bytes.TrimSpace(appState)) > 0 {
+		err := json.Unmarshal(appState, &params)
+		if err != nil {
+			return nil, fmt.Errorf("malformed genesis app_state; %s", err.Error())
+		}
+	}
+
+	if params == nil {
+		params = &StateParams{}
+	}
+
+	err := params.validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid genesis app_state; %s", err.Error())
+	}
+
+	return params, nil
+}
+
+func (p *StateParams) validate() error {
+	err := validateAccounts(p.Accounts)
+	if err != nil {
+		return err
+	}
+
+	if p.Entropy != nil && p.Entropy.Interval < 0 {
+		return fmt.Errorf("invalid entropy interval: %d", p.Entropy.Interval)
+	}
+
+	if p.Governance != nil {
+		err = p.Governance.validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	if p.PeerRegistry != nil {
+		for _, nodeID := range p.PeerRegistry.NodeIDs {
+			_, err := normalizeNodeID(nodeID)
+			if err != nil {
+				return fmt.Errorf("invalid peer registry; %s", err.Error())
+			}
+		}
+	}
+
+	if p.Staking != nil {
+		err := p.Staking.validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	if p.State != nil {
+		err := p.State.validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 type StakingParams struct {
@@ -19,6 +98,18 @@ type StakingParams struct {
 	Network  *Network                 `json:"network"`
 }
 
+func (p *StakingParams) validate() error {
+	if p.Contract == nil {
+		return errors.New("staking contract required")
+	}
+
+	if p.Network == nil {
+		return errors.New("staking network required")
+	}
+
+	return nil
+}
+
 type Network struct {
 	Ropsten *NetworkParams `json:"ropsten"`
 }
@@ -1,23 +1,152 @@
 package protocol
 
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/providenetwork/tendermint/crypto"
+	"github.com/providenetwork/tendermint/crypto/ed25519"
+	"github.com/providenetwork/tendermint/crypto/tmhash"
+)
+
 const transactionStatusCodeValid = uint32(0)
 const transactionStatusCodeInvalidEmpty = uint32(1)
+const transactionStatusCodeInvalidFormat = uint32(2)
+const transactionStatusCodeInvalidEntropy = uint32(3)
+const transactionStatusCodeUnauthorized = uint32(5)
+const transactionStatusCodeInvalidPeerRegistryChange = uint32(6)
+const transactionStatusCodeInvalidProposal = uint32(7)
+const transactionStatusCodeInvalidVote = uint32(8)
+const transactionStatusCodeInvalidKeyRotation = uint32(9)
+const transactionStatusCodeInvalidNodeRegistration = uint32(10)
+
+const transactionOpcodeEntropy = "entropy"
+const transactionOpcodeEntropyKeyRegistration = "entropy_key_registration"
+const transactionOpcodeKeyRotation = "key_rotation"
+const transactionOpcodeNodeRegistration = "node_registration"
+const transactionOpcodePeerRegistry = "peer_registry"
+const transactionOpcodeProposal = "proposal"
+const transactionOpcodeVote = "vote"
 
-// Transaction is a generic transaction type
+// Transaction is a generic transaction type; transactions which do not carry
+// a recognized opcode are treated as opaque payloads
 type Transaction struct {
 	raw []byte
 
+	Opcode  *string         `json:"opcode"`
+	Payload json.RawMessage `json:"payload"`
+
+	// ChainID binds a signed transaction to a single chain, so it cannot be
+	// replayed on another chain where the signer holds the same key
+	ChainID string `json:"chain_id,omitempty"`
+
+	// Signer is the Ed25519 public key of the validator authorizing the
+	// transaction; the nonce must exceed the signer's last nonce by one
+	Signer    []byte `json:"signer,omitempty"`
+	Nonce     uint64 `json:"nonce,omitempty"`
+	Signature []byte `json:"signature,omitempty"`
+
 	// TODO: review typing
 	// TxID    string
-	// Payload []byte
-	// Opcode  int64
 }
 
 // TransactionFromRaw initializes a new Transaction given its wire representation
 func TransactionFromRaw(tx []byte) (*Transaction, error) {
-	return &Transaction{
-		raw: tx,
-	}, nil
+	transaction := &Transaction{}
+	err := json.Unmarshal(tx, &transaction)
+	if err != nil {
+		transaction = &Transaction{}
+	}
+
+	transaction.raw = tx
+	return transaction, nil
+}
+
+// transactionFactory initializes a new Transaction with the given opcode and payload
+func transactionFactory(opcode string, payload interface{}) (*Transaction, error) {
+	rawPayload, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := &Transaction{
+		Opcode:  &opcode,
+		Payload: rawPayload,
+	}
+
+	tx.raw, err = json.Marshal(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	return tx, nil
+}
+
+// Raw returns the wire representation of the transaction
+func (tx *Transaction) Raw() []byte {
+	return tx.raw
+}
+
+// Sign the transaction for the given chain with the given Ed25519 private key
+// and nonce
+func (tx *Transaction) Sign(chainID string, key crypto.PrivKey, nonce uint64) error {
+	tx.ChainID = chainID
+	tx.Signer = key.PubKey().Bytes()
+	tx.Nonce = nonce
+	tx.Signature = nil
+
+	msg, err := tx.signBytes()
+	if err != nil {
+		return err
+	}
+
+	tx.Signature, err = key.Sign(msg)
+	if err != nil {
+		return err
+	}
+
+	tx.raw, err = json.Marshal(tx)
+	return err
+}
+
+// signBytes returns the canonical bytes signed by the transaction signer
+func (tx *Transaction) signBytes() ([]byte, error) {
+	unsigned := *tx
+	unsigned.Signature = nil
+	return json.Marshal(unsigned)
+}
+
+// signerAddress returns the address of the transaction signer
+func (tx *Transaction) signerAddress() string {
+	return crypto.Address(tmhash.SumTruncated(tx.Signer)).String()
+}
+
+// verifySignature verifies the transaction was signed by its signer for the
+// given chain
+func (tx *Transaction) verifySignature(chainID string) error {
+	if tx.ChainID != chainID {
+		return fmt.Errorf("transaction signed for chain %q; expected chain %s", tx.ChainID, chainID)
+	}
+
+	if len(tx.Signer) != ed25519.PubKeySize {
+		return errors.New("transaction signer required")
+	}
+
+	if len(tx.Signature) == 0 {
+		return errors.New("transaction signature required")
+	}
+
+	msg, err := tx.signBytes()
+	if err != nil {
+		return err
+	}
+
+	if !ed25519.PubKey(tx.Signer).VerifySignature(msg, tx.Signature) {
+		return fmt.Errorf("invalid transaction signature for signer %s", tx.signerAddress())
+	}
+
+	return nil
 }
 
 func (tx *Transaction) calculateGas() int64 {
@@ -25,11 +154,213 @@ func (tx *Transaction) calculateGas() int64 {
 	return int64(0)
 }
 
-func (tx *Transaction) isValid() (code uint32) {
+// entropy returns the entropy carried by an entropy transaction
+func (tx *Transaction) entropy() (*Entropy, error) {
+	var entropy *Entropy
+	err := json.Unmarshal(tx.Payload, &entropy)
+	if err != nil {
+		return nil, err
+	}
+
+	return entropy, nil
+}
+
+// entropyKeyRegistration returns the entropy key registration carried by an
+// entropy key registration transaction
+func (tx *Transaction) entropyKeyRegistration() (*EntropyKeyRegistration, error) {
+	var registration *EntropyKeyRegistration
+	err := json.Unmarshal(tx.Payload, &registration)
+	if err != nil {
+		return nil, err
+	}
+
+	if registration == nil {
+		return nil, errors.New("nil entropy key registration")
+	}
+
+	return registration, nil
+}
+
+// peerRegistryChange returns the peer registry change carried by a peer
+// registry transaction
+func (tx *Transaction) peerRegistryChange() (*PeerRegistryChange, error) {
+	var change *PeerRegistryChange
+	err := json.Unmarshal(tx.Payload, &change)
+	if err != nil {
+		return nil, err
+	}
+
+	if change == nil {
+		return nil, errors.New("nil peer registry change")
+	}
+
+	err = change.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return change, nil
+}
+
+// proposal returns the governance proposal carried by a proposal transaction
+func (tx *Transaction) proposal() (*Proposal, error) {
+	var proposal *Proposal
+	err := json.Unmarshal(tx.Payload, &proposal)
+	if err != nil {
+		return nil, err
+	}
+
+	if proposal == nil {
+		return nil, errors.New("nil proposal")
+	}
+
+	return proposal, nil
+}
+
+// vote returns the governance vote carried by a vote transaction
+func (tx *Transaction) vote() (*Vote, error) {
+	var vote *Vote
+	err := json.Unmarshal(tx.Payload, &vote)
+	if err != nil {
+		return nil, err
+	}
+
+	if vote == nil {
+		return nil, errors.New("nil vote")
+	}
+
+	err = vote.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return vote, nil
+}
+
+// keyRotation returns the key rotation carried by a key rotation transaction
+func (tx *Transaction) keyRotation() (*KeyRotation, error) {
+	var rotation *KeyRotation
+	err := json.Unmarshal(tx.Payload, &rotation)
+	if err != nil {
+		return nil, err
+	}
+
+	if rotation == nil {
+		return nil, errors.New("nil key rotation")
+	}
+
+	return rotation, nil
+}
+
+// nodeRegistration returns the node registration carried by a node
+// registration transaction
+func (tx *Transaction) nodeRegistration() (*NodeRegistration, error) {
+	var registration *NodeRegistration
+	err := json.Unmarshal(tx.Payload, &registration)
+	if err != nil {
+		return nil, err
+	}
+
+	if registration == nil {
+		return nil, errors.New("nil node registration")
+	}
+
+	return registration, nil
+}
+
+// isValid returns the status code of the transaction; signed transactions
+// must be signed for the given chain
+func (tx *Transaction) isValid(chainID string) (code uint32) {
 	if tx == nil || len(tx.raw) == 0 {
 		return transactionStatusCodeInvalidEmpty
 	}
 
-	// TODO: check transaction format
+	if tx.Opcode != nil {
+		switch *tx.Opcode {
+		case transactionOpcodeEntropy:
+			entropy, err := tx.entropy()
+			if err != nil || entropy == nil {
+				return transactionStatusCodeInvalidFormat
+			}
+		case transactionOpcodeEntropyKeyRegistration:
+			registration, err := tx.entropyKeyRegistration()
+			if err != nil {
+				return transactionStatusCodeInvalidFormat
+			}
+
+			err = tx.verifySignature(chainID)
+			if err != nil {
+				return transactionStatusCodeUnauthorized
+			}
+
+			err = registration.verify(chainID, tx.Signer, tx.Nonce)
+			if err != nil {
+				return transactionStatusCodeInvalidEntropy
+			}
+		case transactionOpcodePeerRegistry:
+			_, err := tx.peerRegistryChange()
+			if err != nil {
+				return transactionStatusCodeInvalidFormat
+			}
+
+			err = tx.verifySignature(chainID)
+			if err != nil {
+				return transactionStatusCodeUnauthorized
+			}
+		case transactionOpcodeProposal:
+			_, err := tx.proposal()
+			if err != nil {
+				return transactionStatusCodeInvalidFormat
+			}
+
+			err = tx.verifySignature(chainID)
+			if err != nil {
+				return transactionStatusCodeUnauthorized
+			}
+		case transactionOpcodeKeyRotation:
+			rotation, err := tx.keyRotation()
+			if err != nil {
+				return transactionStatusCodeInvalidFormat
+			}
+
+			err = tx.verifySignature(chainID)
+			if err != nil {
+				return transactionStatusCodeUnauthorized
+			}
+
+			err = rotation.verify(chainID, tx.Signer, tx.Nonce)
+			if err != nil {
+				return transactionStatusCodeInvalidKeyRotation
+			}
+		case transactionOpcodeNodeRegistration:
+			registration, err := tx.nodeRegistration()
+			if err != nil {
+				return transactionStatusCodeInvalidFormat
+			}
+
+			err = tx.verifySignature(chainID)
+			if err != nil {
+				return transactionStatusCodeUnauthorized
+			}
+
+			err = registration.verify(chainID, tx.Signer, tx.Nonce)
+			if err != nil {
+				return transactionStatusCodeInvalidNodeRegistration
+			}
+		case transactionOpcodeVote:
+			_, err := tx.vote()
+			if err != nil {
+				return transactionStatusCodeInvalidFormat
+			}
+
+			err = tx.verifySignature(chainID)
+			if err != nil {
+				return transactionStatusCodeUnauthorized
+			}
+		default:
+			return transactionStatusCodeInvalidFormat
+		}
+	}
+
 	return transactionStatusCodeValid
 }
@@ -0,0 +1,64 @@
+package protocol
+
+import (
+	"bytes"
+	"testing"
+
+	abcitypes "github.com/providenetwork/tendermint/abci/types"
+	"github.com/providenetwork/tendermint/crypto/ed25519"
+)
+
+func TestCheckTx(t *testing.T) {
+	validatorKey := ed25519.GenPrivKey()
+	unstakedKey := ed25519.GenPrivKey()
+	otherKey := ed25519.GenPrivKey()
+	prover := testEntropyProver(t, validatorKey, 1)
+
+	vote := func(key ed25519.PrivKey, nonce uint64) []byte {
+		tx, _ := transactionFactory(transactionOpcodeVote, &Vote{ProposalID: 1, Option: voteOptionYes})
+		tx.Sign(testChainID, key, nonce)
+		return tx.raw
+	}
+
+	entropy := func(signer ed25519.PrivKey) []byte {
+		entropy, _ := prover.prove(&EntropyRequest{
+			Height:   10,
+			Proposer: prover.address,
+			Seed:     bytes.Repeat([]byte{1}, 32),
+		})
+		msg, _ := entropy.signBytes()
+		entropy.Signature, _ = signer.Sign(msg)
+		tx, _ := transactionFactory(transactionOpcodeEntropy, entropy)
+		return tx.raw
+	}
+
+	// the transactions are checked in order against the same check tx state
+	tests := []struct {
+		name string
+		tx   []byte
+		code uint32
+	}{
+		{name: "opaque payload", tx: []byte("payload"), code: transactionStatusCodeValid},
+		{name: "unstaked signer", tx: vote(unstakedKey, 1), code: transactionStatusCodeUnauthorized},
+		{name: "nonce ahead of the validator", tx: vote(validatorKey, 2), code: transactionStatusCodeUnauthorized},
+		{name: "next nonce", tx: vote(validatorKey, 1), code: transactionStatusCodeValid},
+		{name: "replayed nonce", tx: vote(validatorKey, 1), code: transactionStatusCodeUnauthorized},
+		{name: "second transaction in the block", tx: vote(validatorKey, 2), code: transactionStatusCodeValid},
+		{name: "entropy signed by the proposer", tx: entropy(validatorKey), code: transactionStatusCodeValid},
+		{name: "entropy signed by another key", tx: entropy(otherKey), code: transactionStatusCodeInvalidEntropy},
+	}
+
+	validator := testValidator(validatorKey, 10)
+	validator.registerEntropyKey(prover.keypair.PublicKey, 0)
+	b := testBaseline(validator, testValidator(unstakedKey, 0))
+	b.DeliverTxState = &State{}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := b.CheckTx(abcitypes.RequestCheckTx{Tx: test.tx})
+			if resp.Code != test.code {
+				t.Fatalf("expected status code %d; got %d; %s", test.code, resp.Code, resp.Log)
+			}
+		})
+	}
+}
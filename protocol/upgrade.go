@@ -0,0 +1,134 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/providenetwork/baseledger/common"
+	abcitypes "github.com/providenetwork/tendermint/abci/types"
+	tmproto "github.com/providenetwork/tendermint/proto/tendermint/types"
+)
+
+// AppVersion is the application protocol version implemented by this binary;
+// it must be incremented for every release which changes state transitions
+const AppVersion = uint64(1)
+
+const stateKeyPrefixUpgrades = "upgrades/"
+const stateKeyUpgradePlan = "upgrades/plan"
+
+// UpgradePlan schedules a coordinated software upgrade; nodes running a binary
+// which does not implement the target app version halt before the upgrade
+// height, and resume once restarted with a binary which does
+type UpgradePlan struct {
+	Name       string `json:"name"`
+	Height     int64  `json:"height"`
+	AppVersion uint64 `json:"app_version"`
+	Info       string `json:"info,omitempty"`
+}
+
+func appliedUpgradeStateKey(name string) string {
+	return fmt.Sprintf("%sapplied/%s", stateKeyPrefixUpgrades, name)
+}
+
+func (p *UpgradePlan) validate(state *State) error {
+	if p.Name == "" {
+		return errors.New("upgrade name required")
+	}
+
+	if _, ok := state.AppliedUpgrades[p.Name]; ok {
+		return fmt.Errorf("upgrade %s has already been applied", p.Name)
+	}
+
+	if p.Height <= state.Height+1 {
+		return fmt.Errorf("upgrade height %d must be in the future", p.Height)
+	}
+
+	if p.AppVersion <= state.appVersion() {
+		return fmt.Errorf("upgrade app version %d must be greater than the current app version %d", p.AppVersion, state.appVersion())
+	}
+
+	return nil
+}
+
+// appVersion returns the app version the network is currently running
+func (s *State) appVersion() uint64 {
+	return s.consensusParams().Version.AppVersion
+}
+
+// scheduleUpgrade replaces any scheduled upgrade with the given plan
+func (s *State) scheduleUpgrade(plan *UpgradePlan) {
+	s.UpgradePlan = plan
+	common.Log.Debugf("scheduled upgrade %s to app version %d at height %d", plan.Name, plan.AppVersion, plan.Height)
+}
+
+// upgradeDue returns the scheduled upgrade plan if it takes effect at or
+// before the given height
+func (s *State) upgradeDue(height int64) *UpgradePlan {
+	if s.UpgradePlan == nil || height < s.UpgradePlan.Height {
+		return nil
+	}
+
+	return s.UpgradePlan
+}
+
+// prepareUpgrade returns the consensus param update which sets the app version
+// of the scheduled upgrade, if the upgrade takes effect in the next block
+func (s *State) prepareUpgrade(height int64) *abcitypes.ConsensusParams {
+	plan := s.upgradeDue(height + 1)
+	if plan == nil {
+		return nil
+	}
+
+	params := *s.consensusParams()
+	params.Version = tmproto.VersionParams{AppVersion: plan.AppVersion}
+	s.ConsensusParams = &params
+
+	return &abcitypes.ConsensusParams{
+		Version: &tmproto.VersionParams{AppVersion: plan.AppVersion},
+	}
+}
+
+// applyUpgrade records the scheduled upgrade as applied at the given height;
+// the binary must implement the target app version
+func (s *State) applyUpgrade(height int64) error {
+	plan := s.upgradeDue(height)
+	if plan == nil {
+		return nil
+	}
+
+	if plan.AppVersion != AppVersion {
+		return fmt.Errorf("upgrade %s requires app version %d at height %d; this binary implements app version %d", plan.Name, plan.AppVersion, plan.Height, AppVersion)
+	}
+
+	if s.AppliedUpgrades == nil {
+		s.AppliedUpgrades = map[string]int64{}
+	}
+
+	s.AppliedUpgrades[plan.Name] = height
+	s.UpgradePlan = nil
+	common.Log.Infof("applied upgrade %s to app version %d at height %d", plan.Name, plan.AppVersion, height)
+
+	return nil
+}
+
+// checkAppVersion returns an error if this binary cannot process the next
+// block on top of the given committed state
+func checkAppVersion(state *State) error {
+	if plan := state.upgradeDue(state.Height + 1); plan != nil {
+		if plan.AppVersion != AppVersion {
+			return fmt.Errorf("upgrade %s requires app version %d at height %d; this binary implements app version %d", plan.Name, plan.AppVersion, plan.Height, AppVersion)
+		}
+
+		return nil
+	}
+
+	if plan := state.UpgradePlan; plan != nil && plan.AppVersion == AppVersion && state.appVersion() != AppVersion {
+		return fmt.Errorf("this binary implements app version %d for upgrade %s, which does not take effect until height %d", AppVersion, plan.Name, plan.Height)
+	}
+
+	if state.appVersion() > AppVersion {
+		return fmt.Errorf("network is running app version %d; this binary implements app version %d", state.appVersion(), AppVersion)
+	}
+
+	return nil
+}
@@ -0,0 +1,161 @@
+package protocol
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/providenetwork/baseledger/common"
+	abcitypes "github.com/providenetwork/tendermint/abci/types"
+	tmproto "github.com/providenetwork/tendermint/proto/tendermint/types"
+	"github.com/providenetwork/tendermint/types"
+)
+
+// testUpgradeState returns a state committed at the given height which runs
+// the given app version
+func testUpgradeState(height int64, appVersion uint64, plan *UpgradePlan) *State {
+	params := types.DefaultConsensusParams()
+	params.Version.AppVersion = appVersion
+
+	return &State{
+		Height:          height,
+		ConsensusParams: params,
+		UpgradePlan:     plan,
+	}
+}
+
+func TestCheckAppVersion(t *testing.T) {
+	tests := []struct {
+		name       string
+		appVersion uint64
+		plan       *UpgradePlan
+		err        bool
+	}{
+		{name: "no upgrade scheduled", appVersion: AppVersion},
+		{name: "upgrade ahead of the next block", appVersion: AppVersion, plan: &UpgradePlan{Name: "v2", Height: 12, AppVersion: AppVersion + 1}},
+		{name: "upgrade at the next block", appVersion: AppVersion, plan: &UpgradePlan{Name: "v2", Height: 11, AppVersion: AppVersion + 1}, err: true},
+		{name: "upgrade past due", appVersion: AppVersion, plan: &UpgradePlan{Name: "v2", Height: 5, AppVersion: AppVersion + 1}, err: true},
+		{name: "upgraded binary at the upgrade height", appVersion: AppVersion - 1, plan: &UpgradePlan{Name: "v1", Height: 11, AppVersion: AppVersion}},
+		{name: "upgraded binary ahead of the upgrade height", appVersion: AppVersion - 1, plan: &UpgradePlan{Name: "v1", Height: 12, AppVersion: AppVersion}, err: true},
+		{name: "network ahead of the binary", appVersion: AppVersion + 1, err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkAppVersion(testUpgradeState(10, test.appVersion, test.plan))
+			if (err != nil) != test.err {
+				t.Fatalf("expected error: %v; got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestApplyUpgrade(t *testing.T) {
+	plan := &UpgradePlan{Name: "v1", Height: 11, AppVersion: AppVersion}
+	state := testUpgradeState(9, AppVersion-1, plan)
+
+	// the app version is updated by the block before the upgrade height, and
+	// the upgrade is applied once the block at the upgrade height begins
+	tests := []struct {
+		height     int64
+		updated    bool
+		applied    bool
+		appVersion uint64
+	}{
+		{height: 9, appVersion: AppVersion - 1},
+		{height: 10, updated: true, appVersion: AppVersion},
+		{height: 11, applied: true, appVersion: AppVersion},
+		{height: 12, appVersion: AppVersion},
+	}
+
+	for _, test := range tests {
+		err := state.applyUpgrade(test.height)
+		if err != nil {
+			t.Fatalf("failed to apply upgrade at height %d; %s", test.height, err.Error())
+		}
+
+		if _, ok := state.AppliedUpgrades[plan.Name]; ok != (test.height >= 11) {
+			t.Fatalf("expected upgrade applied at height %d: %v", test.height, test.height >= 11)
+		}
+
+		if test.applied && (state.AppliedUpgrades[plan.Name] != test.height || state.UpgradePlan != nil) {
+			t.Fatalf("expected upgrade to be applied at height %d", test.height)
+		}
+
+		update := state.prepareUpgrade(test.height)
+		if (update != nil) != test.updated {
+			t.Fatalf("expected app version update at height %d: %v", test.height, test.updated)
+		}
+
+		if update != nil && update.Version.AppVersion != plan.AppVersion {
+			t.Fatalf("expected app version update to %d; got %d", plan.AppVersion, update.Version.AppVersion)
+		}
+
+		if state.appVersion() != test.appVersion {
+			t.Fatalf("expected app version %d at height %d; got %d", test.appVersion, test.height, state.appVersion())
+		}
+	}
+
+	err := testUpgradeState(10, AppVersion, &UpgradePlan{Name: "v2", Height: 11, AppVersion: AppVersion + 1}).applyUpgrade(11)
+	if err == nil {
+		t.Fatal("expected an upgrade to an app version this binary does not implement to be refused")
+	}
+}
+
+func TestCommitHaltsForUpgrade(t *testing.T) {
+	tests := []struct {
+		name string
+		plan *UpgradePlan
+		halt bool
+	}{
+		{name: "upgrade ahead of the next block", plan: &UpgradePlan{Name: "v2", Height: 12, AppVersion: AppVersion + 1}},
+		{name: "upgrade at the next block", plan: &UpgradePlan{Name: "v2", Height: 11, AppVersion: AppVersion + 1}, halt: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stopped := make(chan struct{})
+			b := &Baseline{
+				Config:         &common.Config{},
+				CheckTxState:   &State{},
+				DeliverTxState: testUpgradeState(9, AppVersion, test.plan),
+				CommitState:    &State{path: filepath.Join(t.TempDir(), "state.json")},
+				StopConsensus:  func() { close(stopped) },
+				halt:           make(chan string, 1),
+				stateHistory:   testStateHistory(t, 0),
+			}
+
+			b.Commit()
+			if b.CommitState.Height != 10 {
+				t.Fatalf("expected state committed at height 10; got %d", b.CommitState.Height)
+			}
+
+			if b.halting != test.halt {
+				t.Fatalf("expected halting: %v", test.halt)
+			}
+
+			if !test.halt {
+				return
+			}
+
+			select {
+			case <-b.halt:
+			case <-time.After(time.Second):
+				t.Fatal("expected the node to be signalled to halt")
+			}
+
+			select {
+			case <-stopped:
+			default:
+				t.Fatal("expected consensus to be stopped before the node is signalled to halt")
+			}
+
+			// blocks started regardless of the halt leave the state untouched
+			b.BeginBlock(abcitypes.RequestBeginBlock{Header: tmproto.Header{Height: 11}})
+			b.Commit()
+			if b.CommitState.Height != 10 || b.DeliverTxState.Height != 10 {
+				t.Fatalf("expected no block to be executed after the halt; committed height %d", b.CommitState.Height)
+			}
+		})
+	}
+}
@@ -17,6 +17,18 @@ type Validator struct {
 	Address   *string `json:"address,omitempty"`
 	PublicKey []byte  `json:"public_key"`
 	Stake     *int64  `json:"stake"`
+
+	// EntropyPublicKey is the registered VRF key of the validator, which
+	// proves entropy for seeds committed after EntropyKeyHeight
+	EntropyPublicKey []byte `json:"entropy_public_key,omitempty"`
+	EntropyKeyHeight int64  `json:"entropy_key_height,omitempty"`
+
+	// NodeID is the p2p node ID registered by the validator; a validator
+	// which has not registered one is known by its address
+	NodeID *string `json:"node_id,omitempty"`
+
+	// Nonce is the nonce of the last transaction signed by the validator
+	Nonce uint64 `json:"nonce,omitempty"`
 }
 
 func defaultValidatorsFactory(genesis *types.GenesisDoc) []abcitypes.ValidatorUpdate {
@@ -61,7 +73,7 @@ func (v *Validator) AdjustStake(delta int64) int64 {
 	*v.Stake += delta
 
 	if *v.Stake < 0 {
-		common.Log.Warningf("staking delta for validator %s resulted in negative stake (%d); stake will be set to zero", v.Address, v.Stake)
+		common.Log.Warningf("staking delta for validator %s resulted in negative stake (%d); stake will be set to zero", *v.Address, *v.Stake)
 		stake := int64(0)
 		v.Stake = &stake
 	}
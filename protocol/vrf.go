@@ -0,0 +1,232 @@
+package protocol
+
+import (
+	"crypto/sha512"
+	"errors"
+	"fmt"
+
+	"github.com/oasisprotocol/curve25519-voi/curve"
+	"github.com/oasisprotocol/curve25519-voi/curve/scalar"
+)
+
+// ECVRF-EDWARDS25519-SHA512-TAI, as specified by RFC 9381; the key material
+// is a standard 32-byte Ed25519 seed, so any Ed25519 keypair can serve as a
+// VRF keypair
+
+const vrfSuite = byte(0x03)
+const vrfChallengeLength = 16
+const vrfOutputLength = sha512.Size
+const vrfProofLength = 32 + vrfChallengeLength + scalar.ScalarSize
+const vrfPublicKeyLength = 32
+const vrfSeedLength = 32
+
+const vrfDomainSeparatorEncodeToCurve = byte(0x01)
+const vrfDomainSeparatorChallenge = byte(0x02)
+const vrfDomainSeparatorProofToHash = byte(0x03)
+const vrfDomainSeparatorBack = byte(0x00)
+
+var errVRFInvalidProof = errors.New("invalid VRF proof")
+
+// vrfKeypair is an Ed25519 seed and its derived VRF public key
+type vrfKeypair struct {
+	seed      []byte
+	secret    *scalar.Scalar
+	nonceSalt []byte
+	PublicKey []byte
+}
+
+// vrfKeypairFromSeed derives the VRF keypair for the given 32-byte seed
+func vrfKeypairFromSeed(seed []byte) (*vrfKeypair, error) {
+	if len(seed) != vrfSeedLength {
+		return nil, fmt.Errorf("invalid %d-byte VRF seed", len(seed))
+	}
+
+	digest := sha512.Sum512(seed)
+	digest[0] &= 248
+	digest[31] &= 127
+	digest[31] |= 64
+
+	x, err := scalar.NewFromBytesModOrder(digest[:32])
+	if err != nil {
+		return nil, err
+	}
+
+	y := curve.NewEdwardsPoint().MulBasepoint(curve.ED25519_BASEPOINT_TABLE, x)
+	publicKey := curve.NewCompressedEdwardsY().SetEdwardsPoint(y)
+
+	return &vrfKeypair{
+		seed:      seed,
+		secret:    x,
+		nonceSalt: digest[32:],
+		PublicKey: publicKey[:],
+	}, nil
+}
+
+// Prove returns the VRF output and proof for the given input
+func (k *vrfKeypair) Prove(alpha []byte) (output, proof []byte, err error) {
+	h, err := vrfEncodeToCurve(k.PublicKey, alpha)
+	if err != nil {
+		return nil, nil, err
+	}
+	hString := curve.NewCompressedEdwardsY().SetEdwardsPoint(h)
+
+	gamma := curve.NewEdwardsPoint().Mul(h, k.secret)
+
+	nonceDigest := sha512.New()
+	nonceDigest.Write(k.nonceSalt)
+	nonceDigest.Write(hString[:])
+	nonce, err := scalar.NewFromBytesModOrderWide(nonceDigest.Sum(nil))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	u := curve.NewEdwardsPoint().MulBasepoint(curve.ED25519_BASEPOINT_TABLE, nonce)
+	v := curve.NewEdwardsPoint().Mul(h, nonce)
+
+	challenge := vrfChallenge(k.PublicKey, h, gamma, u, v)
+	c, err := vrfChallengeScalar(challenge)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s := scalar.New().Mul(c, k.secret)
+	s.Add(s, nonce)
+
+	gammaString := curve.NewCompressedEdwardsY().SetEdwardsPoint(gamma)
+	proof = make([]byte, 0, vrfProofLength)
+	proof = append(proof, gammaString[:]...)
+	proof = append(proof, challenge...)
+
+	sBytes := make([]byte, scalar.ScalarSize)
+	err = s.ToBytes(sBytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	proof = append(proof, sBytes...)
+
+	return vrfProofToHash(gamma), proof, nil
+}
+
+// vrfVerify verifies the proof for the given public key and input, returning
+// the VRF output when the proof is valid
+func vrfVerify(publicKey, alpha, proof []byte) ([]byte, error) {
+	if len(publicKey) != vrfPublicKeyLength {
+		return nil, fmt.Errorf("invalid %d-byte VRF public key", len(publicKey))
+	}
+
+	if len(proof) != vrfProofLength {
+		return nil, fmt.Errorf("invalid %d-byte VRF proof", len(proof))
+	}
+
+	y, err := vrfDecodePoint(publicKey)
+	if err != nil || y.IsSmallOrder() {
+		return nil, fmt.Errorf("invalid VRF public key")
+	}
+
+	gamma, err := vrfDecodePoint(proof[:32])
+	if err != nil {
+		return nil, errVRFInvalidProof
+	}
+
+	challenge := proof[32 : 32+vrfChallengeLength]
+	c, err := vrfChallengeScalar(challenge)
+	if err != nil {
+		return nil, errVRFInvalidProof
+	}
+
+	s, err := scalar.NewFromCanonicalBytes(proof[32+vrfChallengeLength:])
+	if err != nil {
+		return nil, errVRFInvalidProof
+	}
+
+	h, err := vrfEncodeToCurve(publicKey, alpha)
+	if err != nil {
+		return nil, err
+	}
+
+	negC := scalar.New().Neg(c)
+
+	// U = s*B - c*Y
+	u := curve.NewEdwardsPoint().DoubleScalarMulBasepointVartime(negC, y, s)
+
+	// V = s*H - c*Gamma
+	v := curve.NewEdwardsPoint().MultiscalarMulVartime(
+		[]*scalar.Scalar{s, negC},
+		[]*curve.EdwardsPoint{h, gamma},
+	)
+
+	expected := vrfChallenge(publicKey, h, gamma, u, v)
+	for i := range expected {
+		if expected[i] != challenge[i] {
+			return nil, errVRFInvalidProof
+		}
+	}
+
+	return vrfProofToHash(gamma), nil
+}
+
+// vrfEncodeToCurve hashes the public key and input to a point in the prime
+// order subgroup using the try-and-increment method
+func vrfEncodeToCurve(publicKey, alpha []byte) (*curve.EdwardsPoint, error) {
+	for ctr := 0; ctr < 256; ctr++ {
+		digest := sha512.New()
+		digest.Write([]byte{vrfSuite, vrfDomainSeparatorEncodeToCurve})
+		digest.Write(publicKey)
+		digest.Write(alpha)
+		digest.Write([]byte{byte(ctr), vrfDomainSeparatorBack})
+
+		candidate, err := vrfDecodePoint(digest.Sum(nil)[:32])
+		if err != nil {
+			continue
+		}
+
+		h := curve.NewEdwardsPoint().MulByCofactor(candidate)
+		if h.IsIdentity() {
+			continue
+		}
+
+		return h, nil
+	}
+
+	return nil, errors.New("failed to encode VRF input to curve")
+}
+
+func vrfChallenge(publicKey []byte, points ...*curve.EdwardsPoint) []byte {
+	digest := sha512.New()
+	digest.Write([]byte{vrfSuite, vrfDomainSeparatorChallenge})
+	digest.Write(publicKey)
+	for _, point := range points {
+		compressed := curve.NewCompressedEdwardsY().SetEdwardsPoint(point)
+		digest.Write(compressed[:])
+	}
+	digest.Write([]byte{vrfDomainSeparatorBack})
+
+	return digest.Sum(nil)[:vrfChallengeLength]
+}
+
+func vrfChallengeScalar(challenge []byte) (*scalar.Scalar, error) {
+	buf := make([]byte, scalar.ScalarSize)
+	copy(buf, challenge)
+	return scalar.NewFromBytesModOrder(buf)
+}
+
+func vrfDecodePoint(raw []byte) (*curve.EdwardsPoint, error) {
+	compressed, err := curve.NewCompressedEdwardsYFromBytes(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	return curve.NewEdwardsPoint().SetCompressedY(compressed)
+}
+
+func vrfProofToHash(gamma *curve.EdwardsPoint) []byte {
+	point := curve.NewEdwardsPoint().MulByCofactor(gamma)
+	compressed := curve.NewCompressedEdwardsY().SetEdwardsPoint(point)
+
+	digest := sha512.New()
+	digest.Write([]byte{vrfSuite, vrfDomainSeparatorProofToHash})
+	digest.Write(compressed[:])
+	digest.Write([]byte{vrfDomainSeparatorBack})
+
+	return digest.Sum(nil)
+}
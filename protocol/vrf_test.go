@@ -0,0 +1,126 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// vrfTestVectors are the ECVRF-EDWARDS25519-SHA512-TAI examples of RFC 9381,
+// appendix B.3
+var vrfTestVectors = []struct {
+	name      string
+	secretKey string
+	publicKey string
+	alpha     string
+	proof     string
+	output    string
+}{
+	{
+		name:      "example 16",
+		secretKey: "9d61b19deffd5a60ba844af492ec2cc44449c5697b326919703bac031cae7f60",
+		publicKey: "d75a980182b10ab7d54bfed3c964073a0ee172f3daa62325af021a68f707511a",
+		alpha:     "",
+		proof:     "8657106690b5526245a92b003bb079ccd1a92130477671f6fc01ad16f26f723f26f8a57ccaed74ee1b190bed1f479d9727d2d0f9b005a6e456a35d4fb0daab1268a1b0db10836d9826a528ca76567805",
+		output:    "90cf1df3b703cce59e2a35b925d411164068269d7b2d29f3301c03dd757876ff66b71dda49d2de59d03450451af026798e8f81cd2e333de5cdf4f3e140fdd8ae",
+	},
+	{
+		name:      "example 17",
+		secretKey: "4ccd089b28ff96da9db6c346ec114e0f5b8a319f35aba624da8cf6ed4fb8a6fb",
+		publicKey: "3d4017c3e843895a92b70aa74d1b7ebc9c982ccf2ec4968cc0cd55f12af4660c",
+		alpha:     "72",
+		proof:     "f3141cd382dc42909d19ec5110469e4feae18300e94f304590abdced48aed5933bf0864a62558b3ed7f2fea45c92a465301b3bbf5e3e54ddf2d935be3b67926da3ef39226bbc355bdc9850112c8f4b02",
+		output:    "eb4440665d3891d668e7e0fcaf587f1b4bd7fbfe99d0eb2211ccec90496310eb5e33821bc613efb94db5e5b54c70a848a0bef4553a41befc57663b56373a5031",
+	},
+	{
+		name:      "example 18",
+		secretKey: "c5aa8df43f9f837bedb7442f31dcb7b166d38535076f094b85ce3a2e0b4458f7",
+		publicKey: "fc51cd8e6218a1a38da47ed00230f0580816ed13ba3303ac5deb911548908025",
+		alpha:     "af82",
+		proof:     "9bc0f79119cc5604bf02d23b4caede71393cedfbb191434dd016d30177ccbf8096bb474e53895c362d8628ee9f9ea3c0e52c7a5c691b6c18c9979866568add7a2d41b00b05081ed0f58ee5e31b3a970e",
+		output:    "645427e5d00c62a23fb703732fa5d892940935942101e456ecca7bb217c61c452118fec1219202a0edcf038bb6373241578be7217ba85a2687f7a0310b2df19f",
+	},
+}
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	raw, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("failed to decode hex %s; %s", s, err.Error())
+	}
+
+	return raw
+}
+
+func TestVRFTestVectors(t *testing.T) {
+	for _, vector := range vrfTestVectors {
+		t.Run(vector.name, func(t *testing.T) {
+			keypair, err := vrfKeypairFromSeed(mustDecodeHex(t, vector.secretKey))
+			if err != nil {
+				t.Fatalf("failed to derive VRF keypair; %s", err.Error())
+			}
+
+			publicKey := mustDecodeHex(t, vector.publicKey)
+			if !bytes.Equal(keypair.PublicKey, publicKey) {
+				t.Fatalf("expected public key %s; got %x", vector.publicKey, keypair.PublicKey)
+			}
+
+			alpha := mustDecodeHex(t, vector.alpha)
+			output, proof, err := keypair.Prove(alpha)
+			if err != nil {
+				t.Fatalf("failed to prove; %s", err.Error())
+			}
+
+			if hex.EncodeToString(proof) != vector.proof {
+				t.Fatalf("expected proof %s; got %x", vector.proof, proof)
+			}
+
+			if hex.EncodeToString(output) != vector.output {
+				t.Fatalf("expected output %s; got %x", vector.output, output)
+			}
+
+			output, err = vrfVerify(publicKey, alpha, mustDecodeHex(t, vector.proof))
+			if err != nil {
+				t.Fatalf("failed to verify proof; %s", err.Error())
+			}
+
+			if hex.EncodeToString(output) != vector.output {
+				t.Fatalf("expected verified output %s; got %x", vector.output, output)
+			}
+		})
+	}
+}
+
+func TestVRFVerifyRejects(t *testing.T) {
+	vector := vrfTestVectors[1]
+	publicKey := mustDecodeHex(t, vector.publicKey)
+	alpha := mustDecodeHex(t, vector.alpha)
+
+	tampered := func(offset int) []byte {
+		proof := mustDecodeHex(t, vector.proof)
+		proof[offset] ^= 0x01
+		return proof
+	}
+
+	tests := []struct {
+		name      string
+		publicKey []byte
+		alpha     []byte
+		proof     []byte
+	}{
+		{name: "tampered gamma", publicKey: publicKey, alpha: alpha, proof: tampered(0)},
+		{name: "tampered challenge", publicKey: publicKey, alpha: alpha, proof: tampered(32)},
+		{name: "tampered scalar", publicKey: publicKey, alpha: alpha, proof: tampered(48)},
+		{name: "truncated proof", publicKey: publicKey, alpha: alpha, proof: mustDecodeHex(t, vector.proof)[:vrfProofLength-1]},
+		{name: "wrong public key", publicKey: mustDecodeHex(t, vrfTestVectors[0].publicKey), alpha: alpha, proof: mustDecodeHex(t, vector.proof)},
+		{name: "wrong input", publicKey: publicKey, alpha: []byte{0x73}, proof: mustDecodeHex(t, vector.proof)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := vrfVerify(test.publicKey, test.alpha, test.proof)
+			if err == nil {
+				t.Fatal("expected proof to be rejected")
+			}
+		})
+	}
+}